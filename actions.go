@@ -0,0 +1,365 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	openaillm "github.com/tmc/langchaingo/llms/openai"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// Supported operation action types.
+const (
+	actionPatch       = "Patch"
+	actionLabels      = "Labels"
+	actionAnnotations = "Annotations"
+	actionStatus      = "Status"
+	actionNoOp        = "NoOp"
+)
+
+// actionTypes are the supported operation action types.
+var actionTypes = []string{actionPatch, actionLabels, actionAnnotations, actionStatus, actionNoOp}
+
+// operationActionsInstructions describe the actions GPT may respond with.
+// They're appended to the user prompt, so that GPT knows how to respond even
+// if the endpoint doesn't support structured outputs.
+const operationActionsInstructions = `Respond only with a JSON object with an "actions" list. Each action has:
+- type: one of Patch, Labels, Annotations, Status, or NoOp.
+- target: the apiVersion, kind, namespace and name of the resource the action applies to. Only target the resources you were given.
+- patch: for Patch actions, a JSON merge patch of the resource's fields, encoded as a JSON object. Don't patch its apiVersion, kind, name, namespace or status. Don't use null. Empty for other actions.
+- entries: for Labels and Annotations actions, the keys and values to set. Empty for other actions.
+- status: for Status actions, the status fields to set, encoded as a JSON object. Don't use null. Empty for other actions.
+- explanation: why the action is needed.
+If a resource doesn't need to change, respond with a NoOp action explaining why.`
+
+// operationActionsSchema constrains GPT's actions. Strict schemas require every
+// property, so properties that don't apply to an action are empty.
+var operationActionsSchema = &llm.Schema{
+	Name:   "operation_actions",
+	Strict: true,
+	Schema: &openaillm.ResponseFormatJSONSchemaProperty{
+		Type:     "object",
+		Required: []string{"actions"},
+		Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+			"actions": {
+				Type:        "array",
+				Description: "The actions to take.",
+				Items: &openaillm.ResponseFormatJSONSchemaProperty{
+					Type:     "object",
+					Required: []string{"type", "target", "patch", "entries", "status", "explanation"},
+					Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+						"type": {
+							Type:        "string",
+							Enum:        []any{actionPatch, actionLabels, actionAnnotations, actionStatus, actionNoOp},
+							Description: "The type of action.",
+						},
+						"target": {
+							Type:        "object",
+							Description: "The resource the action applies to.",
+							Required:    []string{"apiVersion", "kind", "namespace", "name"},
+							Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+								"apiVersion": {Type: "string", Description: "The resource's apiVersion."},
+								"kind":       {Type: "string", Description: "The resource's kind."},
+								"namespace":  {Type: "string", Description: "The resource's namespace. Empty if it's cluster scoped."},
+								"name":       {Type: "string", Description: "The resource's name."},
+							},
+						},
+						"patch": {
+							Type:        "string",
+							Description: "For Patch actions, a JSON merge patch encoded as a JSON object. Empty otherwise.",
+						},
+						"entries": {
+							Type:        "array",
+							Description: "For Labels and Annotations actions, the keys and values to set. Empty otherwise.",
+							Items: &openaillm.ResponseFormatJSONSchemaProperty{
+								Type:     "object",
+								Required: []string{"key", "value"},
+								Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+									"key":   {Type: "string", Description: "The label or annotation key."},
+									"value": {Type: "string", Description: "The label or annotation value."},
+								},
+							},
+						},
+						"status": {
+							Type:        "string",
+							Description: "For Status actions, the status fields to set encoded as a JSON object. Empty otherwise.",
+						},
+						"explanation": {
+							Type:        "string",
+							Description: "Why the action is needed.",
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// actionsResponse is GPT's response when asked for actions.
+type actionsResponse struct {
+	Actions []operationAction `json:"actions"`
+}
+
+type operationAction struct {
+	Type   string       `json:"type"`
+	Target actionTarget `json:"target"`
+
+	// Patch and Status should be JSON encoded objects, but we tolerate
+	// endpoints that return them as objects.
+	Patch  json.RawMessage `json:"patch,omitempty"`
+	Status json.RawMessage `json:"status,omitempty"`
+
+	Entries     []actionEntry `json:"entries,omitempty"`
+	Explanation string        `json:"explanation"`
+}
+
+type actionTarget struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+func (t actionTarget) String() string {
+	return fmt.Sprintf("%s %s", t.Kind, objectKey(t.Namespace, t.Name))
+}
+
+type actionEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// An actionPlan is the outcome of a list of valid actions.
+type actionPlan struct {
+	// desired resources that apply the actions.
+	desired map[string]*fnv1.Resource
+
+	// summaries of each action, in the order GPT returned them.
+	summaries []string
+}
+
+// actionsFrom parses and validates the actions GPT returned for the supplied
+// batch of watched resources. It returns any problems with the actions that
+// GPT may be able to repair.
+func actionsFrom(resp string, batch []resource.Required) (*actionPlan, []string) {
+	r := &actionsResponse{}
+	if err := json.Unmarshal([]byte(removeJSONMarkdown(resp)), r); err != nil {
+		return nil, []string{fmt.Sprintf("response is not a JSON object with a list of actions: %s", err)}
+	}
+	if len(r.Actions) == 0 {
+		return nil, []string{"response has no actions: use a NoOp action if no resources need to change"}
+	}
+
+	watched := make(map[actionTarget]bool, len(batch))
+	for _, w := range batch {
+		watched[actionTarget{
+			APIVersion: w.Resource.GetAPIVersion(),
+			Kind:       w.Resource.GetKind(),
+			Namespace:  w.Resource.GetNamespace(),
+			Name:       w.Resource.GetName(),
+		}] = true
+	}
+
+	problems := make([]string, 0)
+	objs := make([]map[string]any, len(r.Actions))
+	for i, a := range r.Actions {
+		obj, err := a.changes()
+		if err == nil && !watched[a.Target] {
+			err = errors.Errorf("%s isn't one of the resources you were given", a.Target)
+		}
+		if err == nil && strings.TrimSpace(a.Explanation) == "" {
+			err = errors.New("explanation is required")
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("action %d (%s %s): %s", i, a.Type, a.Target, err))
+			continue
+		}
+		objs[i] = obj
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	plan := &actionPlan{desired: map[string]*fnv1.Resource{}, summaries: make([]string, 0, len(r.Actions))}
+	merged := map[string]map[string]any{}
+	for i, a := range r.Actions {
+		plan.summaries = append(plan.summaries, fmt.Sprintf("%s %s: %s", a.Type, a.Target, a.Explanation))
+		if objs[i] == nil {
+			continue
+		}
+		key := objectKey(a.Target.Namespace, a.Target.Name)
+		obj, ok := merged[key]
+		if !ok {
+			meta := map[string]any{"name": a.Target.Name}
+			if a.Target.Namespace != "" {
+				meta["namespace"] = a.Target.Namespace
+			}
+			obj = map[string]any{"apiVersion": a.Target.APIVersion, "kind": a.Target.Kind, "metadata": meta}
+		}
+		merged[key] = mergeMaps(obj, objs[i])
+	}
+	for key, obj := range merged {
+		s, err := structpb.NewStruct(obj)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("cannot convert changes to %s: %s", key, err)}
+		}
+		plan.desired[key] = &fnv1.Resource{Resource: s}
+	}
+	return plan, nil
+}
+
+// changes returns the fields the action sets, or nil if it doesn't set any.
+func (a operationAction) changes() (map[string]any, error) {
+	switch a.Type {
+	case actionPatch:
+		patch, err := decodeObject(a.Patch)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid patch")
+		}
+		for _, f := range []string{"apiVersion", "kind", "status"} {
+			if _, ok := patch[f]; ok {
+				return nil, errors.Errorf("patch must not set %s", f)
+			}
+		}
+		if meta, ok := patch["metadata"].(map[string]any); ok {
+			if _, ok := meta["name"]; ok {
+				return nil, errors.New("patch must not set metadata.name")
+			}
+			if _, ok := meta["namespace"]; ok {
+				return nil, errors.New("patch must not set metadata.namespace")
+			}
+		}
+		return patch, nil
+	case actionLabels, actionAnnotations:
+		if len(a.Entries) == 0 {
+			return nil, errors.New("entries are required")
+		}
+		kv := make(map[string]any, len(a.Entries))
+		for _, e := range a.Entries {
+			if e.Key == "" {
+				return nil, errors.New("entries must have a key")
+			}
+			kv[e.Key] = e.Value
+		}
+		return map[string]any{"metadata": map[string]any{strings.ToLower(a.Type): kv}}, nil
+	case actionStatus:
+		status, err := decodeObject(a.Status)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid status")
+		}
+		return map[string]any{"status": status}, nil
+	case actionNoOp:
+		return nil, nil
+	default:
+		return nil, errors.Errorf("type must be one of %s", strings.Join(actionTypes, ", "))
+	}
+}
+
+// decodeObject decodes the supplied non-empty JSON object, which may be
+// encoded as a JSON string. Objects containing null are rejected, because
+// desired resources can't remove fields.
+func decodeObject(raw json.RawMessage) (map[string]any, error) {
+	j := []byte(raw)
+	var encoded string
+	if err := json.Unmarshal(j, &encoded); err == nil {
+		j = []byte(encoded)
+	}
+	out := map[string]any{}
+	if err := json.Unmarshal(j, &out); err != nil {
+		return nil, errors.Wrap(err, "must be a JSON object")
+	}
+	if len(out) == 0 {
+		return nil, errors.New("must not be empty")
+	}
+	if containsNull(out) {
+		return nil, errors.New("must not contain null; fields can't be removed")
+	}
+	return out, nil
+}
+
+func containsNull(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return slices.ContainsFunc(mapValues(t), containsNull)
+	case []any:
+		return slices.ContainsFunc(t, containsNull)
+	default:
+		return false
+	}
+}
+
+func mapValues(m map[string]any) []any {
+	out := make([]any, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	return out
+}
+
+// operateActions asks GPT for actions to take on the supplied batch of watched
+// resources, and returns the desired resources that apply them. Invalid
+// actions are fed back to GPT to repair, up to the configured number of
+// attempts. A Normal result is returned for each action, and an error if the
+// actions remain invalid.
+func (f *Function) operateActions(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string, batch []resource.Required) (map[string]*fnv1.Resource, error) {
+	prompt = prompt + "\n\n" + operationActionsInstructions
+
+	var plan *actionPlan
+	var problems []string
+	attempt := func(ctx context.Context, prompt string) (string, []string, error) {
+		r, err := f.invoke(ctx, log, d, prompt, withResponseSchema(operationActionsSchema))
+		if structuredOutputRejected(err) {
+			log.Debug("Endpoint rejected structured output, asking for unstructured actions", "error", err)
+			r, err = f.invoke(ctx, log, d, prompt)
+		}
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to run chain")
+		}
+		plan, problems = actionsFrom(r, batch)
+		if len(problems) > 0 {
+			f.metrics.ParseFailure(metricsLabels(d))
+		}
+		return r, problems, nil
+	}
+
+	if err := f.repair(ctx, log, d, prompt, attempt); err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, errors.Errorf("GPT's actions are invalid: %s", strings.Join(problems, "; "))
+	}
+
+	for _, s := range plan.summaries {
+		response.Normal(d.rsp, s)
+	}
+	return plan.desired, nil
+}
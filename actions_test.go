@@ -0,0 +1,136 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestActionsFrom(t *testing.T) {
+	batch := []resource.Required{
+		{Resource: &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web", "namespace": "default"},
+		}}},
+		{Resource: &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "example.org/v1",
+			"kind":       "Cluster",
+			"metadata":   map[string]any{"name": "prod"},
+		}}},
+	}
+
+	type want struct {
+		plan     *actionPlan
+		problems []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		resp   string
+		want   want
+	}{
+		"NotJSON": {
+			reason: "A response that isn't JSON should be a problem.",
+			resp:   "scale it up",
+			want: want{
+				problems: []string{"response is not a JSON object with a list of actions: invalid character 's' looking for beginning of value"},
+			},
+		},
+		"NoActions": {
+			reason: "A response without actions should be a problem.",
+			resp:   `{"actions":[]}`,
+			want: want{
+				problems: []string{"response has no actions: use a NoOp action if no resources need to change"},
+			},
+		},
+		"NoOp": {
+			reason: "A NoOp action should be summarized without changing any resources.",
+			resp:   "```json\n" + `{"actions":[{"type":"NoOp","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"patch":"","entries":[],"status":"","explanation":"It's healthy."}]}` + "\n```",
+			want: want{
+				plan: &actionPlan{
+					desired:   map[string]*fnv1.Resource{},
+					summaries: []string{"NoOp Deployment default/web: It's healthy."},
+				},
+			},
+		},
+		"MergedActions": {
+			reason: "Actions targeting the same resource should be merged into one desired resource.",
+			resp: `{"actions":[
+				{"type":"Patch","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"patch":{"spec":{"replicas":3}},"entries":[],"status":"","explanation":"Scale up."},
+				{"type":"Annotations","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"patch":"","entries":[{"key":"scaled","value":"true"}],"status":"","explanation":"Record scaling."},
+				{"type":"Status","target":{"apiVersion":"example.org/v1","kind":"Cluster","namespace":"","name":"prod"},"patch":"","entries":[],"status":"{\"healthy\":false}","explanation":"Nodes are down."}
+			]}`,
+			want: want{
+				plan: &actionPlan{
+					desired: map[string]*fnv1.Resource{
+						"default/web": {Resource: resource.MustStructJSON(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"default","annotations":{"scaled":"true"}},"spec":{"replicas":3}}`)},
+						"prod":        {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Cluster","metadata":{"name":"prod"},"status":{"healthy":false}}`)},
+					},
+					summaries: []string{
+						"Patch Deployment default/web: Scale up.",
+						"Annotations Deployment default/web: Record scaling.",
+						"Status Cluster prod: Nodes are down.",
+					},
+				},
+			},
+		},
+		"InvalidActions": {
+			reason: "Every invalid action should be a problem.",
+			resp: `{"actions":[
+				{"type":"Patch","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"other","name":"web"},"patch":"{\"spec\":{}}","explanation":"Wrong namespace."},
+				{"type":"Patch","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"patch":"{\"metadata\":{\"name\":\"api\"}}","explanation":"Rename."},
+				{"type":"Patch","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"patch":"{\"spec\":{\"paused\":null}}","explanation":"Unpause."},
+				{"type":"Labels","target":{"apiVersion":"apps/v1","kind":"Deployment","namespace":"default","name":"web"},"entries":[],"explanation":"Label it."},
+				{"type":"Status","target":{"apiVersion":"example.org/v1","kind":"Cluster","name":"prod"},"status":"healthy","explanation":"Mark it."},
+				{"type":"Delete","target":{"apiVersion":"example.org/v1","kind":"Cluster","name":"prod"},"explanation":"Remove it."},
+				{"type":"NoOp","target":{"apiVersion":"example.org/v1","kind":"Cluster","name":"prod"},"explanation":""}
+			]}`,
+			want: want{
+				problems: []string{
+					"action 0 (Patch Deployment other/web): Deployment other/web isn't one of the resources you were given",
+					"action 1 (Patch Deployment default/web): patch must not set metadata.name",
+					"action 2 (Patch Deployment default/web): invalid patch: must not contain null; fields can't be removed",
+					"action 3 (Labels Deployment default/web): entries are required",
+					"action 4 (Status Cluster prod): invalid status: must be a JSON object: invalid character 'h' looking for beginning of value",
+					"action 5 (Delete Cluster prod): type must be one of Patch, Labels, Annotations, Status, NoOp",
+					"action 6 (NoOp Cluster prod): explanation is required",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			plan, problems := actionsFrom(tc.resp, batch)
+
+			if diff := cmp.Diff(tc.want.plan, plan, cmp.AllowUnexported(actionPlan{}), protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nactionsFrom(...): -want plan, +got plan:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.problems, problems); diff != "" {
+				t.Errorf("%s\nactionsFrom(...): -want problems, +got problems:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/budget"
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// budgetLimits are enforced on every prompt, in addition to any limits the
+// prompt's input configures.
+type budgetLimits struct {
+	model         budget.Limits
+	compositeKind budget.Limits
+	composite     budget.Limits
+}
+
+// WithBudgets limits every prompt's use of GPT per model, per composite
+// resource kind, and per composite resource.
+func WithBudgets(model, compositeKind, composite budget.Limits) Option {
+	return func(f *Function) {
+		f.budgets = budgetLimits{model: model, compositeKind: compositeKind, composite: composite}
+	}
+}
+
+// budgetScope identifies the budgets an invocation's use of GPT counts
+// against.
+type budgetScope struct {
+	// compositeKind and composite identify the composite resource being
+	// composed. Empty in operation pipelines.
+	compositeKind string
+	composite     string
+
+	// limits configured by the input, if any.
+	limits *v1alpha1.Budget
+}
+
+// budgetScopeFor the supplied pipeline.
+func budgetScopeFor(d pipelineDetails) budgetScope {
+	s := budgetScope{limits: d.in.Budget}
+	if inCompositionPipeline(d.req) {
+		xr := d.req.GetObserved().GetComposite().GetResource().GetFields()
+		meta := xr["metadata"].GetStructValue().GetFields()
+		s.compositeKind = xr["kind"].GetStringValue()
+		s.composite = objectKey(meta["namespace"].GetStringValue(), meta["name"].GetStringValue())
+	}
+	return s
+}
+
+// withBudgetScope counts the invocation's use of GPT against the budgets
+// identified by the supplied scope.
+func withBudgetScope(s budgetScope) invokeOption {
+	return func(o *invokeOptions) {
+		o.budget = s
+	}
+}
+
+// withUsage calls the supplied function with the number of tokens the
+// invocation used, once it completes.
+func withUsage(fn func(tokens int)) invokeOption {
+	return func(o *invokeOptions) {
+		o.onUsage = fn
+	}
+}
+
+// A budgetingInvoker only invokes the agent it wraps if the invocation's
+// budgets allow it. It returns an error wrapping budget.ErrExhausted if they
+// don't.
+type budgetingInvoker struct {
+	wrapped agentInvoker
+	limiter *budget.Limiter
+	limits  budgetLimits
+	log     logging.Logger
+}
+
+// Invoke the wrapped agent if the invocation's budgets allow it, counting the
+// request and the tokens it uses against them.
+func (b *budgetingInvoker) Invoke(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (string, error) {
+	io := &invokeOptions{}
+	for _, o := range opts {
+		o(io)
+	}
+
+	budgets := b.budgetsFor(cfg, io.budget)
+	if len(budgets) == 0 {
+		return b.wrapped.Invoke(ctx, cfg, system, prompt, opts...)
+	}
+	if err := b.limiter.Reserve(budgets...); err != nil {
+		b.log.Debug("Not invoking agent", "reason", err.Error())
+		return "", err
+	}
+
+	opts = append(opts, withUsage(func(tokens int) {
+		b.limiter.Spend(tokens, budgets...)
+	}))
+	return b.wrapped.Invoke(ctx, cfg, system, prompt, opts...)
+}
+
+// budgetsFor returns the budgets that limit the supplied invocation. Budgets
+// without limits are omitted.
+func (b *budgetingInvoker) budgetsFor(cfg llm.Config, s budgetScope) []budget.Budget {
+	in := s.limits
+	if in == nil {
+		in = &v1alpha1.Budget{}
+	}
+
+	provider := cfg.Provider
+	if provider == "" {
+		provider = llm.OpenAI
+	}
+	candidates := []budget.Budget{{
+		Name:   fmt.Sprintf("%s model %q", provider, llm.ModelName(cfg)),
+		Limits: b.limits.model.Stricter(limitsFrom(in.Model)),
+	}}
+	if s.compositeKind != "" {
+		candidates = append(candidates, budget.Budget{
+			Name:   fmt.Sprintf("composite resource kind %q", s.compositeKind),
+			Limits: b.limits.compositeKind.Stricter(limitsFrom(in.CompositeKind)),
+		})
+	}
+	if s.composite != "" {
+		candidates = append(candidates, budget.Budget{
+			Name:   fmt.Sprintf("composite resource %s %q", s.compositeKind, s.composite),
+			Limits: b.limits.composite.Stricter(limitsFrom(in.Composite)),
+		})
+	}
+
+	out := make([]budget.Budget, 0, len(candidates))
+	for _, c := range candidates {
+		if !c.Limits.IsZero() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// limitsFrom returns the supplied input's limits.
+func limitsFrom(l *v1alpha1.BudgetLimits) budget.Limits {
+	out := budget.Limits{}
+	if l == nil {
+		return out
+	}
+	if l.RequestsPerMinute != nil {
+		out.RequestsPerMinute = *l.RequestsPerMinute
+	}
+	if l.TokensPerHour != nil {
+		out.TokensPerHour = *l.TokensPerHour
+	}
+	if l.TokensPerDay != nil {
+		out.TokensPerDay = *l.TokensPerDay
+	}
+	return out
+}
+
+// composePrevious returns the composed resources GPT previously generated,
+// with a Warning result explaining why GPT couldn't be asked to generate them
+// again. They're read from the composite resource's previous output
+// annotation if it has one, or otherwise from its observed composed
+// resources.
+func (f *Function) composePrevious(ctx context.Context, log logging.Logger, d pipelineDetails, reason error) (*fnv1.RunFunctionResponse, error) {
+	log.Info("Cannot ask GPT to generate composed resources", "reason", reason.Error())
+	response.Warning(d.rsp, errors.Wrap(reason, "cannot ask GPT to generate composed resources; returning the composed resources it previously generated"))
+
+	dcds, err := f.previousComposed(d)
+	if err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+
+	dcds, xr := splitComposite(d.in.Composite, dcds)
+	if err := f.applyComposite(d, xr); err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+	d.rsp.Desired.Resources = mergeComposed(log, d.in.Merge, d.req.GetDesired().GetResources(), dcds)
+	f.readiness(ctx, log, d)
+	return d.rsp, nil
+}
+
+// previousComposed returns the composed resources GPT previously generated.
+// Any previous output annotation is recorded again, unchanged, so that it
+// isn't removed from the composite resource.
+func (f *Function) previousComposed(d pipelineDetails) (map[string]*fnv1.Resource, error) {
+	oxr, err := request.GetObservedCompositeResource(d.req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get observed composite resource")
+	}
+	if raw, ok := oxr.Resource.GetAnnotations()[annotationPreviousOutput]; ok {
+		if p, err := decodePreviousOutput(raw); err == nil {
+			if err := setCompositeAnnotation(d.rsp, annotationPreviousOutput, raw); err != nil {
+				return nil, err
+			}
+			return p.desired(d.in.Composite != nil)
+		}
+	}
+
+	out := make(map[string]*fnv1.Resource, len(d.req.GetObserved().GetResources()))
+	for name, ocd := range d.req.GetObserved().GetResources() {
+		s, err := structpb.NewStruct(desiredFromObserved(ocd.GetResource().AsMap()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot convert observed composed resource %q to desired", name)
+		}
+		out[name] = &fnv1.Resource{Resource: s}
+	}
+	return out, nil
+}
+
+// desiredFromObserved returns the supplied observed resource without its
+// status, or metadata set by the API server.
+func desiredFromObserved(obj map[string]any) map[string]any {
+	out := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if k != "status" && k != "metadata" {
+			out[k] = v
+		}
+	}
+	meta, _ := obj["metadata"].(map[string]any)
+	m := map[string]any{}
+	for _, k := range []string{"name", "generateName", "namespace", "labels", "annotations"} {
+		if v, ok := meta[k]; ok {
+			m[k] = v
+		}
+	}
+	out["metadata"] = m
+	return out
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/utils/ptr"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/budget"
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+func TestBudgetingInvoker(t *testing.T) {
+	xr := budgetScope{compositeKind: "XBucket", composite: "cool-xr"}
+
+	type args struct {
+		limits budgetLimits
+		scopes []budgetScope
+		tokens int
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []bool
+	}{
+		"Unlimited": {
+			reason: "Invocations shouldn't be limited if no budget is configured.",
+			args: args{
+				scopes: []budgetScope{xr, xr, xr},
+			},
+			want: []bool{true, true, true},
+		},
+		"FlagLimits": {
+			reason: "Invocations should be refused once a budget configured by the function's flags is exhausted.",
+			args: args{
+				limits: budgetLimits{composite: budget.Limits{RequestsPerMinute: 2}},
+				scopes: []budgetScope{xr, xr, xr, {compositeKind: "XBucket", composite: "other-xr"}},
+			},
+			want: []bool{true, true, false, true},
+		},
+		"InputLimits": {
+			reason: "A stricter budget configured by the input should be enforced.",
+			args: args{
+				limits: budgetLimits{compositeKind: budget.Limits{RequestsPerMinute: 10}},
+				scopes: []budgetScope{
+					{compositeKind: "XBucket", composite: "a", limits: &v1alpha1.Budget{CompositeKind: &v1alpha1.BudgetLimits{RequestsPerMinute: ptr.To(1)}}},
+					{compositeKind: "XBucket", composite: "b", limits: &v1alpha1.Budget{CompositeKind: &v1alpha1.BudgetLimits{RequestsPerMinute: ptr.To(1)}}},
+				},
+			},
+			want: []bool{true, false},
+		},
+		"Tokens": {
+			reason: "The tokens an invocation uses should count against its budgets.",
+			args: args{
+				limits: budgetLimits{model: budget.Limits{TokensPerHour: 100}},
+				scopes: []budgetScope{xr, xr},
+				tokens: 100,
+			},
+			want: []bool{true, false},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			b := &budgetingInvoker{
+				wrapped: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, opts ...invokeOption) (string, error) {
+						io := &invokeOptions{}
+						for _, o := range opts {
+							o(io)
+						}
+						if io.onUsage != nil {
+							io.onUsage(tc.args.tokens)
+						}
+						return "ok", nil
+					},
+				},
+				limiter: budget.NewLimiter(),
+				limits:  tc.args.limits,
+				log:     logging.NewNopLogger(),
+			}
+
+			got := make([]bool, 0, len(tc.args.scopes))
+			for _, s := range tc.args.scopes {
+				_, err := b.Invoke(t.Context(), llm.Config{Provider: llm.OpenAI, Model: "gpt-4o"}, "", "", withBudgetScope(s))
+				if err != nil && !errors.Is(err, budget.ErrExhausted) {
+					t.Fatalf("Invoke(...): want budget.ErrExhausted, got %v", err)
+				}
+				got = append(got, err == nil)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nInvoke(...): -want allowed, +got allowed:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	exhausted := &mockAgentInvoker{
+		InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+			return "", errors.Wrap(budget.ErrExhausted, `openai model "gpt-4" is limited to 1 requests per minute`)
+		},
+	}
+
+	previous, err := encodePreviousOutput(&previousOutput{Resources: map[string]map[string]any{
+		"bucket": {"apiVersion": "example.org/v1", "kind": "Bucket", "spec": map[string]any{"region": "eu-west-1"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		results []*fnv1.Result
+		desired map[string]*fnv1.Resource
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *fnv1.RunFunctionRequest
+		want   want
+	}{
+		"PreviousOutput": {
+			reason: "The composed resources GPT previously generated should be returned with a Warning.",
+			req: &fnv1.RunFunctionRequest{
+				Input:       resource.MustStructJSON(`{"apiVersion":"openai.fn.upbound.io/v1alpha1","kind":"Prompt","userPrompt":"compose"}`),
+				Credentials: mockCredentials(),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr","annotations":{"` + annotationPreviousOutput + `":"` + previous + `"}}}`),
+				}},
+				Desired: &fnv1.State{},
+			},
+			want: want{
+				results: []*fnv1.Result{{
+					Severity: fnv1.Severity_SEVERITY_WARNING,
+					Message:  `cannot ask GPT to generate composed resources; returning the composed resources it previously generated: failed to run chain: openai model "gpt-4" is limited to 1 requests per minute: budget exhausted`,
+					Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+				}},
+				desired: map[string]*fnv1.Resource{
+					"bucket": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket","spec":{"region":"eu-west-1"}}`)},
+				},
+			},
+		},
+		"ObservedComposed": {
+			reason: "The observed composed resources, without their status, should be returned if there's no previous output.",
+			req: &fnv1.RunFunctionRequest{
+				Input:       resource.MustStructJSON(`{"apiVersion":"openai.fn.upbound.io/v1alpha1","kind":"Prompt","userPrompt":"compose"}`),
+				Credentials: mockCredentials(),
+				Observed: &fnv1.State{
+					Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"}}`)},
+					Resources: map[string]*fnv1.Resource{
+						"bucket": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket","metadata":{"name":"cool-xr-abc","uid":"1234","resourceVersion":"3"},"spec":{"region":"eu-west-1"},"status":{"ready":true}}`)},
+					},
+				},
+				Desired: &fnv1.State{},
+			},
+			want: want{
+				results: []*fnv1.Result{{
+					Severity: fnv1.Severity_SEVERITY_WARNING,
+					Message:  `cannot ask GPT to generate composed resources; returning the composed resources it previously generated: failed to run chain: openai model "gpt-4" is limited to 1 requests per minute: budget exhausted`,
+					Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+				}},
+				desired: map[string]*fnv1.Resource{
+					"bucket": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket","metadata":{"name":"cool-xr-abc"},"spec":{"region":"eu-west-1"}}`)},
+				},
+			},
+		},
+		"Operation": {
+			reason: "Watched resources shouldn't be processed, and a Warning returned, in operation pipelines.",
+			req: &fnv1.RunFunctionRequest{
+				Input:       resource.MustStructJSON(`{"apiVersion":"openai.fn.upbound.io/v1alpha1","kind":"Prompt","userPrompt":"{{ .Resources }}"}`),
+				Credentials: mockCredentials(),
+				RequiredResources: map[string]*fnv1.Resources{
+					"ops.crossplane.io/watched-resource": {
+						Items: []*fnv1.Resource{
+							{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"default"}}`)},
+						},
+					},
+				},
+				Desired: &fnv1.State{},
+			},
+			want: want{
+				results: []*fnv1.Result{{
+					Severity: fnv1.Severity_SEVERITY_WARNING,
+					Message:  `cannot ask GPT to process watched resources: failed to run chain: openai model "gpt-4" is limited to 1 requests per minute: budget exhausted`,
+					Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), ai: exhausted}
+			rsp, err := f.RunFunction(t.Context(), tc.req)
+			if err != nil {
+				t.Fatalf("%s\nRunFunction(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.results, rsp.GetResults(), protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nRunFunction(...): -want results, +got results:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.desired, rsp.GetDesired().GetResources(), protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nRunFunction(...): -want desired, +got desired:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
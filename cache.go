@@ -0,0 +1,187 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/logging"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/cache"
+	"github.com/upbound/function-openai/internal/llm"
+	"github.com/upbound/function-openai/internal/tool"
+)
+
+// defaultCacheTTL is how long responses are cached for if the input doesn't
+// specify a TTL.
+const defaultCacheTTL = 1 * time.Hour
+
+// withCachePolicy configures how the cache is used for an invocation. Caching
+// is disabled unless the input has a cache policy.
+func withCachePolicy(p *v1alpha1.CachePolicy) invokeOption {
+	return func(o *invokeOptions) {
+		o.cacheMode = v1alpha1.CacheModeDisabled
+		o.cacheTTL = defaultCacheTTL
+		if p == nil {
+			return
+		}
+		o.cacheMode = v1alpha1.CacheModeEnabled
+		if p.Mode != "" {
+			o.cacheMode = p.Mode
+		}
+		if p.TTL != nil {
+			o.cacheTTL = p.TTL.Duration
+		}
+	}
+}
+
+// withCacheHit calls the supplied function if an invocation's response is
+// served from the cache.
+func withCacheHit(fn func()) invokeOption {
+	return func(o *invokeOptions) {
+		o.onCacheHit = fn
+	}
+}
+
+// withPendingCache defers caching an invocation's response until the caller
+// accepts it, so that responses the caller can't use aren't cached.
+func withPendingCache(p *pendingCache) invokeOption {
+	return func(o *invokeOptions) {
+		o.pending = p
+	}
+}
+
+// A pendingCache holds responses that will be cached once they're accepted.
+type pendingCache struct {
+	commits []func()
+}
+
+// Accept caches the pending responses.
+func (p *pendingCache) Accept() {
+	if p == nil {
+		return
+	}
+	for _, c := range p.commits {
+		c()
+	}
+	p.commits = nil
+}
+
+type pendingCacheKey struct{}
+
+// withPendingCacheContext returns a context that defers caching responses
+// to invocations made using it until the supplied pendingCache is accepted.
+func withPendingCacheContext(ctx context.Context, p *pendingCache) context.Context {
+	return context.WithValue(ctx, pendingCacheKey{}, p)
+}
+
+// pendingCacheFrom returns the pendingCache of the supplied context, if any.
+func pendingCacheFrom(ctx context.Context) *pendingCache {
+	p, _ := ctx.Value(pendingCacheKey{}).(*pendingCache)
+	return p
+}
+
+// A cachingInvoker serves responses from a cache, only invoking the agent it
+// wraps when no response is cached. Caching is best effort; cache errors are
+// logged and otherwise ignored.
+type cachingInvoker struct {
+	wrapped agentInvoker
+	cache   cache.Cache
+	log     logging.Logger
+}
+
+// Invoke returns a cached response to the supplied prompts, or invokes the
+// wrapped agent and caches its response. The response is only cached once
+// it's accepted if the invocation has a pendingCache.
+func (c *cachingInvoker) Invoke(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (string, error) {
+	io := &invokeOptions{}
+	for _, o := range opts {
+		o(io)
+	}
+
+	if io.cacheMode == "" || io.cacheMode == v1alpha1.CacheModeDisabled {
+		return c.wrapped.Invoke(ctx, cfg, system, prompt, opts...)
+	}
+
+	key := cacheKey(cfg, system, prompt, io.schema, io.mcpServers)
+	log := c.log.WithValues("cacheKey", key)
+
+	if io.cacheMode == v1alpha1.CacheModeEnabled {
+		resp, ok, err := c.cache.Get(key)
+		if err != nil {
+			log.Info("Cannot read cached response", "error", err)
+		}
+		if ok {
+			log.Debug("Using cached response")
+			if io.onCacheHit != nil {
+				io.onCacheHit()
+			}
+			return resp, nil
+		}
+		log.Debug("No cached response")
+	}
+
+	resp, err := c.wrapped.Invoke(ctx, cfg, system, prompt, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	commit := func() {
+		if err := c.cache.Set(key, resp, io.cacheTTL); err != nil {
+			log.Info("Cannot cache response", "error", err)
+		}
+	}
+	if io.pending != nil {
+		io.pending.commits = append(io.pending.commits, commit)
+		return resp, nil
+	}
+	commit()
+	return resp, nil
+}
+
+// cacheKey derives a cache key from everything that determines the model's
+// response, including the full schema it's constrained by and the MCP servers
+// it may call tools from. The rendered user prompt includes the observed
+// state, so the key changes whenever the observed state does. Credentials
+// aren't part of the key.
+func cacheKey(cfg llm.Config, system, prompt string, s *llm.Schema, servers map[string]tool.Config) string {
+	schema := ""
+	if s != nil {
+		b, _ := json.Marshal(s)
+		schema = string(b)
+	}
+	return cache.Key(cfg.Provider, cfg.BaseURL, cfg.Model, cfg.Deployment, schema, mcpServersKey(servers), system, prompt)
+}
+
+// mcpServersKey returns a stable encoding of the supplied MCP servers,
+// including their argument policies but not their credentials.
+func mcpServersKey(servers map[string]tool.Config) string {
+	type server struct {
+		tool.Config
+		Arguments []tool.ArgumentPolicy `json:"arguments,omitempty"`
+	}
+	out := make(map[string]server, len(servers))
+	for name, cfg := range servers {
+		out[name] = server{Config: cfg, Arguments: cfg.Arguments}
+	}
+	// Maps are encoded with sorted keys.
+	b, _ := json.Marshal(out)
+	return string(b)
+}
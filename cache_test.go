@@ -0,0 +1,286 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/cache"
+	"github.com/upbound/function-openai/internal/llm"
+	"github.com/upbound/function-openai/internal/tool"
+)
+
+func TestCachingInvoker(t *testing.T) {
+	cfg := llm.Config{Provider: llm.OpenAI, Model: "gpt-4"}
+
+	type args struct {
+		cached map[string]string
+		opts   []invokeOption
+		accept bool
+	}
+	type want struct {
+		resp    string
+		invoked bool
+		hit     bool
+		cached  string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Miss": {
+			reason: "The agent should be invoked and its response cached if no response is cached.",
+			args: args{
+				opts: []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{})},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+				cached:  "fresh",
+			},
+		},
+		"Hit": {
+			reason: "A cached response should be returned without invoking the agent.",
+			args: args{
+				cached: map[string]string{cacheKey(cfg, "system", "prompt", nil, nil): "cached"},
+				opts:   []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{})},
+			},
+			want: want{
+				resp:   "cached",
+				hit:    true,
+				cached: "cached",
+			},
+		},
+		"DifferentSchema": {
+			reason: "A response cached without a schema shouldn't be returned when a schema is requested.",
+			args: args{
+				cached: map[string]string{cacheKey(cfg, "system", "prompt", nil, nil): "cached"},
+				opts:   []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{}), withResponseSchema(composedSchema)},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+				cached:  "cached",
+			},
+		},
+		"Unset": {
+			reason: "The agent should be invoked and its response not cached if the input has no cache policy.",
+			args: args{
+				opts: []invokeOption{withCachePolicy(nil)},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+			},
+		},
+		"Pending": {
+			reason: "A response shouldn't be cached until the caller accepts it.",
+			args: args{
+				opts: []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{}), withPendingCache(&pendingCache{})},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+			},
+		},
+		"Accepted": {
+			reason: "A response should be cached once the caller accepts it.",
+			args: args{
+				opts:   []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{})},
+				accept: true,
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+				cached:  "fresh",
+			},
+		},
+		"Refresh": {
+			reason: "The agent should be invoked and its response cached even if a response is cached.",
+			args: args{
+				cached: map[string]string{cacheKey(cfg, "system", "prompt", nil, nil): "cached"},
+				opts:   []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{Mode: v1alpha1.CacheModeRefresh})},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+				cached:  "fresh",
+			},
+		},
+		"Disabled": {
+			reason: "The agent should be invoked and its response not cached if caching is disabled.",
+			args: args{
+				opts: []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{Mode: v1alpha1.CacheModeDisabled})},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+			},
+		},
+		"ZeroTTL": {
+			reason: "A response cached with a zero TTL should never be returned.",
+			args: args{
+				opts: []invokeOption{withCachePolicy(&v1alpha1.CachePolicy{TTL: &metav1.Duration{}})},
+			},
+			want: want{
+				resp:    "fresh",
+				invoked: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := cache.NewMemory(10)
+			for k, v := range tc.args.cached {
+				_ = c.Set(k, v, time.Hour)
+			}
+
+			invoked := false
+			ci := &cachingInvoker{
+				wrapped: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						invoked = true
+						return "fresh", nil
+					},
+				},
+				cache: c,
+				log:   logging.NewNopLogger(),
+			}
+
+			hit := false
+			opts := append(tc.args.opts, withCacheHit(func() { hit = true }))
+			p := &pendingCache{}
+			if tc.args.accept {
+				opts = append(opts, withPendingCache(p))
+			}
+			resp, err := ci.Invoke(context.Background(), cfg, "system", "prompt", opts...)
+			if err != nil {
+				t.Fatalf("\n%s\nInvoke(...): %v", tc.reason, err)
+			}
+			if tc.args.accept {
+				p.Accept()
+			}
+
+			if diff := cmp.Diff(tc.want.resp, resp); diff != "" {
+				t.Errorf("\n%s\nInvoke(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.invoked, invoked); diff != "" {
+				t.Errorf("\n%s\nInvoke(...): -want invoked, +got invoked:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.hit, hit); diff != "" {
+				t.Errorf("\n%s\nInvoke(...): -want hit, +got hit:\n%s", tc.reason, diff)
+			}
+
+			cached, _, _ := c.Get(cacheKey(cfg, "system", "prompt", nil, nil))
+			if diff := cmp.Diff(tc.want.cached, cached); diff != "" {
+				t.Errorf("\n%s\nInvoke(...): -want cached, +got cached:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRepairOnlyCachesAcceptedResponses(t *testing.T) {
+	cfg := llm.Config{Provider: llm.OpenAI, Model: "gpt-4"}
+	c := cache.NewMemory(10)
+	f := &Function{
+		log: logging.NewNopLogger(),
+		ai: &cachingInvoker{
+			wrapped: &mockAgentInvoker{
+				InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+					return "response to " + prompt, nil
+				},
+			},
+			cache: c,
+			log:   logging.NewNopLogger(),
+		},
+	}
+	d := pipelineDetails{
+		rsp: &fnv1.RunFunctionResponse{},
+		in:  &v1alpha1.Prompt{SystemPrompt: "system", RepairAttempts: 1, CachePolicy: &v1alpha1.CachePolicy{}},
+		llm: cfg,
+	}
+
+	// The first response has problems, the repaired response doesn't.
+	attempt := func(ctx context.Context, prompt string) (string, []string, error) {
+		resp, err := f.invoke(ctx, f.log, d, prompt)
+		if prompt == "prompt" {
+			return resp, []string{"broken"}, err
+		}
+		return resp, nil, err
+	}
+	if err := f.repair(context.Background(), f.log, d, "prompt", attempt); err != nil {
+		t.Fatalf("repair(...): %v", err)
+	}
+
+	if _, ok, _ := c.Get(cacheKey(cfg, "system", "prompt", nil, nil)); ok {
+		t.Errorf("repair(...): a response with problems should not be cached")
+	}
+	repaired := repairPrompt("prompt", "response to prompt", []string{"broken"})
+	if _, ok, _ := c.Get(cacheKey(cfg, "system", repaired, nil, nil)); !ok {
+		t.Errorf("repair(...): a response without problems should be cached")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	cfg := llm.Config{Provider: llm.OpenAI, Model: "gpt-4"}
+	docs := map[string]tool.Config{"docs": {Transport: tool.SSE, BaseURL: "http://docs"}}
+
+	cases := map[string]struct {
+		reason string
+		a, b   string
+	}{
+		"Schema": {
+			reason: "Responses constrained by different schemas of the same name should be cached separately.",
+			a:      cacheKey(cfg, "system", "prompt", composedSchema, nil),
+			b:      cacheKey(cfg, "system", "prompt", composedCompositeSchema, nil),
+		},
+		"MCPServers": {
+			reason: "Responses produced with different MCP servers should be cached separately.",
+			a:      cacheKey(cfg, "system", "prompt", nil, nil),
+			b:      cacheKey(cfg, "system", "prompt", nil, docs),
+		},
+		"ArgumentPolicies": {
+			reason: "Responses produced with different tool argument policies should be cached separately.",
+			a:      cacheKey(cfg, "system", "prompt", nil, docs),
+			b: cacheKey(cfg, "system", "prompt", nil, map[string]tool.Config{"docs": {
+				Transport: tool.SSE,
+				BaseURL:   "http://docs",
+				Arguments: []tool.ArgumentPolicy{{Tool: "*", Rule: "true"}},
+			}}),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if tc.a == tc.b {
+				t.Errorf("%s\ncacheKey(...): want different keys, got %q for both", tc.reason, tc.a)
+			}
+		})
+	}
+}
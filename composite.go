@@ -0,0 +1,168 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+// compositeName is the reserved name of the document, or structured response
+// section, GPT uses to write the composite resource's status and connection
+// details.
+const compositeName = "composite"
+
+// splitComposite separates the composite resource GPT generated from the
+// composed resources. The composite resource is nil if GPT didn't generate
+// one. The composite name is only reserved if the input allows GPT to write
+// the composite resource, so existing composed resources named composite keep
+// working.
+func splitComposite(c *v1alpha1.CompositeOutput, generated map[string]*fnv1.Resource) (map[string]*fnv1.Resource, *fnv1.Resource) {
+	if c == nil {
+		return generated, nil
+	}
+	xr, ok := generated[compositeName]
+	if !ok {
+		return generated, nil
+	}
+	out := make(map[string]*fnv1.Resource, len(generated)-1)
+	for name, r := range generated {
+		if name != compositeName {
+			out[name] = r
+		}
+	}
+	return out, xr
+}
+
+// applyComposite writes the status and connection details of the supplied
+// composite resource GPT generated to the desired composite resource, as
+// allowed by the input. splitComposite only returns a composite resource if
+// the input allows GPT to write one. A Warning result is returned for anything
+// GPT wrote that the input's status paths or connection details don't allow.
+func (f *Function) applyComposite(d pipelineDetails, xr *fnv1.Resource) error {
+	if xr == nil {
+		return nil
+	}
+
+	obj := xr.GetResource().AsMap()
+	ignored := make([]string, 0)
+
+	status, _ := obj["status"].(map[string]any)
+	allowed := allowedPaths("status", status, d.in.Composite.StatusPaths, &ignored)
+	if allowed != nil {
+		if err := mergeCompositeStatus(d.rsp, allowed.(map[string]any)); err != nil { //nolint:forcetypeassert // allowedPaths preserves maps.
+			return err
+		}
+	}
+
+	cds, _ := obj["connectionDetails"].(map[string]any)
+	for k, v := range cds {
+		if !slices.Contains(d.in.Composite.ConnectionDetails, k) {
+			ignored = append(ignored, fmt.Sprintf("connection detail %q", k))
+			continue
+		}
+		if d.rsp.GetDesired() == nil {
+			d.rsp.Desired = &fnv1.State{}
+		}
+		if d.rsp.GetDesired().GetComposite() == nil {
+			d.rsp.Desired.Composite = &fnv1.Resource{}
+		}
+		if d.rsp.GetDesired().GetComposite().GetConnectionDetails() == nil {
+			d.rsp.Desired.Composite.ConnectionDetails = map[string][]byte{}
+		}
+		d.rsp.Desired.Composite.ConnectionDetails[k] = []byte(fmt.Sprint(v))
+	}
+
+	sort.Strings(ignored)
+	for _, i := range ignored {
+		response.Warning(d.rsp, errors.Errorf("ignoring composite resource %s generated by GPT: the input doesn't allow GPT to write it", i))
+	}
+	return nil
+}
+
+// allowedPaths returns the parts of the supplied value whose paths match any
+// of the supplied allowed paths, or nil if no part matches. The path of each
+// field that doesn't match is appended to ignored.
+func allowedPaths(path string, v any, allowed []string, ignored *[]string) any {
+	if matchesAny(path, allowed) {
+		return v
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		*ignored = append(*ignored, fmt.Sprintf("field %q", path))
+		return nil
+	}
+	out := map[string]any{}
+	for k, fv := range m {
+		if a := allowedPaths(join(path, k), fv, allowed, ignored); a != nil {
+			out[k] = a
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// mergeCompositeStatus merges the supplied status into the status of the
+// desired composite resource, preserving any status desired by previous
+// functions in the pipeline.
+func mergeCompositeStatus(rsp *fnv1.RunFunctionResponse, status map[string]any) error {
+	if rsp.GetDesired() == nil {
+		rsp.Desired = &fnv1.State{}
+	}
+	if rsp.GetDesired().GetComposite() == nil {
+		rsp.Desired.Composite = &fnv1.Resource{}
+	}
+
+	xr := rsp.GetDesired().GetComposite().GetResource().AsMap()
+	existing, _ := xr["status"].(map[string]any)
+	xr["status"] = mergeMaps(existing, status)
+
+	s, err := structpb.NewStruct(xr)
+	if err != nil {
+		return errors.Wrap(err, "cannot set desired composite resource status")
+	}
+	rsp.Desired.Composite.Resource = s
+	return nil
+}
+
+// mergeMaps recursively merges src into dst, returning dst.
+func mergeMaps(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for k, v := range src {
+		sm, sok := v.(map[string]any)
+		dm, dok := dst[k].(map[string]any)
+		if sok && dok {
+			dst[k] = mergeMaps(dm, sm)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
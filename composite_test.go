@@ -0,0 +1,172 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+func TestApplyComposite(t *testing.T) {
+	generated := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"status": {"endpoint": "https://example.org", "ready": true, "network": {"vpc": "vpc-1", "cidr": "10.0.0.0/16"}},
+		"connectionDetails": {"password": "secret", "username": "admin"}
+	}`)}
+
+	type args struct {
+		in      *v1alpha1.Prompt
+		desired *fnv1.Resource
+		xr      *fnv1.Resource
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *fnv1.RunFunctionResponse
+	}{
+		"NothingGenerated": {
+			reason: "The desired composite resource should be untouched if GPT didn't generate one.",
+			args: args{
+				in:      &v1alpha1.Prompt{Composite: &v1alpha1.CompositeOutput{StatusPaths: []string{"status"}}},
+				desired: &fnv1.Resource{},
+			},
+			want: &fnv1.RunFunctionResponse{Desired: &fnv1.State{Composite: &fnv1.Resource{}}},
+		},
+		"NoDesiredComposite": {
+			reason: "Allowed connection details should be written even if no previous function desired the composite resource.",
+			args: args{
+				in: &v1alpha1.Prompt{Composite: &v1alpha1.CompositeOutput{ConnectionDetails: []string{"password", "username"}}},
+				xr: &fnv1.Resource{Resource: resource.MustStructJSON(`{"connectionDetails": {"password": "secret", "username": "admin"}}`)},
+			},
+			want: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{Composite: &fnv1.Resource{
+					ConnectionDetails: map[string][]byte{
+						"password": []byte("secret"),
+						"username": []byte("admin"),
+					},
+				}},
+			},
+		},
+		"AllowList": {
+			reason: "Only allowed status fields and connection details should be written, merged with the desired composite resource.",
+			args: args{
+				in: &v1alpha1.Prompt{Composite: &v1alpha1.CompositeOutput{
+					StatusPaths:       []string{"status.endpoint", "status.network.vpc"},
+					ConnectionDetails: []string{"password"},
+				}},
+				desired: &fnv1.Resource{
+					Resource:          resource.MustStructJSON(`{"status":{"network":{"subnet":"subnet-1"}}}`),
+					ConnectionDetails: map[string][]byte{"url": []byte("https://example.org")},
+				},
+				xr: generated,
+			},
+			want: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{Composite: &fnv1.Resource{
+					Resource: resource.MustStructJSON(`{"status":{"endpoint":"https://example.org","network":{"subnet":"subnet-1","vpc":"vpc-1"}}}`),
+					ConnectionDetails: map[string][]byte{
+						"url":      []byte("https://example.org"),
+						"password": []byte("secret"),
+					},
+				}},
+				Results: []*fnv1.Result{
+					{
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  `ignoring composite resource connection detail "username" generated by GPT: the input doesn't allow GPT to write it`,
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					},
+					{
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  `ignoring composite resource field "status.network.cidr" generated by GPT: the input doesn't allow GPT to write it`,
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					},
+					{
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  `ignoring composite resource field "status.ready" generated by GPT: the input doesn't allow GPT to write it`,
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &fnv1.RunFunctionResponse{Desired: &fnv1.State{Composite: tc.args.desired}}
+			d := pipelineDetails{rsp: rsp, in: tc.args.in}
+
+			f := &Function{}
+			if err := f.applyComposite(d, tc.args.xr); err != nil {
+				t.Fatalf("\n%s\napplyComposite(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\napplyComposite(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSplitComposite(t *testing.T) {
+	generated := map[string]*fnv1.Resource{
+		"bucket":    {Resource: resource.MustStructJSON(`{"kind":"Bucket"}`)},
+		"composite": {Resource: resource.MustStructJSON(`{"kind":"Composite"}`)},
+	}
+
+	type want struct {
+		composed map[string]*fnv1.Resource
+		xr       *fnv1.Resource
+	}
+
+	cases := map[string]struct {
+		reason string
+		c      *v1alpha1.CompositeOutput
+		want   want
+	}{
+		"NotEnabled": {
+			reason: "A composed resource named composite should be kept if the input doesn't allow GPT to write the composite resource.",
+			want: want{
+				composed: generated,
+			},
+		},
+		"Enabled": {
+			reason: "The resource named composite should be split out if the input allows GPT to write the composite resource.",
+			c:      &v1alpha1.CompositeOutput{},
+			want: want{
+				composed: map[string]*fnv1.Resource{"bucket": generated["bucket"]},
+				xr:       generated["composite"],
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			composed, xr := splitComposite(tc.c, generated)
+			if diff := cmp.Diff(tc.want.composed, composed, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nsplitComposite(...): -want composed, +got composed:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.xr, xr, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nsplitComposite(...): -want xr, +got xr:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
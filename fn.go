@@ -18,16 +18,17 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"html/template"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"github.com/tmc/langchaingo/agents"
 	"github.com/tmc/langchaingo/chains"
-	openaillm "github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/tools"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
 	"sigs.k8s.io/yaml"
@@ -40,15 +41,25 @@ import (
 	"github.com/crossplane/function-sdk-go/response"
 
 	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/budget"
+	"github.com/upbound/function-openai/internal/cache"
+	"github.com/upbound/function-openai/internal/llm"
+	"github.com/upbound/function-openai/internal/metrics"
+	"github.com/upbound/function-openai/internal/prompt"
 	"github.com/upbound/function-openai/internal/tool"
 )
 
 const (
-	credName       = "gpt"
-	credKey        = "OPENAI_API_KEY"
-	credBaseURLKey = "OPENAI_BASE_URL"
-	credModelKey   = "OPENAI_MODEL"
-	defaultModel   = "gpt-4"
+	credName          = "gpt"
+	credKey           = "OPENAI_API_KEY"
+	credBaseURLKey    = "OPENAI_BASE_URL"
+	credModelKey      = "OPENAI_MODEL"
+	credProviderKey   = "LLM_PROVIDER"
+	credLLMKey        = "LLM_API_KEY"
+	credLLMBaseURLKey = "LLM_BASE_URL"
+	credLLMModelKey   = "LLM_MODEL"
+	credAPIVersionKey = "LLM_API_VERSION"
+	credDeploymentKey = "LLM_DEPLOYMENT"
 )
 
 // Variables used to form the prompt.
@@ -58,6 +69,24 @@ type Variables struct {
 
 	// Observed composed resources, as a stream of YAML manifests.
 	Composed string
+
+	// DesiredComposite resource, as a YAML manifest. Contains the desired
+	// state of the composite resource produced by previous functions in the
+	// pipeline.
+	DesiredComposite string
+
+	// DesiredComposed resources, as a stream of YAML manifests. Contains
+	// the composed resources desired by previous functions in the pipeline.
+	DesiredComposed string
+
+	// ConnectionDetails are the names of the observed composite resource's
+	// connection details. Their values aren't exposed to prompts.
+	ConnectionDetails []string
+
+	// Parameters of the input's prompt template.
+	Parameters map[string]string
+
+	PipelineVariables
 }
 
 // Function asks GPT to compose resources.
@@ -65,13 +94,74 @@ type Function struct {
 	fnv1.UnimplementedFunctionRunnerServiceServer
 	ai agentInvoker
 
-	log logging.Logger
+	log        logging.Logger
+	cache      cache.Cache
+	metrics    *metrics.Metrics
+	tracing    trace.TracerProvider
+	tracer     trace.Tracer
+	budgets    budgetLimits
+	tools      *tool.Resolver
+	mcpSecrets mcpSecrets
+	templates  prompt.Library
 }
 
 // agentInvoker is a consumer interface for working with agents. Notably this
 // is helpful for writing tests that mock the agent invocations.
 type agentInvoker interface {
-	Invoke(ctx context.Context, key, system, prompt, baseURL, modelName string) (string, error)
+	Invoke(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (string, error)
+}
+
+// invokeOptions configure a single agent invocation.
+type invokeOptions struct {
+	// schema, if set, asks the model for a structured response constrained
+	// by the schema.
+	schema *llm.Schema
+
+	// cacheMode determines how any cache is used. Responses aren't cached
+	// if unset.
+	cacheMode v1alpha1.CacheMode
+
+	// cacheTTL is how long a response is cached for.
+	cacheTTL time.Duration
+
+	// onCacheHit is called if the response is served from the cache.
+	onCacheHit func()
+
+	// pending, if set, defers caching the response until it's accepted.
+	pending *pendingCache
+
+	// labels of the metrics recorded for the invocation.
+	labels metrics.Labels
+
+	// budget identifies the budgets the invocation counts against.
+	budget budgetScope
+
+	// onUsage, if set, is called with the number of tokens the invocation
+	// used.
+	onUsage func(tokens int)
+
+	// mcpServers the agent may call tools from, keyed by name. Servers
+	// configured by environment variables are used if nil.
+	mcpServers map[string]tool.Config
+}
+
+// invokeOption modifies the invokeOptions of a single agent invocation.
+type invokeOption func(*invokeOptions)
+
+// withResponseSchema asks the model for a structured response constrained by
+// the supplied JSON Schema.
+func withResponseSchema(s *llm.Schema) invokeOption {
+	return func(o *invokeOptions) {
+		o.schema = s
+	}
+}
+
+// withMetricsLabels records metrics about the invocation with the supplied
+// labels.
+func withMetricsLabels(l metrics.Labels) invokeOption {
+	return func(o *invokeOptions) {
+		o.labels = l
+	}
 }
 
 // Option modifies the underlying Function.
@@ -84,30 +174,80 @@ func WithLogger(log logging.Logger) Option {
 	}
 }
 
+// WithCache caches GPT's responses using the supplied cache.
+func WithCache(c cache.Cache) Option {
+	return func(f *Function) {
+		f.cache = c
+	}
+}
+
+// WithMetrics records metrics about the function's use of LLMs.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(f *Function) {
+		f.metrics = m
+	}
+}
+
+// WithTracerProvider records traces of the function's runs using the supplied
+// tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(f *Function) {
+		f.tracing = tp
+	}
+}
+
+// WithPromptTemplates adds the supplied prompt templates to the function's
+// built in templates, replacing any of the same name.
+func WithPromptTemplates(l prompt.Library) Option {
+	return func(f *Function) {
+		for name, t := range l {
+			f.templates[name] = t
+		}
+	}
+}
+
 // NewFunction creates a new function powered by GPT.
 func NewFunction(opts ...Option) *Function {
 	f := &Function{
-		log: logging.NewNopLogger(),
+		log:       logging.NewNopLogger(),
+		tracing:   noop.NewTracerProvider(),
+		templates: prompt.Builtin(),
 	}
 
 	for _, o := range opts {
 		o(f)
 	}
+	f.tracer = f.tracing.Tracer(tracerName)
+	f.tools = tool.NewResolver(tool.WithLogger(f.log), tool.WithTracerProvider(f.tracing))
 
 	f.ai = &agent{
-		log: f.log,
-		res: tool.NewResolver(tool.WithLogger(f.log)),
+		log:     f.log,
+		res:     f.tools,
+		llms:    llm.NewRegistry(),
+		metrics: f.metrics,
+		tracer:  f.tracer,
+	}
+
+	// Budgets are enforced behind the cache, so that cached responses
+	// don't count against them.
+	f.ai = &budgetingInvoker{wrapped: f.ai, limiter: budget.NewLimiter(), limits: f.budgets, log: f.log}
+
+	if f.cache != nil {
+		f.ai = &cachingInvoker{wrapped: f.ai, cache: f.cache, log: f.log}
 	}
 
 	return f
 }
 
 // RunFunction runs the Function.
-func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error) {
+func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (rsp *fnv1.RunFunctionResponse, err error) {
+	ctx, span := f.startSpan(ctx, "RunFunction", trace.WithAttributes(attrTag.String(req.GetMeta().GetTag())))
+	defer func() { endSpan(span, err) }()
+
 	log := f.log.WithValues("tag", req.GetMeta().GetTag())
 	log.Info("Running function", "tag", req.GetMeta().GetTag())
 
-	rsp := response.To(req, response.DefaultTTL)
+	rsp = response.To(req, response.DefaultTTL)
 
 	if f.shouldIgnore(req) {
 		response.ConditionTrue(rsp, "FunctionSuccess", "Success").TargetCompositeAndClaim()
@@ -121,9 +261,33 @@ func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest
 		return rsp, err
 	}
 
+	// Crossplane calls the function again once it has fetched the
+	// resources the function requires, so there's no point prompting until
+	// it has. Requirements must be returned on every call.
+	rqs, err := requirementsFor(req, in)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot determine required resources"))
+		return rsp, err
+	}
+	if len(rqs) > 0 {
+		// Crossplane versions that predate required resources only
+		// understand extra resources.
+		rsp.Requirements = &fnv1.Requirements{Resources: rqs, ExtraResources: rqs}
+	}
+	if missing := unsatisfied(req, rqs); len(missing) > 0 {
+		log.Debug("Waiting for Crossplane to supply required resources", "requirements", missing)
+		response.Warning(rsp, errors.Errorf("waiting for Crossplane to supply required resources: %s", strings.Join(missing, ", ")))
+		return rsp, nil
+	}
+
+	if err := f.resolvePrompts(req, in); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot resolve prompts"))
+		return rsp, err
+	}
+
 	c, err := request.GetCredentials(req, credName)
 	if err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot get OPENAI_API_KEY from credential %q", credName))
+		response.Fatal(rsp, errors.Wrapf(err, "cannot get LLM API key from credential %q", credName))
 		return rsp, err
 	}
 	if c.Type != resource.CredentialsTypeData {
@@ -131,46 +295,82 @@ func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest
 		return rsp, err
 	}
 
-	b, ok := c.Data[credKey]
-	if !ok {
-		response.Fatal(rsp, errors.Errorf("credential %q is missing required key %q", credName, credKey))
+	cfg, err := llmConfigFrom(in, c)
+	if err != nil {
+		response.Fatal(rsp, err)
 		return rsp, err
 	}
 
-	// TODO(negz): Where the heck is the newline at the end of this key
-	// coming from? Bug in crossplane render?
-	key := strings.Trim(string(b), "\n")
-
-	// Extract optional base URL from credentials
-	var baseURL string
-	if baseURLBytes, ok := c.Data[credBaseURLKey]; ok {
-		baseURL = strings.Trim(string(baseURLBytes), "\n")
-	}
-
-	// Extract optional model from credentials, default to gpt-4
-	model := defaultModel
-	if modelBytes, ok := c.Data[credModelKey]; ok {
-		model = strings.Trim(string(modelBytes), "\n")
+	mcp, err := f.mcpServers(req, in)
+	if err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot configure MCP servers"))
+		return rsp, err
 	}
 
 	d := pipelineDetails{
-		req:     req,
-		rsp:     rsp,
-		in:      in,
-		cred:    key,
-		baseURL: baseURL,
-		model:   model,
+		req: req,
+		rsp: rsp,
+		in:  in,
+		llm: cfg,
+		mcp: mcp,
 	}
 
 	// If we're in a composition pipeline we want to do things with the
 	// composed resources.
 	if inCompositionPipeline(req) {
+		span.SetAttributes(attrPipeline.String(metrics.PipelineComposition))
 		return f.compositionPipeline(ctx, log, d)
 	}
 	// Handle operation pipeline separately.
+	span.SetAttributes(attrPipeline.String(metrics.PipelineOperation))
 	return f.operationPipeline(ctx, log, d)
 }
 
+// llmConfigFrom derives the configuration of the LLM to use from the supplied
+// input and credential. The input's provider takes precedence over the
+// credential's. The provider-neutral LLM_* credential keys take precedence
+// over their OPENAI_* equivalents.
+func llmConfigFrom(in *v1alpha1.Prompt, c resource.Credentials) (llm.Config, error) {
+	cfg := llm.Config{
+		Provider:   in.Provider,
+		APIKey:     credential(c, credLLMKey, credKey),
+		BaseURL:    credential(c, credLLMBaseURLKey, credBaseURLKey),
+		Model:      credential(c, credLLMModelKey, credModelKey),
+		APIVersion: credential(c, credAPIVersionKey),
+		Deployment: credential(c, credDeploymentKey),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = credential(c, credProviderKey)
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = llm.OpenAI
+	}
+
+	// Self-hosted providers don't need an API key.
+	if cfg.APIKey == "" && cfg.Provider != llm.Ollama {
+		key := credKey
+		if cfg.Provider != llm.OpenAI {
+			key = credLLMKey
+		}
+		return llm.Config{}, errors.Errorf("credential %q is missing required key %q", credName, key)
+	}
+
+	return cfg, nil
+}
+
+// credential returns the value of the first of the supplied keys found in the
+// supplied credential.
+func credential(c resource.Credentials, keys ...string) string {
+	for _, k := range keys {
+		if b, ok := c.Data[k]; ok {
+			// TODO(negz): Where the heck is the newline at the end of this key
+			// coming from? Bug in crossplane render?
+			return strings.Trim(string(b), "\n")
+		}
+	}
+	return ""
+}
+
 // CompositeToYAML returns the XR as YAML.
 func CompositeToYAML(xr *fnv1.Resource) (string, error) {
 	j, err := protojson.Marshal(xr.GetResource())
@@ -256,27 +456,74 @@ func removeYAMLMarkdown(in string) string {
 func (f *Function) resourceFrom(i string) (map[string]*fnv1.Resource, error) {
 	out := make(map[string]*fnv1.Resource)
 
-	b := []byte(i)
+	// GPT may return several resources when processing a batch, either as
+	// a stream of YAML documents or as a JSON array.
+	for doc := range strings.SplitSeq(i, "\n---") {
+		if strings.TrimSpace(strings.TrimPrefix(doc, "---")) == "" {
+			continue
+		}
+		b := []byte(doc)
 
-	// Is i YAML?
-	jb, err := yaml.YAMLToJSON(b)
-	if err != nil {
-		f.log.Debug("error seen while attempting to convert YAML to JSON", "error", err)
-		// i doesn't appear to be YAML, maybe it's JSON...
-		jb = b
-	}
+		// Is doc YAML?
+		jb, err := yaml.YAMLToJSON(b)
+		if err != nil {
+			f.log.Debug("error seen while attempting to convert YAML to JSON", "error", err)
+			// doc doesn't appear to be YAML, maybe it's JSON...
+			jb = b
+		}
 
-	s := &structpb.Struct{}
-	if err := protojson.Unmarshal(jb, s); err != nil {
-		return nil, errors.Wrap(err, "cannot parse JSON")
+		objs := []gjson.Result{gjson.ParseBytes(jb)}
+		if objs[0].IsArray() {
+			objs = objs[0].Array()
+		}
+		for _, obj := range objs {
+			if !obj.IsObject() {
+				return nil, errors.New("response is not a JSON or YAML object")
+			}
+
+			s := &structpb.Struct{}
+			if err := protojson.Unmarshal([]byte(obj.Raw), s); err != nil {
+				return nil, errors.Wrap(err, "cannot parse JSON")
+			}
+
+			key := resourceKey(obj)
+			if key == "" {
+				return nil, errors.New("resource must have a metadata.name")
+			}
+			if _, seen := out[key]; seen {
+				return nil, errors.Errorf("resource %q must be unique within the response", key)
+			}
+			out[key] = &fnv1.Resource{Resource: s}
+		}
 	}
 
-	name := gjson.GetBytes(jb, "metadata.name").String()
-	out[name] = &fnv1.Resource{Resource: s}
+	if len(out) == 0 {
+		return nil, errors.New("response is not a JSON or YAML object")
+	}
 
 	return out, nil
 }
 
+// resourceKey returns the key of the supplied resource in the desired
+// resources map. Namespaced resources are keyed by namespace/name so that
+// resources with the same name in different namespaces don't collide.
+func resourceKey(obj gjson.Result) string {
+	name := obj.Get("metadata.name").String()
+	if name == "" {
+		return ""
+	}
+	return objectKey(obj.Get("metadata.namespace").String(), name)
+}
+
+// objectKey returns the key of the object with the supplied namespace and name.
+// Cluster scoped objects are keyed by name alone.
+func objectKey(namespace, name string) string {
+	if namespace != "" {
+		return namespace + "/" + name
+	}
+	return name
+}
+
 // attempts to identify if the function is operating within a composition
 // pipeline or not by looking to see if a composite was sent with the request.
 func inCompositionPipeline(req *fnv1.RunFunctionRequest) bool {
@@ -291,80 +538,241 @@ type pipelineDetails struct {
 	rsp *fnv1.RunFunctionResponse
 	// marshalled input
 	in *v1alpha1.Prompt
-	// LLM API credential
-	cred string
-	// Optional base URL for OpenAI API
-	baseURL string
-	// Optional model name, defaults to gpt-4
-	model string
+	// LLM provider, credential and model
+	llm llm.Config
+	// MCP servers the agent may call tools from
+	mcp map[string]tool.Config
 }
 
 // compositionPipeline processes the given pipelineDetails with the assumption
 // that the function is defined in a composition pipeline and will be working
 // with composites and desired resources.
-func (f *Function) compositionPipeline(ctx context.Context, log logging.Logger, d pipelineDetails) (*fnv1.RunFunctionResponse, error) {
-	userPrompt, err := template.New("prompt").Parse(d.in.UserPrompt)
+func (f *Function) compositionPipeline(ctx context.Context, log logging.Logger, d pipelineDetails) (_ *fnv1.RunFunctionResponse, err error) {
+	xr := d.req.GetObserved().GetComposite().GetResource().GetFields()
+	ctx, span := f.startSpan(ctx, "compositionPipeline", trace.WithAttributes(
+		attrCompositeKind.String(xr["kind"].GetStringValue()),
+		attrCompositeName.String(xr["metadata"].GetStructValue().GetFields()["name"].GetStringValue()),
+	))
+	defer func() { endSpan(span, err) }()
+
+	if d.in.Mode == v1alpha1.PromptModePropose {
+		return f.proposeComposition(ctx, log, d)
+	}
+
+	reg, err := regenerationFor(d)
+	if err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+	if dcds, ok := reg.Reusable(); ok {
+		log.Debug("Reusing previously generated composed resources", "policy", d.in.Regenerate, "resourceCount", len(dcds))
+		if err := reg.Record(d.rsp, dcds); err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+		response.Normalf(d.rsp, "Reusing %d previously generated composed resources (regenerate policy %s)", len(dcds), d.in.Regenerate)
+		dcds, xr := splitComposite(d.in.Composite, dcds)
+		if err := f.applyComposite(d, xr); err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+		d.rsp.Desired.Resources = mergeComposed(log, d.in.Merge, d.req.GetDesired().GetResources(), dcds)
+		f.readiness(ctx, log, d)
+		return d.rsp, nil
+	}
+
+	generated, err := f.generate(ctx, log, d)
+	if errors.Is(err, budget.ErrExhausted) {
+		return f.composePrevious(ctx, log, d, err)
+	}
 	if err != nil {
-		response.Fatal(d.rsp, errors.Wrap(err, "cannot parse userPrompt"))
+		response.Fatal(d.rsp, err)
 		return d.rsp, err
 	}
 
+	composed, composite := splitComposite(d.in.Composite, generated)
+	merged := mergeComposed(log, d.in.Merge, d.req.GetDesired().GetResources(), composed)
+	if err := f.guard(d, merged); err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+
+	// Record what GPT generated, not what it was merged with. Previous
+	// functions may desire different composed resources next time.
+	if err := reg.Record(d.rsp, generated); err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+
+	if err := f.applyComposite(d, composite); err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+
+	d.rsp.Desired.Resources = merged
+	f.readiness(ctx, log, d)
+	return d.rsp, nil
+}
+
+// generate renders the prompt and asks GPT to generate valid composed
+// resources.
+func (f *Function) generate(ctx context.Context, log logging.Logger, d pipelineDetails) (map[string]*fnv1.Resource, error) {
 	// TODO(ththornton): possibly switch to just JSON to remove the double encode.
 	xr, err := CompositeToYAML(d.req.GetObserved().GetComposite())
 	if err != nil {
-		response.Fatal(d.rsp, errors.Wrap(err, "cannot convert observed XR to YAML"))
-		return d.rsp, err
+		return nil, errors.Wrap(err, "cannot convert observed XR to YAML")
 	}
 
 	cds, err := ComposedToYAML(d.req.GetObserved().GetResources())
 	if err != nil {
-		response.Fatal(d.rsp, errors.Wrap(err, "cannot convert observed composed resources to YAML"))
-		return d.rsp, err
+		return nil, errors.Wrap(err, "cannot convert observed composed resources to YAML")
 	}
 
-	pb := &strings.Builder{}
-	if err := userPrompt.Execute(pb, &Variables{Composite: xr, Composed: cds}); err != nil {
-		response.Fatal(d.rsp, errors.Wrapf(err, "cannot build prompt from template"))
-		return d.rsp, err
+	dxr, err := CompositeToYAML(d.req.GetDesired().GetComposite())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot convert desired XR to YAML")
 	}
 
-	log.Debug("Using prompt", "prompt", pb.String())
+	dcds, err := ComposedToYAML(d.req.GetDesired().GetResources())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot convert desired composed resources to YAML")
+	}
 
-	resp, err := f.ai.Invoke(ctx, d.cred, d.in.SystemPrompt, pb.String(), d.baseURL, d.model)
+	pv, err := pipelineVariables(d.req)
+	if err != nil {
+		return nil, err
+	}
 
+	vars := &Variables{
+		Composite:         xr,
+		Composed:          cds,
+		DesiredComposite:  dxr,
+		DesiredComposed:   dcds,
+		ConnectionDetails: connectionDetailNames(d.req.GetObserved().GetComposite()),
+		Parameters:        parameters(d.in),
+		PipelineVariables: pv,
+	}
+	prompt, err := renderPrompt(d, vars)
 	if err != nil {
-		response.Fatal(d.rsp, errors.Wrap(err, "failed to run chain"))
-		return d.rsp, err
+		return nil, err
+	}
+
+	log.Debug("Using prompt", "prompt", prompt)
+
+	return f.composeValid(ctx, log, d, prompt)
+}
+
+// compose asks GPT for desired composed resources using the response format
+// requested by the input. It returns GPT's raw response along with the
+// composed resources parsed from it. A *responseError is returned if the
+// response can't be parsed.
+func (f *Function) compose(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string) (string, map[string]*fnv1.Resource, error) {
+	if d.in.ResponseFormat == v1alpha1.ResponseFormatJSONSchema {
+		return f.composeStructured(ctx, log, d, prompt)
+	}
+	return f.composeYAML(ctx, log, d, prompt)
+}
+
+// composeYAML asks GPT for a stream of YAML manifests and parses them as
+// desired composed resources.
+func (f *Function) composeYAML(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string) (string, map[string]*fnv1.Resource, error) {
+	resp, err := f.invoke(ctx, log, d, prompt)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to run chain")
 	}
 
-	result := ""
 	dcds, err := ComposedFromYAML(removeYAMLMarkdown(resp))
 	if err != nil {
-		result = err.Error()
-		log.Debug("Submitted YAML stream", "result", result, "isError", true)
-		response.Fatal(d.rsp, errors.Wrap(err, "did not receive a YAML stream from GPT"))
-		return d.rsp, err
+		log.Debug("Submitted YAML stream", "result", err.Error(), "isError", true)
+		return resp, nil, &responseError{err: errors.Wrap(err, "did not receive a YAML stream from GPT")}
 	}
 
 	log.Debug("Received YAML manifests from GPT", "resourceCount", len(dcds))
-	d.rsp.Desired.Resources = dcds
-	return d.rsp, nil
+	return resp, dcds, nil
+}
+
+// composeStructured asks GPT for a structured response constrained by
+// composedSchemaFor and decodes it as desired composed resources. It falls back
+// to composeYAML if the endpoint rejects structured outputs.
+func (f *Function) composeStructured(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string) (string, map[string]*fnv1.Resource, error) {
+	resp, err := f.invoke(ctx, log, d, prompt, withResponseSchema(composedSchemaFor(d.in.Composite)))
+	if structuredOutputRejected(err) {
+		log.Info("Endpoint rejected structured output, falling back to a YAML stream", "error", err)
+		return f.composeYAML(ctx, log, d, prompt)
+	}
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to run chain")
+	}
+
+	dcds, err := ComposedFromJSON(resp)
+	if err != nil {
+		// Some OpenAI compatible endpoints silently ignore the requested
+		// response format, so the response might still be a YAML stream.
+		log.Debug("Cannot decode structured response, trying a YAML stream", "error", err)
+		ydcds, yerr := ComposedFromYAML(removeYAMLMarkdown(resp))
+		if yerr != nil {
+			return resp, nil, &responseError{err: errors.Wrap(err, "did not receive a structured response from GPT")}
+		}
+		dcds = ydcds
+	}
+
+	log.Debug("Received structured response from GPT", "resourceCount", len(dcds))
+	return resp, dcds, nil
+}
+
+// invoke asks GPT to respond to the supplied prompt using the input's system
+// prompt and cache policy. A Normal result is returned if the response is
+// served from the cache. If the context has a pendingCache the response is
+// only cached once the pendingCache is accepted.
+func (f *Function) invoke(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string, opts ...invokeOption) (string, error) {
+	opts = append(opts,
+		withCachePolicy(d.in.CachePolicy),
+		withCacheHit(func() {
+			log.Debug("Using cached GPT response")
+			response.Normal(d.rsp, "Using cached GPT response")
+		}),
+		withPendingCache(pendingCacheFrom(ctx)),
+		withMetricsLabels(metricsLabels(d)),
+		withBudgetScope(budgetScopeFor(d)),
+		withMCPServers(d.mcp),
+	)
+	return f.ai.Invoke(ctx, d.llm, d.in.SystemPrompt, prompt, opts...)
+}
+
+// metricsLabels returns the labels of metrics recorded for the supplied
+// pipeline.
+func metricsLabels(d pipelineDetails) metrics.Labels {
+	l := metrics.Labels{Model: llm.ModelName(d.llm), Pipeline: metrics.PipelineOperation}
+	if inCompositionPipeline(d.req) {
+		l.Pipeline = metrics.PipelineComposition
+		l.CompositeKind = d.req.GetObserved().GetComposite().GetResource().GetFields()["kind"].GetStringValue()
+	}
+	return l
 }
 
 // OperationVariables used to form the prompt.
 type OperationVariables struct {
-	Input     string `json:"input"`
+	Input string `json:"input"`
+
+	// Resources being processed, as JSON. A single resource is a JSON
+	// object. A batch of several resources is a JSON array.
 	Resources string `json:"resources"`
+
+	Parameters map[string]string `json:"parameters"`
+
+	// DesiredResources, as a stream of YAML manifests. Contains the
+	// resources desired by previous functions in the pipeline.
+	DesiredResources string `json:"desiredResources"`
+
+	PipelineVariables
 }
 
 // operationPipeline processes the given pipelineDetails with the assumption
 // that the function is defined in an operations pipeline.
-func (f *Function) operationPipeline(ctx context.Context, log logging.Logger, d pipelineDetails) (*fnv1.RunFunctionResponse, error) {
-	prompt, err := template.New("prompt").Parse(d.in.UserPrompt)
-	if err != nil {
-		response.Fatal(d.rsp, errors.New("failed to parse UserPrompt as a go-template"))
-		return d.rsp, err
-	}
+func (f *Function) operationPipeline(ctx context.Context, log logging.Logger, d pipelineDetails) (_ *fnv1.RunFunctionResponse, err error) {
+	ctx, span := f.startSpan(ctx, "operationPipeline")
+	defer func() { endSpan(span, err) }()
+
 	rr, err := request.GetRequiredResources(d.req)
 	if err != nil {
 		response.Fatal(d.rsp, errors.Wrapf(err, "cannot get Function extra resources from %T", d.req))
@@ -374,46 +782,80 @@ func (f *Function) operationPipeline(ctx context.Context, log logging.Logger, d
 	// TODO(tnthornton) reference const from c/c instead. Currently too many
 	// conflicting dependencies are pulled in when updating c/c in this repo.
 	rs, ok := rr["ops.crossplane.io/watched-resource"]
-	if !ok {
+	if !ok || len(rs) == 0 {
 		f.log.Debug("no resource to process")
+		span.SetAttributes(attrResources.Int(0))
 		response.ConditionTrue(d.rsp, "FunctionSuccess", "Success").TargetCompositeAndClaim()
 		return d.rsp, nil
 	}
 
-	if len(rs) != 1 {
-		response.Fatal(d.rsp, errors.New("too many resources sent to the function. expected 1"))
+	span.SetAttributes(attrResources.Int(len(rs)))
+
+	dr, err := ComposedToYAML(d.req.GetDesired().GetResources())
+	if err != nil {
+		response.Fatal(d.rsp, errors.Wrap(err, "cannot convert desired resources to YAML"))
 		return d.rsp, err
 	}
 
-	rb, err := json.MarshalIndent(rs[0].Resource.UnstructuredContent(), "", "    ")
+	pv, err := pipelineVariables(d.req)
 	if err != nil {
-		response.Fatal(d.rsp, errors.New("failed to unmarshal required resource"))
+		response.Fatal(d.rsp, err)
 		return d.rsp, err
 	}
 
-	vars := &strings.Builder{}
-	if err := prompt.Execute(vars, &OperationVariables{Input: d.in.UserPrompt, Resources: string(rb)}); err != nil {
-		response.Fatal(d.rsp, errors.Wrapf(err, "cannot build prompt from template"))
+	vars := OperationVariables{
+		Input:             d.in.UserPrompt,
+		Parameters:        parameters(d.in),
+		DesiredResources:  dr,
+		PipelineVariables: pv,
+	}
+
+	// Each batch of watched resources is processed by its own prompt. Each
+	// records its results in its own response so they can run concurrently.
+	batches := batchesFor(d.in.Operation, rs)
+	results := make([]*operationResult, len(batches))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrency(d.in.Operation))
+	for i, batch := range batches {
+		g.Go(func() error {
+			r, err := f.operate(gctx, log, d, vars, batch)
+			results[i] = r
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		response.Fatal(d.rsp, err)
 		return d.rsp, err
 	}
 
-	log.Debug("Using prompt", "prompt", vars.String())
-
-	resp, err := f.ai.Invoke(ctx, d.cred, d.in.SystemPrompt, vars.String(), d.baseURL, d.model)
-
-	if err != nil {
-		response.Fatal(d.rsp, errors.Wrap(err, "failed to run chain"))
-		return d.rsp, err
+	var desired map[string]*fnv1.Resource
+	var proposals []any
+	for _, r := range results {
+		d.rsp.Results = append(d.rsp.Results, r.rsp.GetResults()...)
+		if r.proposal != nil {
+			proposals = append(proposals, r.proposal)
+		}
+		for name, dr := range r.desired {
+			if desired == nil {
+				desired = make(map[string]*fnv1.Resource)
+			}
+			if _, seen := desired[name]; seen {
+				err := errors.Errorf("resource %q was returned by more than one prompt", name)
+				response.Fatal(d.rsp, err)
+				return d.rsp, err
+			}
+			desired[name] = dr
+		}
 	}
 
-	desired, err := f.resourceFrom(resp)
-	if err != nil {
-		// we didn't get a JSON based response from GPT
-		log.Debug("failed to get a JSON response back, no desired resources will be sent back to crossplane")
+	if len(proposals) > 0 {
+		if err := setProposalsContext(d.rsp, proposals); err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
 	}
 
 	response.ConditionTrue(d.rsp, "FunctionSuccess", "Success").TargetCompositeAndClaim()
-	response.Normal(d.rsp, resp)
 
 	d.rsp.Desired.Resources = desired
 	return d.rsp, nil
@@ -434,45 +876,63 @@ func (f *Function) shouldIgnore(req *fnv1.RunFunctionRequest) bool {
 }
 
 type agent struct {
-	log logging.Logger
-	res *tool.Resolver
+	log     logging.Logger
+	res     *tool.Resolver
+	llms    *llm.Registry
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
 }
 
 // Invoke makes an external call to the configured LLM with the supplied
-// credential key, system and user prompts.
-func (a *agent) Invoke(ctx context.Context, key, system, prompt, baseURL, modelName string) (string, error) {
-	opts := []openaillm.Option{
-		openaillm.WithToken(key),
-		openaillm.WithModel(modelName),
+// system and user prompts.
+func (a *agent) Invoke(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (out string, err error) {
+	io := &invokeOptions{}
+	for _, o := range opts {
+		o(io)
 	}
+	cfg.Schema = io.schema
 
-	// Add custom base URL if provided
-	if baseURL != "" {
-		opts = append(opts, openaillm.WithBaseURL(baseURL))
-	}
+	ctx, span := a.tracer.Start(ctx, "agent.Invoke", trace.WithAttributes(
+		attrProvider.String(cfg.Provider),
+		attrModel.String(llm.ModelName(cfg)),
+	))
+	defer func() { endSpan(span, err) }()
 
-	model, err := openaillm.New(opts...)
+	model, err := a.llms.Model(cfg)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to build model")
 	}
 
+	inv := a.metrics.Invocation(io.labels)
+	defer inv.Done()
+
+	traced := &tracedModel{Model: model, tracer: a.tracer, cfg: cfg}
+	defer func() {
+		span.SetAttributes(traced.attributes()...)
+		if io.onUsage != nil {
+			io.onUsage(traced.prompt + traced.completion)
+		}
+	}()
+
 	agent := agents.NewOpenAIFunctionsAgent(
-		model,
-		a.tools(ctx),
+		inv.Model(traced),
+		a.tools(ctx, io.mcpServers),
 		agents.WithMaxIterations(20),
 		agents.NewOpenAIOption().WithSystemMessage(system),
 	)
 
 	return chains.Run(
 		ctx,
-		agents.NewExecutor(agent),
+		agents.NewExecutor(agent, agents.WithCallbacksHandler(inv.Handler())),
 		prompt,
 		chains.WithTemperature(float64(0)),
 	)
 }
 
-func (a *agent) tools(ctx context.Context) []tools.Tool {
-	cfgs := a.res.FromEnvVars()
+func (a *agent) tools(ctx context.Context, cfgs map[string]tool.Config) []tools.Tool {
+	if cfgs == nil {
+		cfgs = a.res.FromEnvVars()
+	}
 	if len(cfgs) == 0 {
 		a.log.Debug("no valid mcp server configurations found")
 	}
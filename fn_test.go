@@ -18,24 +18,29 @@ package main
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/tidwall/gjson"
 	"google.golang.org/protobuf/testing/protocmp"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	"github.com/crossplane/function-sdk-go/resource"
 	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/llm"
 )
 
 func TestRunFunction(t *testing.T) {
 
 	type args struct {
-		ctx context.Context
 		req *fnv1.RunFunctionRequest
 		ai  agentInvoker
 	}
@@ -105,7 +110,7 @@ func TestRunFunction(t *testing.T) {
 					Results: []*fnv1.Result{
 						{
 							Severity: fnv1.Severity_SEVERITY_FATAL,
-							Message:  `cannot get OPENAI_API_KEY from credential "gpt": gpt: credential not found`,
+							Message:  `cannot get LLM API key from credential "gpt": gpt: credential not found`,
 							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 						},
 					},
@@ -117,7 +122,7 @@ func TestRunFunction(t *testing.T) {
 			reason: "We should go through the composition pipeline without error.",
 			args: args{
 				ai: &mockAgentInvoker{
-					InvokeFn: func(_ context.Context, _, _, _, _, _ string) (string, error) {
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
 						return `---
 apiVersion: some.group/v1
 metadata:
@@ -196,12 +201,15 @@ metadata:
 				},
 			},
 		},
-		"SimpleOperationPipeline": {
-			reason: "We should go through the operation pipeline without error.",
+		"StructuredCompositionPipeline": {
+			reason: "We should decode a structured response when one is requested.",
 			args: args{
 				ai: &mockAgentInvoker{
-					InvokeFn: func(_ context.Context, _, _, _, _, _ string) (string, error) {
-						return `some-response`, nil
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, opts ...invokeOption) (string, error) {
+						if !structured(opts...) {
+							return "", errors.New("expected a structured response to be requested")
+						}
+						return `{"resources":[{"name":"some-name","resource":"{\"apiVersion\":\"some.group/v1\",\"kind\":\"Some\"}"}]}`, nil
 					},
 				},
 				req: &fnv1.RunFunctionRequest{
@@ -210,80 +218,1196 @@ metadata:
 						"apiVersion": "openai.fn.upbound.io/v1alpha1",
 						"kind": "Prompt",
 						"systemPrompt": "I'm a system",
-						"userPrompt": "I'm a user"
+						"userPrompt": "I'm a user",
+						"responseFormat": "JSONSchema"
 					}`),
 					Credentials: mockCredentials(),
-					RequiredResources: map[string]*fnv1.Resources{
-						"ops.crossplane.io/watched-resource": {
-							Items: []*fnv1.Resource{
-								{
-									Resource: &structpb.Struct{},
-								},
-							},
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"some-name": {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Some"}`)},
+						},
+					},
+				},
+			},
+		},
+		"MergeByNameCompositionPipeline": {
+			reason: "We should expose desired composed resources to the prompt, and keep those GPT doesn't replace.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, "upbound.io/name: upstream") {
+							return "", errors.Errorf("expected prompt to contain desired composed resources, got %q", prompt)
+						}
+						return "apiVersion: some.group/v1\nkind: Generated\nmetadata:\n  annotations:\n    upbound.io/name: generated\n", nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .DesiredComposed }}",
+						"merge": "MergeByName"
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"upstream": {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Upstream"}`)},
 						},
 					},
-					Desired: &fnv1.State{},
 				},
 			},
 			want: want{
 				rsp: &fnv1.RunFunctionResponse{
-					Meta: &fnv1.ResponseMeta{
-						Tag: "hello",
-						Ttl: &durationpb.Duration{
-							Seconds: 60,
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"upstream":  {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Upstream"}`)},
+							"generated": {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Generated","metadata":{"annotations":{"upbound.io/name":"generated"}}}`)},
 						},
 					},
+				},
+			},
+		},
+		"RequiredResourcesRequested": {
+			reason: "We should ask Crossplane for required resources, without prompting, until it supplies them.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return "", errors.New("GPT shouldn't be prompted before required resources are supplied")
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ index .RequiredResources \"config\" }}",
+						"requiredResources": [{
+							"name": "config",
+							"apiVersion": "aws.upbound.io/v1beta1",
+							"kind": "ProviderConfig",
+							"matchNameFromCompositeFieldPath": "spec.providerConfigRef.name"
+						}]
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{"spec":{"providerConfigRef":{"name":"default"}}}`)},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
 					Results: []*fnv1.Result{{
-						Severity: fnv1.Severity_SEVERITY_NORMAL,
-						Message:  "some-response",
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  "waiting for Crossplane to supply required resources: config",
 						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
 					}},
-					Conditions: []*fnv1.Condition{{
-						Type:   "FunctionSuccess",
-						Status: fnv1.Status_STATUS_CONDITION_TRUE,
-						Reason: "Success",
-						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
-					}},
+					Requirements: &fnv1.Requirements{
+						Resources: map[string]*fnv1.ResourceSelector{
+							"config": {
+								ApiVersion: "aws.upbound.io/v1beta1",
+								Kind:       "ProviderConfig",
+								Match:      &fnv1.ResourceSelector_MatchName{MatchName: "default"},
+							},
+						},
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							"config": {
+								ApiVersion: "aws.upbound.io/v1beta1",
+								Kind:       "ProviderConfig",
+								Match:      &fnv1.ResourceSelector_MatchName{MatchName: "default"},
+							},
+						},
+					},
+				},
+			},
+		},
+		"RequiredResourcesSupplied": {
+			reason: "We should expose required resources to the prompt once Crossplane supplies them.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, "kind: ProviderConfig") {
+							return "", errors.Errorf("expected prompt to contain required resources, got %q", prompt)
+						}
+						return "", nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ index .RequiredResources \"config\" }}",
+						"requiredResources": [{
+							"name": "config",
+							"apiVersion": "aws.upbound.io/v1beta1",
+							"kind": "ProviderConfig",
+							"matchName": "default"
+						}]
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
 					Desired: &fnv1.State{},
+					RequiredResources: map[string]*fnv1.Resources{
+						"config": {Items: []*fnv1.Resource{
+							{Resource: resource.MustStructJSON(`{"apiVersion":"aws.upbound.io/v1beta1","kind":"ProviderConfig","metadata":{"name":"default"}}`)},
+						}},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{},
+					},
+					Requirements: &fnv1.Requirements{
+						Resources: map[string]*fnv1.ResourceSelector{
+							"config": {
+								ApiVersion: "aws.upbound.io/v1beta1",
+								Kind:       "ProviderConfig",
+								Match:      &fnv1.ResourceSelector_MatchName{MatchName: "default"},
+							},
+						},
+						ExtraResources: map[string]*fnv1.ResourceSelector{
+							"config": {
+								ApiVersion: "aws.upbound.io/v1beta1",
+								Kind:       "ProviderConfig",
+								Match:      &fnv1.ResourceSelector_MatchName{MatchName: "default"},
+							},
+						},
+					},
 				},
 			},
 		},
-	}
-
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			f := &Function{log: logging.NewNopLogger(), ai: tc.args.ai}
-			rsp, err := f.RunFunction(tc.args.ctx, tc.args.req)
-
-			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
-				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
-			}
-
-			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
-				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
-			}
-		})
-	}
-}
-
-func mockCredentials() map[string]*fnv1.Credentials {
-	return map[string]*fnv1.Credentials{
-		"gpt": {
-			Source: &fnv1.Credentials_CredentialData{
-				CredentialData: &fnv1.CredentialData{
-					Data: map[string][]byte{
-						"OPENAI_API_KEY": []byte("data"),
+		"StructuredOutputRejected": {
+			reason: "We should fall back to a YAML stream when the endpoint rejects structured outputs.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, opts ...invokeOption) (string, error) {
+						if structured(opts...) {
+							return "", errors.New("API returned unexpected status code: 400: Invalid parameter: 'response_format' of type 'json_schema' is not supported with this model.")
+						}
+						return "```yaml\napiVersion: some.group/v1\nkind: Some\nmetadata:\n  annotations:\n    upbound.io/name: some-name\n```", nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"responseFormat": "JSONSchema"
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"some-name": {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Some","metadata":{"annotations":{"upbound.io/name":"some-name"}}}`)},
+						},
 					},
 				},
 			},
 		},
-	}
-}
-
-type mockAgentInvoker struct {
-	InvokeFn func(ctx context.Context, key, system, prompt, baseURL, modelName string) (string, error)
-}
-
-func (m *mockAgentInvoker) Invoke(ctx context.Context, key, system, prompt, baseURL, modelName string) (string, error) {
-	return m.InvokeFn(ctx, key, system, prompt, baseURL, modelName)
+		"InvalidComposedResourceRepaired": {
+			reason: "We should ask GPT to repair invalid composed resources.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, `composed resource "deployment" is invalid: spec.replicaz: Forbidden: unknown field`) {
+							return invalidDeployment, nil
+						}
+						return validDeployment, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"validation": {},
+						"repairAttempts": 1
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"deployment": {Resource: resource.MustStructJSON(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"upbound.io/name":"deployment"}},"spec":{"replicas":3}}`)},
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `GPT response has 1 problems, asking it to repair them (attempt 1 of 1): composed resource "deployment" is invalid: spec.replicaz: Forbidden: unknown field`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "GPT repaired its response after 1 attempts",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+			},
+		},
+		"UnparseableResponseRepaired": {
+			reason: "We should ask GPT to repair a response that isn't a YAML stream.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, "<previous>\nSure: here are your manifests.\n</previous>") {
+							return "Sure: here are your manifests.", nil
+						}
+						return validDeployment, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"repairAttempts": 2
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"deployment": {Resource: resource.MustStructJSON(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"upbound.io/name":"deployment"}},"spec":{"replicas":3}}`)},
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "GPT response has 1 problems, asking it to repair them (attempt 1 of 2): did not receive a YAML stream from GPT: missing 'upbound.io/name' annotation",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "GPT repaired its response after 1 attempts",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+			},
+		},
+		"UnparseableResponseNotRepaired": {
+			reason: "We should return a Fatal result if GPT can't repair its response.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return "Sure: here are your manifests.", nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"repairAttempts": 1
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "GPT response has 1 problems, asking it to repair them (attempt 1 of 1): did not receive a YAML stream from GPT: missing 'upbound.io/name' annotation",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "did not receive a YAML stream from GPT: missing 'upbound.io/name' annotation",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+				err: cmpopts.AnyError,
+			},
+		},
+		"InvalidComposedResourceWarn": {
+			reason: "We should return invalid composed resources with a Warning result when the validation policy is Warn.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return invalidDeployment, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"validation": {"policy": "Warn"}
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+						Resources: map[string]*fnv1.Resource{
+							"deployment": {Resource: resource.MustStructJSON(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"upbound.io/name":"deployment"}},"spec":{"replicaz":3}}`)},
+						},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `composed resource "deployment" is invalid: spec.replicaz: Forbidden: unknown field`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+			},
+		},
+		"InvalidComposedResourceFatal": {
+			reason: "We should return a Fatal result for invalid composed resources by default.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return invalidDeployment, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"validation": {}
+					}`),
+					Credentials: mockCredentials(),
+					Observed: &fnv1.State{
+						Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{}`)},
+					},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Desired: &fnv1.State{
+						Composite: &fnv1.Resource{},
+					},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  `composed resource "deployment" is invalid: spec.replicaz: Forbidden: unknown field`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  "GPT generated 1 invalid composed resources",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+				},
+				err: cmpopts.AnyError,
+			},
+		},
+		"SimpleOperationPipeline": {
+			reason: "We should go through the operation pipeline without error.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return `some-response`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user"
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{
+									Resource: &structpb.Struct{},
+								},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{
+						Tag: "hello",
+						Ttl: &durationpb.Duration{
+							Seconds: 60,
+						},
+					},
+					Results: []*fnv1.Result{{
+						Severity: fnv1.Severity_SEVERITY_NORMAL,
+						Message:  "some-response",
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					}},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{},
+				},
+			},
+		},
+		"BatchOperationPipeline": {
+			reason: "We should process all watched resources in one prompt, returning every resource GPT generates.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, `"name": "a"`) || !strings.Contains(prompt, `"name": "b"`) {
+							return "", errors.Errorf("expected prompt to contain both watched resources, got %q", prompt)
+						}
+						return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n", nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .Resources }}"
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`)},
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`)},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{{
+						Severity: fnv1.Severity_SEVERITY_NORMAL,
+						Message:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n",
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					}},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{
+							"a": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`)},
+							"b": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`)},
+						},
+					},
+				},
+			},
+		},
+		"FanOutOperationPipeline": {
+			reason: "We should prompt once for each watched resource, returning results in the order of the watched resources.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						name := gjson.Get(prompt, "metadata.name").String()
+						return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + name + `"},"data":{"fixed":"true"}}`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .Resources }}",
+						"operation": {"mode": "FanOut", "maxConcurrency": 2}
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`)},
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`)},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"},"data":{"fixed":"true"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"},"data":{"fixed":"true"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{
+							"a": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"},"data":{"fixed":"true"}}`)},
+							"b": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"},"data":{"fixed":"true"}}`)},
+						},
+					},
+				},
+			},
+		},
+		"NoWatchedResourcesOperationPipeline": {
+			reason: "We should succeed without prompting when the watched resource requirement has no items.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return "", errors.New("we should not prompt when there are no watched resources")
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user"
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{},
+				},
+			},
+		},
+		"FanOutSameNameOperationPipeline": {
+			reason: "We should key namespaced resources by namespace and name, so resources with the same name don't overwrite each other.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						ns := gjson.Get(prompt, "metadata.namespace").String()
+						return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"` + ns + `"}}`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .Resources }}",
+						"operation": {"mode": "FanOut"}
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"x"}}`)},
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"y"}}`)},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"x"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"y"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{
+							"x/a": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"x"}}`)},
+							"y/a": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"y"}}`)},
+						},
+					},
+				},
+			},
+		},
+		"DuplicateOperationResponse": {
+			reason: "We should return a fatal result if two prompts return the same resource.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .Resources }}",
+						"operation": {"mode": "FanOut"}
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`)},
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"b"}}`)},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_FATAL,
+							Message:  `resource "a" was returned by more than one prompt`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+				err: cmpopts.AnyError,
+			},
+		},
+		"OperationResponseRepaired": {
+			reason: "We should ask GPT to repair an operation response that isn't a resource.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, "response is not a JSON or YAML object") {
+							return "some-response", nil
+						}
+						return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm"}}`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "I'm a user",
+						"repairAttempts": 1
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{{Resource: &structpb.Struct{}}},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_WARNING,
+							Message:  "GPT response has 1 problems, asking it to repair them (attempt 1 of 1): response is not a JSON or YAML object",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "GPT repaired its response after 1 attempts",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm"}}`,
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{
+							"cm": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm"}}`)},
+						},
+					},
+				},
+			},
+		},
+		"ActionsOperationPipeline": {
+			reason: "We should return the desired resources that apply GPT's actions, and a result explaining each action.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+						if !strings.Contains(prompt, operationActionsInstructions) {
+							return "", errors.Errorf("expected prompt to contain action instructions, got %q", prompt)
+						}
+						return `{"actions":[
+							{"type":"Labels","target":{"apiVersion":"v1","kind":"ConfigMap","namespace":"default","name":"a"},"entries":[{"key":"fixed","value":"true"}],"patch":"","status":"","explanation":"It was fixed."},
+							{"type":"Patch","target":{"apiVersion":"v1","kind":"ConfigMap","namespace":"default","name":"a"},"entries":[],"patch":"{\"data\":{\"replicas\":\"3\"}}","status":"","explanation":"It needs more replicas."}
+						]}`, nil
+					},
+				},
+				req: &fnv1.RunFunctionRequest{
+					Meta: &fnv1.RequestMeta{Tag: "hello"},
+					Input: resource.MustStructJSON(`{
+						"apiVersion": "openai.fn.upbound.io/v1alpha1",
+						"kind": "Prompt",
+						"systemPrompt": "I'm a system",
+						"userPrompt": "{{ .Resources }}",
+						"operation": {"output": "Actions"}
+					}`),
+					Credentials: mockCredentials(),
+					RequiredResources: map[string]*fnv1.Resources{
+						"ops.crossplane.io/watched-resource": {
+							Items: []*fnv1.Resource{
+								{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"default"}}`)},
+							},
+						},
+					},
+					Desired: &fnv1.State{},
+				},
+			},
+			want: want{
+				rsp: &fnv1.RunFunctionResponse{
+					Meta: &fnv1.ResponseMeta{Tag: "hello", Ttl: durationpb.New(response.DefaultTTL)},
+					Results: []*fnv1.Result{
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "Labels ConfigMap default/a: It was fixed.",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+						{
+							Severity: fnv1.Severity_SEVERITY_NORMAL,
+							Message:  "Patch ConfigMap default/a: It needs more replicas.",
+							Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+						},
+					},
+					Conditions: []*fnv1.Condition{{
+						Type:   "FunctionSuccess",
+						Status: fnv1.Status_STATUS_CONDITION_TRUE,
+						Reason: "Success",
+						Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+					}},
+					Desired: &fnv1.State{
+						Resources: map[string]*fnv1.Resource{
+							"default/a": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a","namespace":"default","labels":{"fixed":"true"}},"data":{"replicas":"3"}}`)},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), ai: tc.args.ai}
+			rsp, err := f.RunFunction(t.Context(), tc.args.req)
+
+			if diff := cmp.Diff(tc.want.rsp, rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want rsp, +got rsp:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+const invalidDeployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    upbound.io/name: deployment
+spec:
+  replicaz: 3
+`
+
+const validDeployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    upbound.io/name: deployment
+spec:
+  replicas: 3
+`
+
+func mockCredentials() map[string]*fnv1.Credentials {
+	return map[string]*fnv1.Credentials{
+		"gpt": {
+			Source: &fnv1.Credentials_CredentialData{
+				CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{
+						"OPENAI_API_KEY": []byte("data"),
+					},
+				},
+			},
+		},
+	}
+}
+
+type mockAgentInvoker struct {
+	InvokeFn func(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (string, error)
+}
+
+func (m *mockAgentInvoker) Invoke(ctx context.Context, cfg llm.Config, system, prompt string, opts ...invokeOption) (string, error) {
+	return m.InvokeFn(ctx, cfg, system, prompt, opts...)
+}
+
+// structured returns true if the supplied options ask for a structured
+// response.
+func structured(opts ...invokeOption) bool {
+	io := &invokeOptions{}
+	for _, o := range opts {
+		o(io)
+	}
+	return io.schema != nil
+}
+
+func TestComposedFromJSON(t *testing.T) {
+	type want struct {
+		cds map[string]*fnv1.Resource
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     string
+		want   want
+	}{
+		"EncodedManifest": {
+			reason: "We should decode resources returned as JSON encoded manifests.",
+			in:     `{"resources":[{"name":"a","resource":"{\"kind\":\"A\"}"}]}`,
+			want: want{
+				cds: map[string]*fnv1.Resource{
+					"a": {Resource: resource.MustStructJSON(`{"kind":"A"}`)},
+				},
+			},
+		},
+		"ObjectManifest": {
+			reason: "We should tolerate resources returned as JSON objects.",
+			in:     "```json\n{\"resources\":[{\"name\":\"a\",\"resource\":{\"kind\":\"A\"}}]}\n```",
+			want: want{
+				cds: map[string]*fnv1.Resource{
+					"a": {Resource: resource.MustStructJSON(`{"kind":"A"}`)},
+				},
+			},
+		},
+		"Composite": {
+			reason: "We should return the composite section as a resource named composite.",
+			in:     `{"resources":[],"composite":{"status":"{\"endpoint\":\"https://example.org\"}","connectionDetails":[{"name":"password","value":"secret"}]}}`,
+			want: want{
+				cds: map[string]*fnv1.Resource{
+					"composite": {Resource: resource.MustStructJSON(`{"status":{"endpoint":"https://example.org"},"connectionDetails":{"password":"secret"}}`)},
+				},
+			},
+		},
+		"EmptyComposite": {
+			reason: "We should ignore an empty composite section.",
+			in:     `{"resources":[],"composite":{"status":"","connectionDetails":[]}}`,
+			want: want{
+				cds: map[string]*fnv1.Resource{},
+			},
+		},
+		"DuplicateName": {
+			reason: "Resource names must be unique.",
+			in:     `{"resources":[{"name":"a","resource":"{}"},{"name":"a","resource":"{}"}]}`,
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"MissingName": {
+			reason: "Every resource must have a name.",
+			in:     `{"resources":[{"resource":"{}"}]}`,
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"NotJSON": {
+			reason: "We should return an error if the response isn't JSON.",
+			in:     "apiVersion: v1\nkind: A",
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cds, err := ComposedFromJSON(tc.in)
+
+			if diff := cmp.Diff(tc.want.cds, cds, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nComposedFromJSON(...): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nComposedFromJSON(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStructuredOutputRejected(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   bool
+	}{
+		"NoError": {
+			reason: "No error isn't a rejection.",
+		},
+		"Unsupported": {
+			reason: "A provider that doesn't support structured output rejects it.",
+			err:    errors.Wrap(llm.ErrStructuredOutputUnsupported, "cannot build anthropic model"),
+			want:   true,
+		},
+		"BadRequest": {
+			reason: "An endpoint that rejects the response format with a 400 rejects structured output.",
+			err:    errors.New("API returned unexpected status code: 400: Invalid parameter: 'response_format' of type 'json_schema' is not supported with this model."),
+			want:   true,
+		},
+		"OtherStatus": {
+			reason: "Other errors that mention the response format don't reject structured output.",
+			err:    errors.New("API returned unexpected status code: 500: cannot process response_format"),
+		},
+		"Other": {
+			reason: "Other errors don't reject structured output.",
+			err:    errors.New("structured output is great"),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := structuredOutputRejected(tc.err); got != tc.want {
+				t.Errorf("%s\nstructuredOutputRejected(...): want %t, got %t", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLLMConfigFrom(t *testing.T) {
+	type args struct {
+		in *v1alpha1.Prompt
+		c  resource.Credentials
+	}
+	type want struct {
+		cfg llm.Config
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"OpenAI": {
+			reason: "OpenAI should be used by default, configured by the OPENAI_* keys.",
+			args: args{
+				in: &v1alpha1.Prompt{},
+				c: resource.Credentials{Data: map[string][]byte{
+					"OPENAI_API_KEY":  []byte("key\n"),
+					"OPENAI_BASE_URL": []byte("http://localhost:11434/v1"),
+					"OPENAI_MODEL":    []byte("gpt-oss:20b"),
+				}},
+			},
+			want: want{
+				cfg: llm.Config{Provider: llm.OpenAI, APIKey: "key", BaseURL: "http://localhost:11434/v1", Model: "gpt-oss:20b"},
+			},
+		},
+		"CredentialProvider": {
+			reason: "The LLM_* keys should take precedence over the OPENAI_* keys.",
+			args: args{
+				in: &v1alpha1.Prompt{},
+				c: resource.Credentials{Data: map[string][]byte{
+					"LLM_PROVIDER":    []byte("azure-openai"),
+					"LLM_API_KEY":     []byte("key"),
+					"OPENAI_API_KEY":  []byte("other"),
+					"LLM_BASE_URL":    []byte("https://example.openai.azure.com"),
+					"LLM_API_VERSION": []byte("2024-10-21"),
+					"LLM_DEPLOYMENT":  []byte("my-gpt"),
+				}},
+			},
+			want: want{
+				cfg: llm.Config{Provider: llm.AzureOpenAI, APIKey: "key", BaseURL: "https://example.openai.azure.com", APIVersion: "2024-10-21", Deployment: "my-gpt"},
+			},
+		},
+		"InputProvider": {
+			reason: "The input's provider should take precedence over the credential's.",
+			args: args{
+				in: &v1alpha1.Prompt{Provider: llm.Ollama},
+				c: resource.Credentials{Data: map[string][]byte{
+					"LLM_PROVIDER": []byte("anthropic"),
+				}},
+			},
+			want: want{
+				cfg: llm.Config{Provider: llm.Ollama},
+			},
+		},
+		"MissingAPIKey": {
+			reason: "Providers other than Ollama require an API key.",
+			args: args{
+				in: &v1alpha1.Prompt{Provider: llm.Anthropic},
+				c:  resource.Credentials{Data: map[string][]byte{}},
+			},
+			want: want{
+				cfg: llm.Config{},
+				err: cmpopts.AnyError,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := llmConfigFrom(tc.args.in, tc.args.c)
+
+			if diff := cmp.Diff(tc.want.cfg, cfg); diff != "" {
+				t.Errorf("%s\nllmConfigFrom(...): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nllmConfigFrom(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
 }
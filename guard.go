@@ -0,0 +1,186 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+// alwaysImmutable are paths GPT may never change on existing composed
+// resources, regardless of the guard.
+var alwaysImmutable = []string{"apiVersion", "kind", "metadata.name"}
+
+// ignoredPaths are never considered changes. GPT annotates the resources it
+// generates with their names, and status is never applied.
+var ignoredPaths = []string{"status", "metadata.annotations.upbound.io/name"}
+
+// guard checks the supplied generated composed resources against the input's
+// guard. A Warning result is returned for each violation, and an error if the
+// guard policy is Fatal.
+func (f *Function) guard(d pipelineDetails, dcds map[string]*fnv1.Resource) error {
+	if d.in.Guard == nil {
+		return nil
+	}
+
+	violations := guardComposed(d.in.Guard, d.req, dcds)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	for _, msg := range violations {
+		response.Warning(d.rsp, errors.New(msg))
+	}
+	if d.in.Guard.Policy == v1alpha1.GuardPolicyWarn {
+		return nil
+	}
+	return errors.Errorf("GPT's response violates the guard %d times", len(violations))
+}
+
+// guardComposed compares the supplied generated composed resources with the
+// existing composed resources, returning a sorted message describing each
+// violation of the supplied guard. A composed resource desired by a previous
+// function takes precedence over its observed state. Fields GPT omits from an
+// observed resource aren't considered changed, because omitting a field
+// expresses no opinion about it.
+func guardComposed(g *v1alpha1.Guard, req *fnv1.RunFunctionRequest, dcds map[string]*fnv1.Resource) []string {
+	out := make([]string, 0)
+
+	existing := map[string]bool{}
+	for name := range req.GetObserved().GetResources() {
+		existing[name] = true
+	}
+	for name := range req.GetDesired().GetResources() {
+		existing[name] = true
+	}
+
+	for name := range existing {
+		if _, ok := dcds[name]; !ok && !g.AllowDeletion {
+			out = append(out, fmt.Sprintf("composed resource %q would be deleted", name))
+		}
+	}
+
+	added := make([]string, 0)
+	for name, dcd := range dcds {
+		if !existing[name] {
+			added = append(added, name)
+			continue
+		}
+
+		current, removals := req.GetObserved().GetResources()[name], false
+		if dd, ok := req.GetDesired().GetResources()[name]; ok {
+			current, removals = dd, true
+		}
+
+		changed := make([]string, 0)
+		changedPaths("", current.GetResource().AsMap(), dcd.GetResource().AsMap(), removals, &changed)
+		for _, p := range changed {
+			switch {
+			case matchesAny(p, ignoredPaths):
+			case matchesAny(p, alwaysImmutable), matchesAny(p, g.ImmutablePaths):
+				out = append(out, fmt.Sprintf("composed resource %q: field %q is immutable", name, p))
+			case len(g.MutablePaths) > 0 && !matchesAny(p, g.MutablePaths):
+				out = append(out, fmt.Sprintf("composed resource %q: field %q is not allowed to change", name, p))
+			}
+		}
+	}
+
+	if g.MaxNewResources != nil && len(added) > *g.MaxNewResources {
+		sort.Strings(added)
+		out = append(out, fmt.Sprintf("GPT generated %d new composed resources, more than the %d allowed: %s", len(added), *g.MaxNewResources, strings.Join(added, ", ")))
+	}
+
+	sort.Strings(out)
+	return out
+}
+
+// changedPaths appends the path of each field of generated that differs from
+// current to out. Fields of current that generated omits are only considered
+// changed if removals is true.
+func changedPaths(path string, current, generated any, removals bool, out *[]string) {
+	switch g := generated.(type) {
+	case map[string]any:
+		c, ok := current.(map[string]any)
+		if !ok && current != nil {
+			*out = append(*out, path)
+			return
+		}
+		for k, v := range g {
+			changedPaths(join(path, k), c[k], v, removals, out)
+		}
+		if !removals {
+			return
+		}
+		for k, v := range c {
+			if _, ok := g[k]; !ok {
+				removedPaths(join(path, k), v, out)
+			}
+		}
+	case []any:
+		c, ok := current.([]any)
+		if !ok || len(c) != len(g) {
+			*out = append(*out, path)
+			return
+		}
+		for i := range g {
+			changedPaths(fmt.Sprintf("%s[%d]", path, i), c[i], g[i], removals, out)
+		}
+	default:
+		if !reflect.DeepEqual(current, generated) {
+			*out = append(*out, path)
+		}
+	}
+}
+
+// removedPaths appends the path of each field of the supplied removed value
+// to out.
+func removedPaths(path string, removed any, out *[]string) {
+	m, ok := removed.(map[string]any)
+	if !ok || len(m) == 0 {
+		*out = append(*out, path)
+		return
+	}
+	for k, v := range m {
+		removedPaths(join(path, k), v, out)
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// matchesAny returns true if the supplied path is, or is beneath, any of the
+// supplied paths.
+func matchesAny(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/utils/ptr"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+func TestGuardComposed(t *testing.T) {
+	bucket := func(region string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "s3.aws.upbound.io/v1beta1",
+			"kind": "Bucket",
+			"metadata": {"name": "bucket", "annotations": {"upbound.io/name": "bucket"}},
+			"spec": {"forProvider": {"region": "` + region + `", "tags": {"team": "a"}}}
+		}`)}
+	}
+	observed := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"apiVersion": "s3.aws.upbound.io/v1beta1",
+		"kind": "Bucket",
+		"metadata": {"name": "bucket", "uid": "some-uid"},
+		"spec": {"forProvider": {"region": "us-east-1", "tags": {"team": "a"}, "objectLock": false}},
+		"status": {"atProvider": {"arn": "some-arn"}}
+	}`)}
+
+	type args struct {
+		g    *v1alpha1.Guard
+		req  *fnv1.RunFunctionRequest
+		dcds map[string]*fnv1.Resource
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []string
+	}{
+		"Unchanged": {
+			reason: "Omitted and server populated fields of an observed resource shouldn't be considered changes.",
+			args: args{
+				g:    &v1alpha1.Guard{MutablePaths: []string{"spec.forProvider.tags"}},
+				req:  &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": observed}}},
+				dcds: map[string]*fnv1.Resource{"bucket": bucket("us-east-1")},
+			},
+			want: []string{},
+		},
+		"Deleted": {
+			reason: "Omitting an existing resource should be a violation unless deletion is allowed.",
+			args: args{
+				g:    &v1alpha1.Guard{},
+				req:  &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": observed}}},
+				dcds: map[string]*fnv1.Resource{},
+			},
+			want: []string{`composed resource "bucket" would be deleted`},
+		},
+		"DeletionAllowed": {
+			reason: "Omitting an existing resource should be allowed if deletion is allowed.",
+			args: args{
+				g:    &v1alpha1.Guard{AllowDeletion: true},
+				req:  &fnv1.RunFunctionRequest{Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": bucket("us-east-1")}}},
+				dcds: map[string]*fnv1.Resource{},
+			},
+			want: []string{},
+		},
+		"NotMutable": {
+			reason: "Changing a field that isn't allow-listed should be a violation.",
+			args: args{
+				g:    &v1alpha1.Guard{MutablePaths: []string{"spec.forProvider.tags"}},
+				req:  &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": observed}}},
+				dcds: map[string]*fnv1.Resource{"bucket": bucket("eu-west-1")},
+			},
+			want: []string{`composed resource "bucket": field "spec.forProvider.region" is not allowed to change`},
+		},
+		"Immutable": {
+			reason: "Changing an immutable field should be a violation.",
+			args: args{
+				g:    &v1alpha1.Guard{ImmutablePaths: []string{"spec.forProvider.region"}},
+				req:  &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": observed}}},
+				dcds: map[string]*fnv1.Resource{"bucket": bucket("eu-west-1")},
+			},
+			want: []string{`composed resource "bucket": field "spec.forProvider.region" is immutable`},
+		},
+		"AlwaysImmutable": {
+			reason: "Changing a resource's kind should always be a violation.",
+			args: args{
+				g:   &v1alpha1.Guard{},
+				req: &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": observed}}},
+				dcds: map[string]*fnv1.Resource{"bucket": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "s3.aws.upbound.io/v1beta1",
+					"kind": "BucketPolicy"
+				}`)}},
+			},
+			want: []string{`composed resource "bucket": field "kind" is immutable`},
+		},
+		"RemovedFromDesired": {
+			reason: "Omitting a field desired by a previous function should be considered a change.",
+			args: args{
+				g:   &v1alpha1.Guard{MutablePaths: []string{"spec.forProvider.region"}},
+				req: &fnv1.RunFunctionRequest{Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{"bucket": bucket("us-east-1")}}},
+				dcds: map[string]*fnv1.Resource{"bucket": {Resource: resource.MustStructJSON(`{
+					"apiVersion": "s3.aws.upbound.io/v1beta1",
+					"kind": "Bucket",
+					"metadata": {"name": "bucket"},
+					"spec": {"forProvider": {"region": "us-east-1"}}
+				}`)}},
+			},
+			want: []string{`composed resource "bucket": field "spec.forProvider.tags.team" is not allowed to change`},
+		},
+		"TooManyNewResources": {
+			reason: "Generating more new resources than allowed should be a violation.",
+			args: args{
+				g:    &v1alpha1.Guard{MaxNewResources: ptr.To(1)},
+				req:  &fnv1.RunFunctionRequest{},
+				dcds: map[string]*fnv1.Resource{"a": bucket("us-east-1"), "b": bucket("us-east-1")},
+			},
+			want: []string{`GPT generated 2 new composed resources, more than the 1 allowed: a, b`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := guardComposed(tc.args.g, tc.args.req, tc.args.dcds)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nguardComposed(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // This isn't a custom resource, in the sense that we never install its CRD.
@@ -38,8 +39,722 @@ type Prompt struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	// SystemPrompt to send to GPT.
-	SystemPrompt string `json:"systemPrompt"`
-	// UserPrompt to send to GPT.
-	UserPrompt string `json:"userPrompt"`
+	// SystemPrompt to send to GPT. Overrides the template's system prompt.
+	// +optional
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+	// UserPrompt to send to GPT. Overrides the template's user prompt. A
+	// user prompt is required, either here or from the template.
+	// +optional
+	UserPrompt string `json:"userPrompt,omitempty"`
+
+	// Template references a named prompt template to use. Templates are
+	// built into the function, loaded from a directory mounted in the
+	// function's pod, or loaded from ConfigMaps supplied as required or
+	// extra resources, in increasing order of precedence.
+	// +optional
+	Template *TemplateRef `json:"template,omitempty"`
+
+	// TemplateEngine used to render the user prompt. Text renders it using
+	// Go's text/template package, with a library of template functions. HTML
+	// renders it using Go's html/template package, which escapes HTML
+	// special characters. HTML is deprecated, and only supported so that
+	// prompts written for it render the same way.
+	// +kubebuilder:validation:Enum=Text;HTML
+	// +kubebuilder:default=Text
+	// +optional
+	TemplateEngine TemplateEngine `json:"templateEngine,omitempty"`
+
+	// Provider of the LLM to use. Takes precedence over the LLM_PROVIDER key
+	// of the function's credential. Defaults to openai.
+	// +kubebuilder:validation:Enum=openai;azure-openai;anthropic;ollama
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// ResponseFormat controls how GPT is asked to format the resources it
+	// composes. YAML asks for a stream of YAML manifests. JSONSchema asks for
+	// a structured response constrained by a JSON Schema, falling back to
+	// YAML if the endpoint rejects structured outputs. Only used in
+	// composition pipelines.
+	// +kubebuilder:validation:Enum=YAML;JSONSchema
+	// +kubebuilder:default=YAML
+	// +optional
+	ResponseFormat ResponseFormat `json:"responseFormat,omitempty"`
+
+	// Validation configures validation of generated composed resources
+	// against their OpenAPI schemas. Schemas are loaded from any CRDs
+	// supplied as required or extra resources, or from a bundled set of core
+	// Kubernetes types. Generated composed resources aren't validated if
+	// unset. Only used in composition pipelines.
+	// +optional
+	Validation *Validation `json:"validation,omitempty"`
+
+	// RepairAttempts is the number of times GPT is asked to repair a
+	// response that can't be parsed, or that contains invalid composed
+	// resources. The original prompt, GPT's response and the problems with
+	// it are fed back to GPT for each attempt.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RepairAttempts int `json:"repairAttempts,omitempty"`
+
+	// CachePolicy configures caching of GPT's responses. Responses are
+	// cached by a hash of the model, the system prompt and the rendered user
+	// prompt, which includes the observed state. Responses aren't cached if
+	// unset.
+	// +optional
+	CachePolicy *CachePolicy `json:"cachePolicy,omitempty"`
+
+	// Budget limits how often GPT is asked to respond, and how many tokens
+	// it may use. Limits configured by the function's flags also apply;
+	// where both limit the same thing the stricter limit is enforced. When
+	// a budget is exhausted the function returns a Warning result, and in
+	// composition pipelines the composed resources it previously generated,
+	// rather than failing. Responses served from the cache don't count
+	// against budgets. No limits are enforced if unset.
+	// +optional
+	Budget *Budget `json:"budget,omitempty"`
+
+	// Regenerate determines when GPT is asked to generate composed
+	// resources. Always asks GPT every time the function runs. OnSpecChange
+	// only asks GPT when the composite resource's spec, the prompts or the
+	// template parameters change, otherwise returning the composed
+	// resources it previously generated. Manual only asks GPT when the
+	// composite resource's openai.fn.upbound.io/regenerate annotation
+	// changes. Previously generated composed resources are recorded in an
+	// annotation of the composite resource. Only used in composition
+	// pipelines.
+	// +kubebuilder:validation:Enum=Always;OnSpecChange;Manual
+	// +kubebuilder:default=Always
+	// +optional
+	Regenerate RegeneratePolicy `json:"regenerate,omitempty"`
+
+	// Guard limits the changes GPT may make to existing composed resources.
+	// Existing composed resources are those desired by previous functions
+	// in the pipeline, or observed. GPT may change anything if unset. Only
+	// used in composition pipelines.
+	// +optional
+	Guard *Guard `json:"guard,omitempty"`
+
+	// Merge determines how the composed resources GPT generates are combined
+	// with those desired by previous functions in the pipeline. Replace
+	// returns only the composed resources GPT generates. MergeByName keeps
+	// the desired composed resources, replacing any GPT generates a resource
+	// of the same name for. AdditiveOnly keeps the desired composed
+	// resources, only adding the composed resources GPT generates that
+	// aren't already desired. Only used in composition pipelines.
+	// +kubebuilder:validation:Enum=Replace;MergeByName;AdditiveOnly
+	// +kubebuilder:default=Replace
+	// +optional
+	Merge MergeStrategy `json:"merge,omitempty"`
+
+	// Composite allows GPT to write the composite resource's status and
+	// connection details. GPT writes them using a YAML document, or a
+	// structured response section, named composite. GPT may not write them
+	// if unset. Only used in composition pipelines.
+	// +optional
+	Composite *CompositeOutput `json:"composite,omitempty"`
+
+	// Readiness configures how the function reports whether composed
+	// resources are ready. Readiness isn't reported if unset. Only used in
+	// composition pipelines.
+	// +optional
+	Readiness *Readiness `json:"readiness,omitempty"`
+
+	// RequiredResources the function asks Crossplane for before prompting.
+	// Prompts reference the resources selected by each requirement using
+	// {{ index .RequiredResources "name" }}.
+	// +optional
+	RequiredResources []RequiredResource `json:"requiredResources,omitempty"`
+
+	// MCPServers the agent may call tools from, in addition to those
+	// configured by the function's MCP_SERVER_TOOL_* environment variables.
+	// A server of the same name as one configured by environment variables
+	// is merged with it. Fields set here take precedence over those of the
+	// resource the server is configured from, which take precedence over
+	// the environment variables.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	MCPServers []MCPServer `json:"mcpServers,omitempty"`
+
+	// Operation configures how the function processes the resources an
+	// operation watches. Only used in operation pipelines.
+	// +optional
+	Operation *Operation `json:"operation,omitempty"`
+
+	// Mode determines whether what GPT generates is applied. Apply returns
+	// it as desired state. Propose instead reports how it differs from the
+	// observed state and records it as a proposal, identified by a digest,
+	// in the openai.fn.upbound.io/proposal annotation and the pipeline
+	// context. A proposal is applied once the composite resource, or in
+	// operation pipelines a watched resource, is annotated with
+	// openai.fn.upbound.io/approved-proposal set to its digest. The
+	// regenerate policy isn't used in Propose mode.
+	// +kubebuilder:validation:Enum=Apply;Propose
+	// +kubebuilder:default=Apply
+	// +optional
+	Mode PromptMode `json:"mode,omitempty"`
+}
+
+// PromptMode determines whether what GPT generates is applied.
+type PromptMode string
+
+// Supported prompt modes.
+const (
+	// PromptModeApply returns what GPT generates as desired state.
+	PromptModeApply PromptMode = "Apply"
+	// PromptModePropose records what GPT generates as a proposal, which is
+	// only applied once it's approved.
+	PromptModePropose PromptMode = "Propose"
+)
+
+// Operation configures how the function processes watched resources.
+type Operation struct {
+	// Mode determines how watched resources are processed. Batch prompts
+	// GPT once with all watched resources. FanOut prompts GPT once for each
+	// watched resource.
+	// +kubebuilder:validation:Enum=Batch;FanOut
+	// +kubebuilder:default=Batch
+	// +optional
+	Mode OperationMode `json:"mode,omitempty"`
+
+	// MaxConcurrency is the maximum number of prompts the function runs at
+	// once in FanOut mode. Defaults to 4.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrency *int `json:"maxConcurrency,omitempty"`
+
+	// Output determines what GPT responds with. Resources asks GPT for the
+	// manifests of the resources to apply. Actions asks GPT for a list of
+	// typed actions, such as merge patches, label and annotation changes,
+	// status updates, or no-ops with an explanation. Actions are validated
+	// before they're converted to desired resources.
+	// +kubebuilder:validation:Enum=Resources;Actions
+	// +kubebuilder:default=Resources
+	// +optional
+	Output OperationOutput `json:"output,omitempty"`
+}
+
+// OperationOutput determines what GPT responds with in operation pipelines.
+type OperationOutput string
+
+// Supported operation outputs.
+const (
+	// OperationOutputResources asks GPT for resource manifests.
+	OperationOutputResources OperationOutput = "Resources"
+	// OperationOutputActions asks GPT for a list of typed actions.
+	OperationOutputActions OperationOutput = "Actions"
+)
+
+// OperationMode determines how watched resources are processed.
+type OperationMode string
+
+// Supported operation modes.
+const (
+	// OperationModeBatch prompts GPT once with all watched resources.
+	OperationModeBatch OperationMode = "Batch"
+	// OperationModeFanOut prompts GPT once for each watched resource.
+	OperationModeFanOut OperationMode = "FanOut"
+)
+
+// A RequiredResource selects resources the function asks Crossplane for.
+// Exactly one of MatchName, MatchNameFromCompositeFieldPath, or MatchLabels
+// must be set.
+type RequiredResource struct {
+	// Name of the requirement.
+	Name string `json:"name"`
+
+	// APIVersion of the resources to select.
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the resources to select.
+	Kind string `json:"kind"`
+
+	// MatchName selects the resource with this name.
+	// +optional
+	MatchName *string `json:"matchName,omitempty"`
+
+	// MatchNameFromCompositeFieldPath selects the resource whose name is at
+	// this field path of the observed composite resource, for example
+	// spec.providerConfigRef.name. Only used in composition pipelines.
+	// +optional
+	MatchNameFromCompositeFieldPath *string `json:"matchNameFromCompositeFieldPath,omitempty"`
+
+	// MatchLabels selects all resources with these labels.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// Namespace of the resources to select. Omit to select cluster scoped
+	// resources, or to select namespaced resources by labels across all
+	// namespaces.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+// An MCPServer the agent may call tools from.
+type MCPServer struct {
+	// Name of the server. Names are case insensitive. A server configured
+	// by environment variables is named by the part of the variable's name
+	// between MCP_SERVER_TOOL_ and its final underscore.
+	Name string `json:"name"`
+
+	// Transport used to connect to the server. Stdio servers run in the
+	// function's container, so they may only be configured by the
+	// function's environment variables. Their tools may still be allowed,
+	// or the server disabled, here.
+	// +kubebuilder:validation:Enum=sse;http-stream
+	// +optional
+	Transport string `json:"transport,omitempty"`
+
+	// BaseURL of the server.
+	// +optional
+	BaseURL string `json:"baseURL,omitempty"`
+
+	// AllowedTools the agent may call, as names or globs such as get-*.
+	// The agent may call all of the server's tools if unset.
+	// +optional
+	AllowedTools []string `json:"allowedTools,omitempty"`
+
+	// DeniedTools the agent may not call, as names or globs. Takes
+	// precedence over AllowedTools.
+	// +optional
+	DeniedTools []string `json:"deniedTools,omitempty"`
+
+	// ToolArguments constrains the arguments the agent may call the
+	// server's tools with. A call that doesn't satisfy every policy that
+	// applies to its tool is denied, and the agent told why.
+	// +optional
+	ToolArguments []MCPToolArgumentPolicy `json:"toolArguments,omitempty"`
+
+	// RequireReadOnly only allows the agent to call tools the server
+	// annotates as read-only, using the readOnlyHint annotation. Defaults
+	// to true in composition pipelines, and false in operation pipelines.
+	// +optional
+	RequireReadOnly *bool `json:"requireReadOnly,omitempty"`
+
+	// From configures the server from a ConfigMap, or another resource
+	// such as an MCPServer, that the function asks Crossplane for as a
+	// required resource. A ConfigMap configures the server using its
+	// transport, baseURL and allowedTools data keys, with allowedTools
+	// separated by commas. Other resources configure it using the same
+	// fields of their spec.
+	// +optional
+	From *MCPServerSource `json:"from,omitempty"`
+
+	// Auth configures how the function authenticates to the server.
+	// +optional
+	Auth *MCPServerAuth `json:"auth,omitempty"`
+
+	// Disabled stops the agent calling tools from the server, for example
+	// from a server configured by environment variables.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// An MCPToolArgumentPolicy constrains the arguments the agent may call a
+// tool with. At least one of Schema and Rule must be set.
+type MCPToolArgumentPolicy struct {
+	// Tool the policy applies to, as a name or glob.
+	Tool string `json:"tool"`
+
+	// Schema is a JSON Schema the arguments must validate against.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Schema *runtime.RawExtension `json:"schema,omitempty"`
+
+	// Rule is a CEL expression the arguments must satisfy. The arguments
+	// are available as args, for example
+	// !has(args.namespace) || args.namespace != 'kube-system'.
+	// +optional
+	Rule string `json:"rule,omitempty"`
+
+	// Message returned to the agent when a call is denied by the policy.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// MCPServerAuth configures how the function authenticates to an MCP server.
+// Secret values are read from the function's credentials, or from files
+// mounted in the function's container, and are never logged.
+type MCPServerAuth struct {
+	// Headers sent with every request to the server.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Headers []MCPServerHeader `json:"headers,omitempty"`
+
+	// BearerToken sent in the Authorization header of every request to the
+	// server.
+	// +optional
+	BearerToken *SecretSource `json:"bearerToken,omitempty"`
+
+	// TLS configures the client certificate the function presents to the
+	// server, and the certificate authorities it trusts.
+	// +optional
+	TLS *MCPServerTLS `json:"tls,omitempty"`
+}
+
+// An MCPServerHeader is sent with every request to an MCP server.
+type MCPServerHeader struct {
+	// Name of the header.
+	Name string `json:"name"`
+
+	// Value of the header. Use ValueFrom for secret values.
+	// +optional
+	Value string `json:"value,omitempty"`
+
+	// ValueFrom reads the value of the header from a secret source.
+	// +optional
+	ValueFrom *SecretSource `json:"valueFrom,omitempty"`
+}
+
+// MCPServerTLS configures TLS connections to an MCP server. Certificates and
+// keys are PEM encoded.
+type MCPServerTLS struct {
+	// CA certificates trusted to verify the server's certificate. The
+	// system's certificate authorities are trusted if unset.
+	// +optional
+	CA *SecretSource `json:"ca,omitempty"`
+
+	// Cert is the client certificate the function presents to the server.
+	// Requires Key.
+	// +optional
+	Cert *SecretSource `json:"cert,omitempty"`
+
+	// Key of the client certificate. Requires Cert.
+	// +optional
+	Key *SecretSource `json:"key,omitempty"`
+}
+
+// A SecretSource is a secret value read from either a function credential or
+// a file. Exactly one must be set.
+type SecretSource struct {
+	// CredentialRef reads the value from a key of one of the function's
+	// credentials. The credential must be of type Data. The gpt credential
+	// may only be read if the function allows it.
+	// +optional
+	CredentialRef *CredentialKeySelector `json:"credentialRef,omitempty"`
+
+	// File reads the value from a file mounted in the function's container.
+	// The file must be within the function's MCP secret directory. Relative
+	// paths are relative to that directory.
+	// +optional
+	File string `json:"file,omitempty"`
+}
+
+// A CredentialKeySelector selects a key of one of the function's credentials.
+type CredentialKeySelector struct {
+	// Name of the credential.
+	Name string `json:"name"`
+
+	// Key of the credential's data.
+	Key string `json:"key"`
+}
+
+// MCPServerSource is a resource an MCP server is configured from.
+type MCPServerSource struct {
+	// APIVersion of the resource.
+	// +kubebuilder:default=v1
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the resource.
+	// +kubebuilder:default=ConfigMap
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the resource.
+	Name string `json:"name"`
+
+	// Namespace of the resource. Omit for cluster scoped resources.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+// Readiness configures how the function reports whether composed resources
+// are ready.
+type Readiness struct {
+	// Mode determines how readiness is assessed. Rules evaluates the
+	// supplied rules against the observed composed resources. GPT asks GPT
+	// to assess the observed composed resources, returning whether each is
+	// ready along with custom conditions of the composite resource.
+	// +kubebuilder:validation:Enum=Rules;GPT
+	// +kubebuilder:default=Rules
+	// +optional
+	Mode ReadinessMode `json:"mode,omitempty"`
+
+	// Rules used to assess readiness in Rules mode. A composed resource is
+	// ready if every rule that applies to it passes. A composed resource is
+	// ready if its Ready condition is True if no rules are supplied.
+	// +optional
+	Rules []ReadinessRule `json:"rules,omitempty"`
+
+	// ConditionType of a condition the function sets on the composite
+	// resource. The condition is True if all composed resources are ready,
+	// and False otherwise. No condition is set if unset.
+	// +optional
+	ConditionType string `json:"conditionType,omitempty"`
+}
+
+// ReadinessMode determines how readiness is assessed.
+type ReadinessMode string
+
+// Supported readiness modes.
+const (
+	// ReadinessModeRules evaluates rules against observed composed
+	// resources.
+	ReadinessModeRules ReadinessMode = "Rules"
+	// ReadinessModeGPT asks GPT to assess observed composed resources.
+	ReadinessModeGPT ReadinessMode = "GPT"
+)
+
+// A ReadinessRule must pass for a composed resource to be ready. A rule checks
+// either a condition or a field.
+type ReadinessRule struct {
+	// Resources the rule applies to, by name. The rule applies to all
+	// composed resources if empty.
+	// +optional
+	Resources []string `json:"resources,omitempty"`
+
+	// ConditionType of a condition that must be True. Defaults to Ready if
+	// FieldPath is unset.
+	// +optional
+	ConditionType string `json:"conditionType,omitempty"`
+
+	// FieldPath of a field that must be set, for example
+	// status.atProvider.arn.
+	// +optional
+	FieldPath string `json:"fieldPath,omitempty"`
+
+	// FieldValue the field at FieldPath must have. The field need only be
+	// set if unset.
+	// +optional
+	FieldValue *string `json:"fieldValue,omitempty"`
+}
+
+// CompositeOutput configures what GPT may write to the composite resource.
+type CompositeOutput struct {
+	// StatusPaths are the status fields GPT may write, for example
+	// status.endpoint. A path also matches any field beneath it. Fields GPT
+	// writes that don't match any path are ignored.
+	// +optional
+	StatusPaths []string `json:"statusPaths,omitempty"`
+
+	// ConnectionDetails are the connection detail keys GPT may write.
+	// Connection details GPT writes with other keys are ignored.
+	// +optional
+	ConnectionDetails []string `json:"connectionDetails,omitempty"`
+}
+
+// MergeStrategy determines how generated composed resources are combined with
+// desired composed resources.
+type MergeStrategy string
+
+// Supported merge strategies.
+const (
+	// MergeReplace returns only the generated composed resources.
+	MergeReplace MergeStrategy = "Replace"
+	// MergeByName replaces desired composed resources with generated
+	// composed resources of the same name.
+	MergeByName MergeStrategy = "MergeByName"
+	// MergeAdditiveOnly only adds generated composed resources that aren't
+	// already desired.
+	MergeAdditiveOnly MergeStrategy = "AdditiveOnly"
+)
+
+// Guard limits the changes GPT may make to existing composed resources.
+// Fields are identified by dot separated paths, for example
+// spec.forProvider.region. Array elements are identified by index, for
+// example spec.ports[0].port. A path also matches any field beneath it.
+type Guard struct {
+	// Policy determines what happens when GPT's response violates the
+	// guard. Warn returns the generated composed resources along with a
+	// Warning result for each violation. Fatal additionally returns a Fatal
+	// result.
+	// +kubebuilder:validation:Enum=Warn;Fatal
+	// +kubebuilder:default=Fatal
+	// +optional
+	Policy GuardPolicy `json:"policy,omitempty"`
+
+	// AllowDeletion allows GPT to delete existing composed resources by
+	// omitting them from its response.
+	// +optional
+	AllowDeletion bool `json:"allowDeletion,omitempty"`
+
+	// MutablePaths are the only fields GPT may change on existing composed
+	// resources. GPT may change any field that isn't immutable if unset.
+	// +optional
+	MutablePaths []string `json:"mutablePaths,omitempty"`
+
+	// ImmutablePaths are fields GPT may never change on existing composed
+	// resources. The apiVersion, kind and metadata.name fields are always
+	// immutable.
+	// +optional
+	ImmutablePaths []string `json:"immutablePaths,omitempty"`
+
+	// MaxNewResources is the maximum number of new composed resources GPT
+	// may generate. GPT may generate any number of new composed resources if
+	// unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxNewResources *int `json:"maxNewResources,omitempty"`
+}
+
+// GuardPolicy determines what happens when GPT's response violates a guard.
+type GuardPolicy string
+
+// Supported guard policies.
+const (
+	// GuardPolicyWarn returns a Warning result for each violation.
+	GuardPolicyWarn GuardPolicy = "Warn"
+	// GuardPolicyFatal returns a Fatal result if there are any violations.
+	GuardPolicyFatal GuardPolicy = "Fatal"
+)
+
+// RegeneratePolicy determines when GPT is asked to generate composed
+// resources.
+type RegeneratePolicy string
+
+// Supported regenerate policies.
+const (
+	// RegenerateAlways asks GPT every time the function runs.
+	RegenerateAlways RegeneratePolicy = "Always"
+	// RegenerateOnSpecChange asks GPT when the composite resource's spec or
+	// the prompts change.
+	RegenerateOnSpecChange RegeneratePolicy = "OnSpecChange"
+	// RegenerateManual asks GPT when the composite resource's regenerate
+	// annotation changes.
+	RegenerateManual RegeneratePolicy = "Manual"
+)
+
+// Budget limits use of GPT. Use is tracked by each replica of the function,
+// in memory.
+type Budget struct {
+	// Model limits use of the model, by every prompt that uses it.
+	// +optional
+	Model *BudgetLimits `json:"model,omitempty"`
+
+	// CompositeKind limits use of GPT by all composite resources of the same
+	// kind. Only used in composition pipelines.
+	// +optional
+	CompositeKind *BudgetLimits `json:"compositeKind,omitempty"`
+
+	// Composite limits use of GPT by each composite resource. Only used in
+	// composition pipelines.
+	// +optional
+	Composite *BudgetLimits `json:"composite,omitempty"`
+}
+
+// BudgetLimits limit use of GPT. Unset limits aren't enforced.
+type BudgetLimits struct {
+	// RequestsPerMinute is the maximum number of times GPT is asked to
+	// respond in any minute.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RequestsPerMinute *int `json:"requestsPerMinute,omitempty"`
+
+	// TokensPerHour is the maximum number of tokens GPT may use in any
+	// hour. A response that exceeds the limit is still used, but GPT isn't
+	// asked again until the hour's use falls below it.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TokensPerHour *int `json:"tokensPerHour,omitempty"`
+
+	// TokensPerDay is the maximum number of tokens GPT may use in any day.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TokensPerDay *int `json:"tokensPerDay,omitempty"`
+}
+
+// CachePolicy configures caching of GPT's responses.
+type CachePolicy struct {
+	// Mode determines how the cache is used. Enabled returns a cached
+	// response if there is one, and caches new responses. Refresh always
+	// asks GPT, and caches its response. Disabled always asks GPT, and
+	// doesn't cache its response.
+	// +kubebuilder:validation:Enum=Enabled;Refresh;Disabled
+	// +kubebuilder:default=Enabled
+	// +optional
+	Mode CacheMode `json:"mode,omitempty"`
+
+	// TTL is how long a cached response is used for. Defaults to 1h.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+// CacheMode determines how the cache is used.
+type CacheMode string
+
+// Supported cache modes.
+const (
+	// CacheModeEnabled returns cached responses and caches new ones.
+	CacheModeEnabled CacheMode = "Enabled"
+	// CacheModeRefresh ignores cached responses but caches new ones.
+	CacheModeRefresh CacheMode = "Refresh"
+	// CacheModeDisabled neither returns nor caches responses.
+	CacheModeDisabled CacheMode = "Disabled"
+)
+
+// TemplateEngine renders the user prompt.
+type TemplateEngine string
+
+// Supported template engines.
+const (
+	// TemplateEngineText renders the user prompt using text/template.
+	TemplateEngineText TemplateEngine = "Text"
+	// TemplateEngineHTML renders the user prompt using html/template.
+	TemplateEngineHTML TemplateEngine = "HTML"
+)
+
+// TemplateRef references a named prompt template.
+type TemplateRef struct {
+	// Name of the template.
+	Name string `json:"name"`
+
+	// Parameters of the template. Templates reference parameters in their
+	// user prompt using {{ .Parameters.name }}.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
+
+// Validation configures validation of generated composed resources.
+type Validation struct {
+	// Policy determines what happens when a generated composed resource is
+	// invalid. Warn returns the generated composed resources along with a
+	// Warning result for each invalid resource. Fatal additionally returns a
+	// Fatal result.
+	// +kubebuilder:validation:Enum=Warn;Fatal
+	// +kubebuilder:default=Fatal
+	// +optional
+	Policy ValidationPolicy `json:"policy,omitempty"`
+
+	// RequireSchema treats generated composed resources whose schema isn't
+	// known as invalid.
+	// +optional
+	RequireSchema bool `json:"requireSchema,omitempty"`
+}
+
+// ValidationPolicy determines what happens when a generated composed resource
+// is invalid.
+type ValidationPolicy string
+
+// Supported validation policies.
+const (
+	// ValidationPolicyWarn returns a Warning result for each invalid
+	// resource.
+	ValidationPolicyWarn ValidationPolicy = "Warn"
+	// ValidationPolicyFatal returns a Fatal result if any resource is
+	// invalid.
+	ValidationPolicyFatal ValidationPolicy = "Fatal"
+)
+
+// ResponseFormat is the format GPT is asked to respond in.
+type ResponseFormat string
+
+// Supported response formats.
+const (
+	// ResponseFormatYAML asks GPT for a stream of YAML manifests.
+	ResponseFormatYAML ResponseFormat = "YAML"
+	// ResponseFormatJSONSchema asks GPT for a structured response
+	// constrained by a JSON Schema.
+	ResponseFormatJSONSchema ResponseFormat = "JSONSchema"
+)
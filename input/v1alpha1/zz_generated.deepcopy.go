@@ -21,14 +21,408 @@ limitations under the License.
 package v1alpha1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Budget) DeepCopyInto(out *Budget) {
+	*out = *in
+	if in.Model != nil {
+		in, out := &in.Model, &out.Model
+		*out = new(BudgetLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CompositeKind != nil {
+		in, out := &in.CompositeKind, &out.CompositeKind
+		*out = new(BudgetLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(BudgetLimits)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Budget.
+func (in *Budget) DeepCopy() *Budget {
+	if in == nil {
+		return nil
+	}
+	out := new(Budget)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BudgetLimits) DeepCopyInto(out *BudgetLimits) {
+	*out = *in
+	if in.RequestsPerMinute != nil {
+		in, out := &in.RequestsPerMinute, &out.RequestsPerMinute
+		*out = new(int)
+		**out = **in
+	}
+	if in.TokensPerHour != nil {
+		in, out := &in.TokensPerHour, &out.TokensPerHour
+		*out = new(int)
+		**out = **in
+	}
+	if in.TokensPerDay != nil {
+		in, out := &in.TokensPerDay, &out.TokensPerDay
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BudgetLimits.
+func (in *BudgetLimits) DeepCopy() *BudgetLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(BudgetLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CachePolicy) DeepCopyInto(out *CachePolicy) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CachePolicy.
+func (in *CachePolicy) DeepCopy() *CachePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(CachePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompositeOutput) DeepCopyInto(out *CompositeOutput) {
+	*out = *in
+	if in.StatusPaths != nil {
+		in, out := &in.StatusPaths, &out.StatusPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConnectionDetails != nil {
+		in, out := &in.ConnectionDetails, &out.ConnectionDetails
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompositeOutput.
+func (in *CompositeOutput) DeepCopy() *CompositeOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(CompositeOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialKeySelector) DeepCopyInto(out *CredentialKeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialKeySelector.
+func (in *CredentialKeySelector) DeepCopy() *CredentialKeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialKeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Guard) DeepCopyInto(out *Guard) {
+	*out = *in
+	if in.MutablePaths != nil {
+		in, out := &in.MutablePaths, &out.MutablePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImmutablePaths != nil {
+		in, out := &in.ImmutablePaths, &out.ImmutablePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxNewResources != nil {
+		in, out := &in.MaxNewResources, &out.MaxNewResources
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Guard.
+func (in *Guard) DeepCopy() *Guard {
+	if in == nil {
+		return nil
+	}
+	out := new(Guard)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPServer) DeepCopyInto(out *MCPServer) {
+	*out = *in
+	if in.AllowedTools != nil {
+		in, out := &in.AllowedTools, &out.AllowedTools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedTools != nil {
+		in, out := &in.DeniedTools, &out.DeniedTools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ToolArguments != nil {
+		in, out := &in.ToolArguments, &out.ToolArguments
+		*out = make([]MCPToolArgumentPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RequireReadOnly != nil {
+		in, out := &in.RequireReadOnly, &out.RequireReadOnly
+		*out = new(bool)
+		**out = **in
+	}
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = new(MCPServerSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(MCPServerAuth)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPServer.
+func (in *MCPServer) DeepCopy() *MCPServer {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPServerAuth) DeepCopyInto(out *MCPServerAuth) {
+	*out = *in
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make([]MCPServerHeader, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BearerToken != nil {
+		in, out := &in.BearerToken, &out.BearerToken
+		*out = new(SecretSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(MCPServerTLS)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPServerAuth.
+func (in *MCPServerAuth) DeepCopy() *MCPServerAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPServerAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPServerHeader) DeepCopyInto(out *MCPServerHeader) {
+	*out = *in
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(SecretSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPServerHeader.
+func (in *MCPServerHeader) DeepCopy() *MCPServerHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPServerHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPServerSource) DeepCopyInto(out *MCPServerSource) {
+	*out = *in
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPServerSource.
+func (in *MCPServerSource) DeepCopy() *MCPServerSource {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPServerSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPServerTLS) DeepCopyInto(out *MCPServerTLS) {
+	*out = *in
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(SecretSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Cert != nil {
+		in, out := &in.Cert, &out.Cert
+		*out = new(SecretSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Key != nil {
+		in, out := &in.Key, &out.Key
+		*out = new(SecretSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPServerTLS.
+func (in *MCPServerTLS) DeepCopy() *MCPServerTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPServerTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MCPToolArgumentPolicy) DeepCopyInto(out *MCPToolArgumentPolicy) {
+	*out = *in
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MCPToolArgumentPolicy.
+func (in *MCPToolArgumentPolicy) DeepCopy() *MCPToolArgumentPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(MCPToolArgumentPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Operation) DeepCopyInto(out *Operation) {
+	*out = *in
+	if in.MaxConcurrency != nil {
+		in, out := &in.MaxConcurrency, &out.MaxConcurrency
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Operation.
+func (in *Operation) DeepCopy() *Operation {
+	if in == nil {
+		return nil
+	}
+	out := new(Operation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Prompt) DeepCopyInto(out *Prompt) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(TemplateRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Validation != nil {
+		in, out := &in.Validation, &out.Validation
+		*out = new(Validation)
+		**out = **in
+	}
+	if in.CachePolicy != nil {
+		in, out := &in.CachePolicy, &out.CachePolicy
+		*out = new(CachePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Budget != nil {
+		in, out := &in.Budget, &out.Budget
+		*out = new(Budget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Guard != nil {
+		in, out := &in.Guard, &out.Guard
+		*out = new(Guard)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Composite != nil {
+		in, out := &in.Composite, &out.Composite
+		*out = new(CompositeOutput)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(Readiness)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RequiredResources != nil {
+		in, out := &in.RequiredResources, &out.RequiredResources
+		*out = make([]RequiredResource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MCPServers != nil {
+		in, out := &in.MCPServers, &out.MCPServers
+		*out = make([]MCPServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Operation != nil {
+		in, out := &in.Operation, &out.Operation
+		*out = new(Operation)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Prompt.
@@ -48,3 +442,144 @@ func (in *Prompt) DeepCopyObject() runtime.Object {
 	}
 	return nil
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Readiness) DeepCopyInto(out *Readiness) {
+	*out = *in
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]ReadinessRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Readiness.
+func (in *Readiness) DeepCopy() *Readiness {
+	if in == nil {
+		return nil
+	}
+	out := new(Readiness)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessRule) DeepCopyInto(out *ReadinessRule) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FieldValue != nil {
+		in, out := &in.FieldValue, &out.FieldValue
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessRule.
+func (in *ReadinessRule) DeepCopy() *ReadinessRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RequiredResource) DeepCopyInto(out *RequiredResource) {
+	*out = *in
+	if in.MatchName != nil {
+		in, out := &in.MatchName, &out.MatchName
+		*out = new(string)
+		**out = **in
+	}
+	if in.MatchNameFromCompositeFieldPath != nil {
+		in, out := &in.MatchNameFromCompositeFieldPath, &out.MatchNameFromCompositeFieldPath
+		*out = new(string)
+		**out = **in
+	}
+	if in.MatchLabels != nil {
+		in, out := &in.MatchLabels, &out.MatchLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequiredResource.
+func (in *RequiredResource) DeepCopy() *RequiredResource {
+	if in == nil {
+		return nil
+	}
+	out := new(RequiredResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretSource) DeepCopyInto(out *SecretSource) {
+	*out = *in
+	if in.CredentialRef != nil {
+		in, out := &in.CredentialRef, &out.CredentialRef
+		*out = new(CredentialKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretSource.
+func (in *SecretSource) DeepCopy() *SecretSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateRef) DeepCopyInto(out *TemplateRef) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateRef.
+func (in *TemplateRef) DeepCopy() *TemplateRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Validation) DeepCopyInto(out *Validation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Validation.
+func (in *Validation) DeepCopy() *Validation {
+	if in == nil {
+		return nil
+	}
+	out := new(Validation)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,219 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package budget
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// ErrExhausted is returned when a budget doesn't allow another request.
+var ErrExhausted = errors.New("budget exhausted")
+
+// Windows over which use of a budget is limited.
+const (
+	minute = time.Minute
+	hour   = time.Hour
+	day    = 24 * time.Hour
+)
+
+// Limits of a budget. A zero limit isn't enforced.
+type Limits struct {
+	// RequestsPerMinute is the maximum number of requests in any minute.
+	RequestsPerMinute int
+
+	// TokensPerHour is the maximum number of tokens used in any hour.
+	TokensPerHour int
+
+	// TokensPerDay is the maximum number of tokens used in any day.
+	TokensPerDay int
+}
+
+// Stricter returns the stricter of each of the supplied limits.
+func (l Limits) Stricter(o Limits) Limits {
+	return Limits{
+		RequestsPerMinute: stricter(l.RequestsPerMinute, o.RequestsPerMinute),
+		TokensPerHour:     stricter(l.TokensPerHour, o.TokensPerHour),
+		TokensPerDay:      stricter(l.TokensPerDay, o.TokensPerDay),
+	}
+}
+
+// IsZero returns true if none of the limits are enforced.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+func stricter(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// A Budget limits use of something, for example a model.
+type Budget struct {
+	// Name of the budget. Budgets of the same name share their use.
+	Name string
+
+	// Limits of the budget.
+	Limits Limits
+}
+
+// A Limiter tracks use of budgets. Use is only tracked in memory, so each
+// replica of the function has its own budgets. Limiters are safe for
+// concurrent use.
+type Limiter struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	use   map[string]*use
+	swept time.Time
+}
+
+// use of a budget over the longest window it's limited over.
+type use struct {
+	requests []time.Time
+	tokens   []spend
+}
+
+// spend of tokens at a point in time.
+type spend struct {
+	at     time.Time
+	tokens int
+}
+
+// An Option modifies the underlying Limiter.
+type Option func(*Limiter)
+
+// WithClock overrides how the Limiter determines the current time.
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+// NewLimiter returns a Limiter that tracks use of budgets.
+func NewLimiter(opts ...Option) *Limiter {
+	l := &Limiter{now: time.Now, use: map[string]*use{}}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Reserve records a request against each of the supplied budgets. It returns
+// an error that wraps ErrExhausted, and records nothing, if any budget doesn't
+// allow another request. Token limits are checked against the tokens already
+// used, because a request's tokens aren't known until it completes.
+func (l *Limiter) Reserve(budgets ...Budget) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	for _, b := range budgets {
+		u := l.useOf(b.Name, now)
+		if limit := b.Limits.RequestsPerMinute; limit > 0 && len(u.requests) >= limit {
+			return errors.Wrapf(ErrExhausted, "%s is limited to %d requests per minute; retry in %s", b.Name, limit, u.requests[0].Add(minute).Sub(now).Round(time.Second))
+		}
+		if limit := b.Limits.TokensPerHour; limit > 0 && u.tokensSince(now.Add(-hour)) >= limit {
+			return errors.Wrapf(ErrExhausted, "%s is limited to %d tokens per hour", b.Name, limit)
+		}
+		if limit := b.Limits.TokensPerDay; limit > 0 && u.tokensSince(now.Add(-day)) >= limit {
+			return errors.Wrapf(ErrExhausted, "%s is limited to %d tokens per day", b.Name, limit)
+		}
+	}
+
+	for _, b := range budgets {
+		u := l.use[b.Name]
+		u.requests = append(u.requests, now)
+	}
+	return nil
+}
+
+// Spend records the supplied tokens against each of the supplied budgets.
+func (l *Limiter) Spend(tokens int, budgets ...Budget) {
+	if tokens <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, b := range budgets {
+		u := l.useOf(b.Name, now)
+		u.tokens = append(u.tokens, spend{at: now, tokens: tokens})
+	}
+}
+
+// useOf the named budget, forgetting use older than the windows budgets are
+// limited over.
+func (l *Limiter) useOf(name string, now time.Time) *use {
+	u, ok := l.use[name]
+	if !ok {
+		u = &use{}
+		l.use[name] = u
+	}
+	u.forget(now)
+	return u
+}
+
+// sweep forgets budgets that haven't been used within the windows budgets are
+// limited over, at most once a minute. Budgets may be per composite resource,
+// so there may be many of them.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < minute {
+		return
+	}
+	l.swept = now
+	for name, u := range l.use {
+		u.forget(now)
+		if len(u.requests) == 0 && len(u.tokens) == 0 {
+			delete(l.use, name)
+		}
+	}
+}
+
+// forget use older than the windows budgets are limited over.
+func (u *use) forget(now time.Time) {
+	i := 0
+	for i < len(u.requests) && !u.requests[i].After(now.Add(-minute)) {
+		i++
+	}
+	u.requests = u.requests[i:]
+
+	j := 0
+	for j < len(u.tokens) && !u.tokens[j].at.After(now.Add(-day)) {
+		j++
+	}
+	u.tokens = u.tokens[j:]
+}
+
+// tokensSince returns the tokens spent after the supplied time.
+func (u *use) tokensSince(t time.Time) int {
+	total := 0
+	for _, s := range u.tokens {
+		if s.at.After(t) {
+			total += s.tokens
+		}
+	}
+	return total
+}
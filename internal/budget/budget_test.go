@@ -0,0 +1,117 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+func TestLimiter(t *testing.T) {
+	model := Budget{Name: `model "gpt-4o"`, Limits: Limits{RequestsPerMinute: 2}}
+	xr := Budget{Name: `composite resource XBucket "cool-xr"`, Limits: Limits{TokensPerHour: 1000, TokensPerDay: 1500}}
+
+	// A step waits, reserves a request against the budgets, then spends
+	// tokens against them if the request is allowed.
+	type step struct {
+		wait   time.Duration
+		spend  int
+		budget []Budget
+	}
+
+	cases := map[string]struct {
+		reason string
+		steps  []step
+		want   []bool
+	}{
+		"RequestsPerMinute": {
+			reason: "Requests should be refused once the budget's requests per minute are used, until a minute has passed.",
+			steps: []step{
+				{budget: []Budget{model}},
+				{wait: 10 * time.Second, budget: []Budget{model}},
+				{wait: 10 * time.Second, budget: []Budget{model}},
+				{wait: 41 * time.Second, budget: []Budget{model}},
+			},
+			want: []bool{true, true, false, true},
+		},
+		"TokensPerHour": {
+			reason: "Requests should be refused once the budget's tokens per hour are used, until an hour has passed.",
+			steps: []step{
+				{spend: 1000, budget: []Budget{xr}},
+				{budget: []Budget{xr}},
+				{wait: time.Hour, budget: []Budget{xr}},
+			},
+			want: []bool{true, false, true},
+		},
+		"TokensPerDay": {
+			reason: "Requests should be refused once the budget's tokens per day are used, until a day has passed.",
+			steps: []step{
+				{spend: 900, budget: []Budget{xr}},
+				{wait: time.Hour, spend: 900, budget: []Budget{xr}},
+				{wait: time.Minute, budget: []Budget{xr}},
+				{wait: 23 * time.Hour, budget: []Budget{xr}},
+			},
+			want: []bool{true, true, false, true},
+		},
+		"AnyBudget": {
+			reason: "A request should be refused, and not counted against any budget, if any of its budgets is exhausted.",
+			steps: []step{
+				{spend: 1000, budget: []Budget{xr}},
+				{budget: []Budget{model, xr}},
+				{budget: []Budget{model}},
+				{budget: []Budget{model}},
+			},
+			want: []bool{true, false, true, true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			l := NewLimiter(WithClock(func() time.Time { return now }))
+
+			got := make([]bool, 0, len(tc.steps))
+			for _, s := range tc.steps {
+				now = now.Add(s.wait)
+				err := l.Reserve(s.budget...)
+				if err != nil && !errors.Is(err, ErrExhausted) {
+					t.Fatalf("Reserve(...): want ErrExhausted, got %v", err)
+				}
+				if err == nil {
+					l.Spend(s.spend, s.budget...)
+				}
+				got = append(got, err == nil)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nReserve(...): -want allowed, +got allowed:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestStricter(t *testing.T) {
+	a := Limits{RequestsPerMinute: 10, TokensPerHour: 1000}
+	b := Limits{RequestsPerMinute: 5, TokensPerDay: 5000}
+	want := Limits{RequestsPerMinute: 5, TokensPerHour: 1000, TokensPerDay: 5000}
+	if diff := cmp.Diff(want, a.Stricter(b)); diff != "" {
+		t.Errorf("Stricter(...): -want, +got:\n%s", diff)
+	}
+}
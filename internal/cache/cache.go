@@ -0,0 +1,276 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// A Cache stores values by key until they expire.
+type Cache interface {
+	// Get the value stored under the supplied key. It returns false if no
+	// unexpired value is stored under the key.
+	Get(key string) (string, bool, error)
+
+	// Set the value stored under the supplied key. The value expires after
+	// the supplied TTL.
+	Set(key, value string, ttl time.Duration) error
+}
+
+// Key derives a cache key by hashing the supplied parts.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		// Length prefix each part so that parts can't run into each other.
+		_ = json.NewEncoder(h).Encode(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Option modifies the underlying Memory or Disk cache.
+type Option func(*clock)
+
+// WithClock overrides the clock used to expire values.
+func WithClock(now func() time.Time) Option {
+	return func(c *clock) {
+		c.now = now
+	}
+}
+
+type clock struct {
+	now func() time.Time
+}
+
+func newClock(opts ...Option) clock {
+	c := clock{now: time.Now}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+// Memory is an in-memory, least recently used Cache. Once it's full it evicts
+// the least recently used value to make room for new ones.
+type Memory struct {
+	clock
+
+	size int
+
+	mx      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type entry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// NewMemory constructs an in-memory Cache that holds up to the supplied
+// number of values.
+func NewMemory(size int, opts ...Option) *Memory {
+	return &Memory{
+		clock:   newClock(opts...),
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get the value stored under the supplied key.
+func (m *Memory) Get(key string) (string, bool, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return "", false, nil
+	}
+	e := el.Value.(*entry) //nolint:forcetypeassert // We only store *entry.
+	if !m.now().Before(e.expires) {
+		m.lru.Remove(el)
+		delete(m.entries, key)
+		return "", false, nil
+	}
+	m.lru.MoveToFront(el)
+	return e.value, true, nil
+}
+
+// Set the value stored under the supplied key.
+func (m *Memory) Set(key, value string, ttl time.Duration) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	e := &entry{key: key, value: value, expires: m.now().Add(ttl)}
+	if el, ok := m.entries[key]; ok {
+		el.Value = e
+		m.lru.MoveToFront(el)
+		return nil
+	}
+
+	m.entries[key] = m.lru.PushFront(e)
+	for m.lru.Len() > m.size {
+		el := m.lru.Back()
+		m.lru.Remove(el)
+		delete(m.entries, el.Value.(*entry).key) //nolint:forcetypeassert // We only store *entry.
+	}
+	return nil
+}
+
+// Disk is a Cache that stores each value as a file in a local directory. Each
+// time it stores a value it removes expired values, and once it's full it
+// evicts the values closest to expiring to make room for new ones.
+type Disk struct {
+	clock
+
+	dir  string
+	size int
+
+	mx sync.Mutex
+}
+
+// NewDisk constructs a Cache that stores up to the supplied number of values
+// in the supplied directory, creating it if necessary.
+func NewDisk(dir string, size int, opts ...Option) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrapf(err, "cannot create cache directory %q", dir)
+	}
+	return &Disk{clock: newClock(opts...), dir: dir, size: size}, nil
+}
+
+// Get the value stored under the supplied key.
+func (d *Disk) Get(key string) (string, bool, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, errors.Wrap(err, "cannot read cached value")
+	}
+
+	e := &diskEntry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return "", false, errors.Wrap(err, "cannot unmarshal cached value")
+	}
+	if !d.now().Before(e.Expires) {
+		_ = os.Remove(d.path(key))
+		return "", false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set the value stored under the supplied key.
+func (d *Disk) Set(key, value string, ttl time.Duration) error {
+	expires := d.now().Add(ttl)
+	b, err := json.Marshal(&diskEntry{Value: value, Expires: expires})
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal value")
+	}
+
+	// Write to a temporary file then rename it so that readers never see a
+	// partially written value.
+	f, err := os.CreateTemp(d.dir, ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "cannot create temporary file")
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck // Fails harmlessly once renamed.
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "cannot write value")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "cannot close temporary file")
+	}
+
+	// Record when the value expires as the file's modification time, so
+	// that sweeping doesn't need to read every value.
+	if err := os.Chtimes(f.Name(), expires, expires); err != nil {
+		return errors.Wrap(err, "cannot set expiry of value")
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if err := os.Rename(f.Name(), d.path(key)); err != nil {
+		return errors.Wrap(err, "cannot store value")
+	}
+	return d.sweep()
+}
+
+// sweep removes expired values, then evicts the values closest to expiring
+// until no more than the configured number of values are stored.
+func (d *Disk) sweep() error {
+	des, err := os.ReadDir(d.dir)
+	if err != nil {
+		return errors.Wrap(err, "cannot list cached values")
+	}
+
+	type stored struct {
+		path    string
+		expires time.Time
+	}
+	live := make([]stored, 0, len(des))
+	for _, de := range des {
+		if de.IsDir() || strings.HasPrefix(de.Name(), ".tmp-") {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			// The value was probably removed concurrently.
+			continue
+		}
+		s := stored{path: filepath.Join(d.dir, de.Name()), expires: fi.ModTime()}
+		if !d.now().Before(s.expires) {
+			_ = os.Remove(s.path)
+			continue
+		}
+		live = append(live, s)
+	}
+
+	if len(live) <= d.size {
+		return nil
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].expires.Before(live[j].expires) })
+	for _, s := range live[:len(live)-d.size] {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "cannot evict cached value")
+		}
+	}
+	return nil
+}
+
+func (d *Disk) path(key string) string {
+	// Keys are hashed so they're safe to use as file names.
+	return filepath.Join(d.dir, Key(key))
+}
+
+type diskEntry struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
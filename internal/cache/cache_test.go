@@ -0,0 +1,179 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// op is a Get or Set operation against a cache.
+type op struct {
+	// advance the clock before the operation.
+	advance time.Duration
+
+	// set the key to the value if true, otherwise get it.
+	set   bool
+	key   string
+	value string
+	ttl   time.Duration
+}
+
+// result of a Get operation.
+type result struct {
+	Value string
+	OK    bool
+}
+
+func TestCache(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		ops    []op
+		want   []result
+	}{
+		"Miss": {
+			reason: "Getting a key that was never set should miss.",
+			ops:    []op{{key: "a"}},
+			want:   []result{{}},
+		},
+		"Hit": {
+			reason: "Getting a key that was set should hit.",
+			ops: []op{
+				{set: true, key: "a", value: "A", ttl: time.Minute},
+				{key: "a"},
+			},
+			want: []result{{Value: "A", OK: true}},
+		},
+		"Overwrite": {
+			reason: "Setting a key that was already set should replace its value.",
+			ops: []op{
+				{set: true, key: "a", value: "A", ttl: time.Minute},
+				{set: true, key: "a", value: "B", ttl: time.Minute},
+				{key: "a"},
+			},
+			want: []result{{Value: "B", OK: true}},
+		},
+		"Expired": {
+			reason: "Getting a key whose TTL has passed should miss.",
+			ops: []op{
+				{set: true, key: "a", value: "A", ttl: time.Minute},
+				{advance: 30 * time.Second, key: "a"},
+				{advance: 30 * time.Second, key: "a"},
+			},
+			want: []result{{Value: "A", OK: true}, {}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var now time.Time
+			clock := WithClock(func() time.Time { return now })
+			disk, err := NewDisk(t.TempDir(), 10, clock)
+			if err != nil {
+				t.Fatalf("NewDisk(...): %v", err)
+			}
+			for impl, c := range map[string]Cache{
+				"Memory": NewMemory(10, clock),
+				"Disk":   disk,
+			} {
+				now = time.Unix(0, 0)
+				got := []result{}
+				for _, o := range tc.ops {
+					now = now.Add(o.advance)
+					if o.set {
+						if err := c.Set(o.key, o.value, o.ttl); err != nil {
+							t.Fatalf("\n%s\n%s.Set(...): %v", tc.reason, impl, err)
+						}
+						continue
+					}
+					v, ok, err := c.Get(o.key)
+					if err != nil {
+						t.Fatalf("\n%s\n%s.Get(...): %v", tc.reason, impl, err)
+					}
+					got = append(got, result{Value: v, OK: ok})
+				}
+				if diff := cmp.Diff(tc.want, got); diff != "" {
+					t.Errorf("\n%s\n%s: -want, +got:\n%s", tc.reason, impl, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemory(2)
+	_ = c.Set("a", "A", time.Minute)
+	_ = c.Set("b", "B", time.Minute)
+
+	// Using a makes b the least recently used value.
+	_, _, _ = c.Get("a")
+	_ = c.Set("c", "C", time.Minute)
+
+	want := map[string]bool{"a": true, "b": false, "c": true}
+	got := map[string]bool{}
+	for k := range want {
+		_, ok, _ := c.Get(k)
+		got[k] = ok
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Get(...): -want cached, +got cached:\n%s", diff)
+	}
+}
+
+func TestDiskEvictsClosestToExpiring(t *testing.T) {
+	var now time.Time
+	dir := t.TempDir()
+	c, err := NewDisk(dir, 2, WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("NewDisk(...): %v", err)
+	}
+
+	now = time.Unix(0, 0)
+	_ = c.Set("a", "A", time.Minute)
+	_ = c.Set("b", "B", 3*time.Minute)
+
+	// Setting c evicts a, which is closest to expiring.
+	_ = c.Set("c", "C", 2*time.Minute)
+
+	// Setting d removes c, which has expired, without evicting b.
+	now = now.Add(2 * time.Minute)
+	_ = c.Set("d", "D", time.Minute)
+
+	want := map[string]bool{"a": false, "b": true, "c": false, "d": true}
+	got := map[string]bool{}
+	for k := range want {
+		_, ok, _ := c.Get(k)
+		got[k] = ok
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Get(...): -want cached, +got cached:\n%s", diff)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("NewDisk(...): want 2 stored values, got %d", len(files))
+	}
+}
+
+func TestKey(t *testing.T) {
+	if Key("ab", "c") == Key("a", "bc") {
+		t.Errorf("Key(...): parts that concatenate to the same string should produce different keys")
+	}
+}
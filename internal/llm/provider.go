@@ -0,0 +1,289 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package llm
+
+import (
+	"sort"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/ollama"
+	openaillm "github.com/tmc/langchaingo/llms/openai"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// Supported providers.
+const (
+	OpenAI      = "openai"
+	AzureOpenAI = "azure-openai"
+	Anthropic   = "anthropic"
+	Ollama      = "ollama"
+)
+
+// Default models of providers that have one.
+const (
+	DefaultOpenAIModel    = "gpt-4"
+	DefaultAnthropicModel = "claude-3-5-sonnet-latest"
+	DefaultOllamaModel    = "llama3.1"
+)
+
+// ErrStructuredOutputUnsupported is returned when a structured response is
+// requested from a provider that doesn't support them.
+var ErrStructuredOutputUnsupported = errors.New("provider does not support structured output")
+
+// Schema constrains a structured response.
+type Schema = openaillm.ResponseFormatJSONSchema
+
+// Config configures a model.
+type Config struct {
+	// Provider of the model. Defaults to OpenAI.
+	Provider string
+
+	// APIKey used to authenticate to the provider. Not all providers
+	// require one.
+	APIKey string
+
+	// BaseURL of the provider's API. Defaults to the provider's public API,
+	// or a local server for self-hosted providers.
+	BaseURL string
+
+	// Model to use. Defaults to the provider's default model, if any.
+	Model string
+
+	// APIVersion of the provider's API. Required by Azure OpenAI.
+	APIVersion string
+
+	// Deployment of the model. Required by Azure OpenAI.
+	Deployment string
+
+	// Schema, if set, asks the model for a structured response constrained
+	// by the schema.
+	Schema *Schema
+}
+
+// ModelName returns the name of the model the supplied config uses, including
+// any default the provider applies.
+func ModelName(cfg Config) string {
+	if cfg.Model != "" {
+		return cfg.Model
+	}
+	switch cfg.Provider {
+	case OpenAI, "":
+		return DefaultOpenAIModel
+	case AzureOpenAI:
+		return cfg.Deployment
+	case Anthropic:
+		return DefaultAnthropicModel
+	case Ollama:
+		return DefaultOllamaModel
+	}
+	return ""
+}
+
+// Usage returns the prompt and completion tokens used to generate the supplied
+// response. Providers report usage in each choice's generation info, using
+// different keys.
+func Usage(rsp *llms.ContentResponse) (prompt, completion int) {
+	if rsp == nil || len(rsp.Choices) == 0 {
+		return 0, 0
+	}
+	// Providers report the usage of the whole response in every choice.
+	info := rsp.Choices[0].GenerationInfo
+	return tokens(info, "PromptTokens", "InputTokens"), tokens(info, "CompletionTokens", "OutputTokens")
+}
+
+func tokens(info map[string]any, keys ...string) int {
+	for _, k := range keys {
+		switch v := info[k].(type) {
+		case int:
+			return v
+		case int32:
+			return int(v)
+		case int64:
+			return int(v)
+		case float64:
+			return int(v)
+		}
+	}
+	return 0
+}
+
+// A Provider builds models.
+type Provider interface {
+	// Model builds a model from the supplied config.
+	Model(cfg Config) (llms.Model, error)
+}
+
+// A ProviderFn is a function that satisfies Provider.
+type ProviderFn func(cfg Config) (llms.Model, error)
+
+// Model builds a model from the supplied config.
+func (fn ProviderFn) Model(cfg Config) (llms.Model, error) {
+	return fn(cfg)
+}
+
+// A Registry of providers, keyed by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// RegistryOption modifies the underlying Registry.
+type RegistryOption func(*Registry)
+
+// WithProvider registers the supplied provider under the supplied name,
+// replacing any provider already registered under it.
+func WithProvider(name string, p Provider) RegistryOption {
+	return func(r *Registry) {
+		r.providers[name] = p
+	}
+}
+
+// NewRegistry constructs a Registry of the supported providers.
+func NewRegistry(opts ...RegistryOption) *Registry {
+	r := &Registry{
+		providers: map[string]Provider{
+			OpenAI:      ProviderFn(NewOpenAI),
+			AzureOpenAI: ProviderFn(NewAzureOpenAI),
+			Anthropic:   ProviderFn(NewAnthropic),
+			Ollama:      ProviderFn(NewOllama),
+		},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Model builds a model using the provider named by the supplied config.
+func (r *Registry) Model(cfg Config) (llms.Model, error) {
+	name := cfg.Provider
+	if name == "" {
+		name = OpenAI
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown provider %q: must be one of %v", name, r.Names())
+	}
+	m, err := p.Model(cfg)
+	return m, errors.Wrapf(err, "cannot build %s model", name)
+}
+
+// Names returns the sorted names of the registered providers.
+func (r *Registry) Names() []string {
+	out := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewOpenAI builds an OpenAI model. Any OpenAI compatible endpoint may be
+// used by supplying a base URL.
+func NewOpenAI(cfg Config) (llms.Model, error) {
+	model := cfg.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+	opts := []openaillm.Option{
+		openaillm.WithToken(cfg.APIKey),
+		openaillm.WithModel(model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, openaillm.WithBaseURL(cfg.BaseURL))
+	}
+	if cfg.Schema != nil {
+		opts = append(opts, withSchema(cfg.Schema))
+	}
+	return openaillm.New(opts...)
+}
+
+// NewAzureOpenAI builds an Azure OpenAI model. The base URL is the Azure
+// OpenAI resource's endpoint. The deployment defaults to the model.
+func NewAzureOpenAI(cfg Config) (llms.Model, error) {
+	if cfg.BaseURL == "" {
+		return nil, errors.New("base URL is required")
+	}
+	if cfg.APIVersion == "" {
+		return nil, errors.New("API version is required")
+	}
+	deployment := cfg.Deployment
+	if deployment == "" {
+		deployment = cfg.Model
+	}
+	if deployment == "" {
+		return nil, errors.New("deployment is required")
+	}
+	opts := []openaillm.Option{
+		openaillm.WithAPIType(openaillm.APITypeAzure),
+		openaillm.WithToken(cfg.APIKey),
+		openaillm.WithBaseURL(cfg.BaseURL),
+		openaillm.WithAPIVersion(cfg.APIVersion),
+		// Azure OpenAI addresses models by deployment name.
+		openaillm.WithModel(deployment),
+	}
+	if cfg.Schema != nil {
+		opts = append(opts, withSchema(cfg.Schema))
+	}
+	return openaillm.New(opts...)
+}
+
+// NewAnthropic builds an Anthropic model.
+func NewAnthropic(cfg Config) (llms.Model, error) {
+	if cfg.Schema != nil {
+		return nil, ErrStructuredOutputUnsupported
+	}
+	model := cfg.Model
+	if model == "" {
+		model = DefaultAnthropicModel
+	}
+	opts := []anthropic.Option{
+		anthropic.WithToken(cfg.APIKey),
+		anthropic.WithModel(model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, anthropic.WithBaseURL(cfg.BaseURL))
+	}
+	return anthropic.New(opts...)
+}
+
+// NewOllama builds an Ollama model. The base URL defaults to a local Ollama
+// server.
+func NewOllama(cfg Config) (llms.Model, error) {
+	if cfg.Schema != nil {
+		return nil, ErrStructuredOutputUnsupported
+	}
+	model := cfg.Model
+	if model == "" {
+		model = DefaultOllamaModel
+	}
+	opts := []ollama.Option{
+		ollama.WithModel(model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, ollama.WithServerURL(cfg.BaseURL))
+	}
+	return ollama.New(opts...)
+}
+
+func withSchema(s *Schema) openaillm.Option {
+	return openaillm.WithResponseFormat(&openaillm.ResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: s,
+	})
+}
@@ -0,0 +1,256 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// request is what a provider's stand-in API observed.
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Auth   string
+	Model  string
+}
+
+// standIn starts a stand-in for a provider's HTTP API that records the
+// request it receives and responds with the supplied body.
+func standIn(t *testing.T, got *request, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		req := struct {
+			Model string `json:"model"`
+		}{}
+		_ = json.Unmarshal(b, &req)
+
+		*got = request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Model:  req.Model,
+		}
+		for _, h := range []string{"Authorization", "api-key", "x-api-key"} {
+			if v := r.Header.Get(h); v != "" {
+				got.Auth = h + ": " + v
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+const (
+	openAIResponse    = `{"choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	anthropicResponse = `{"id":"msg","type":"message","role":"assistant","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":1,"output_tokens":1}}`
+	ollamaResponse    = `{"model":"llama3.1","message":{"role":"assistant","content":"hello"},"done":true}`
+)
+
+func TestRegistryModel(t *testing.T) {
+	type args struct {
+		cfg  Config
+		body string
+	}
+	type want struct {
+		req     request
+		content string
+		err     error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"DefaultsToOpenAI": {
+			reason: "OpenAI should be used if no provider is supplied.",
+			args: args{
+				cfg:  Config{APIKey: "key"},
+				body: openAIResponse,
+			},
+			want: want{
+				req:     request{Method: http.MethodPost, Path: "/chat/completions", Auth: "Authorization: Bearer key", Model: DefaultOpenAIModel},
+				content: "hello",
+			},
+		},
+		"OpenAI": {
+			reason: "An OpenAI compatible endpoint should be called using the supplied model.",
+			args: args{
+				cfg:  Config{Provider: OpenAI, APIKey: "key", Model: "gpt-4o"},
+				body: openAIResponse,
+			},
+			want: want{
+				req:     request{Method: http.MethodPost, Path: "/chat/completions", Auth: "Authorization: Bearer key", Model: "gpt-4o"},
+				content: "hello",
+			},
+		},
+		"AzureOpenAI": {
+			reason: "Azure OpenAI should be called using the supplied deployment and API version.",
+			args: args{
+				cfg:  Config{Provider: AzureOpenAI, APIKey: "key", Deployment: "my-gpt", APIVersion: "2024-10-21"},
+				body: openAIResponse,
+			},
+			want: want{
+				req:     request{Method: http.MethodPost, Path: "/openai/deployments/my-gpt/chat/completions", Query: "api-version=2024-10-21", Auth: "api-key: key", Model: "my-gpt"},
+				content: "hello",
+			},
+		},
+		"AzureOpenAIMissingAPIVersion": {
+			reason: "Azure OpenAI requires an API version.",
+			args: args{
+				cfg: Config{Provider: AzureOpenAI, APIKey: "key", Deployment: "my-gpt"},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"Anthropic": {
+			reason: "Anthropic should be called using the supplied model.",
+			args: args{
+				cfg:  Config{Provider: Anthropic, APIKey: "key", Model: "claude"},
+				body: anthropicResponse,
+			},
+			want: want{
+				req:     request{Method: http.MethodPost, Path: "/messages", Auth: "x-api-key: key", Model: "claude"},
+				content: "hello",
+			},
+		},
+		"AnthropicStructuredOutput": {
+			reason: "Anthropic doesn't support structured output.",
+			args: args{
+				cfg: Config{Provider: Anthropic, APIKey: "key", Schema: &Schema{Name: "s"}},
+			},
+			want: want{
+				err: ErrStructuredOutputUnsupported,
+			},
+		},
+		"Ollama": {
+			reason: "Ollama should be called using the default model.",
+			args: args{
+				cfg:  Config{Provider: Ollama},
+				body: ollamaResponse,
+			},
+			want: want{
+				req:     request{Method: http.MethodPost, Path: "/api/chat", Model: DefaultOllamaModel},
+				content: "hello",
+			},
+		},
+		"UnknownProvider": {
+			reason: "An unknown provider should return an error.",
+			args: args{
+				cfg: Config{Provider: "unknown"},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := request{}
+			srv := standIn(t, &got, tc.args.body)
+
+			cfg := tc.args.cfg
+			if cfg.BaseURL == "" && cfg.Provider != "unknown" {
+				cfg.BaseURL = srv.URL
+			}
+
+			m, err := NewRegistry().Model(cfg)
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Fatalf("\n%s\nModel(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+
+			content, err := llms.GenerateFromSinglePrompt(context.Background(), m, "hi")
+			if err != nil {
+				t.Fatalf("\n%s\nGenerateFromSinglePrompt(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.content, content); diff != "" {
+				t.Errorf("\n%s\nGenerateFromSinglePrompt(...): -want content, +got content:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.req, got); diff != "" {
+				t.Errorf("\n%s\nGenerateFromSinglePrompt(...): -want request, +got request:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWithProvider(t *testing.T) {
+	want := &llmsFake{}
+	r := NewRegistry(WithProvider("fake", ProviderFn(func(_ Config) (llms.Model, error) {
+		return want, nil
+	})))
+
+	got, err := r.Model(Config{Provider: "fake"})
+	if err != nil {
+		t.Fatalf("Model(...): %v", err)
+	}
+	if got != want {
+		t.Errorf("Model(...): want registered provider's model")
+	}
+}
+
+type llmsFake struct{ llms.Model }
+
+func TestModelName(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		want   string
+	}{
+		"Explicit": {
+			reason: "An explicit model should be used as is.",
+			cfg:    Config{Provider: Anthropic, Model: "claude-opus"},
+			want:   "claude-opus",
+		},
+		"DefaultProvider": {
+			reason: "The default provider's default model should be used if neither is set.",
+			cfg:    Config{},
+			want:   DefaultOpenAIModel,
+		},
+		"AzureDeployment": {
+			reason: "Azure OpenAI's deployment should be used if no model is set.",
+			cfg:    Config{Provider: AzureOpenAI, Deployment: "my-deployment"},
+			want:   "my-deployment",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, ModelName(tc.cfg)); diff != "" {
+				t.Errorf("%s\nModelName(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// Supported pipeline types.
+const (
+	PipelineComposition = "composition"
+	PipelineOperation   = "operation"
+)
+
+// Token types.
+const (
+	tokensPrompt     = "prompt"
+	tokensCompletion = "completion"
+)
+
+// Call results.
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+const namespace = "function_openai"
+
+// labelNames common to all metrics.
+var labelNames = []string{"model", "pipeline", "composite_kind"}
+
+// Labels of the metrics recorded for an invocation.
+type Labels struct {
+	// Model invoked.
+	Model string
+
+	// Pipeline the function is running in. Either composition or operation.
+	Pipeline string
+
+	// CompositeKind is the kind of the composite resource being composed.
+	// Empty in operation pipelines.
+	CompositeKind string
+}
+
+func (l Labels) values(extra ...string) []string {
+	return append([]string{l.Model, l.Pipeline, l.CompositeKind}, extra...)
+}
+
+// A Price of a model, in USD per million tokens.
+type Price struct {
+	// Prompt tokens, in USD per million tokens.
+	Prompt float64 `json:"prompt"`
+
+	// Completion tokens, in USD per million tokens.
+	Completion float64 `json:"completion"`
+}
+
+// Prices of models, keyed by model name.
+type Prices map[string]Price
+
+// LoadPrices loads a price table from the supplied YAML or JSON file. The file
+// is a map of model name to price. For example:
+//
+//	gpt-4o:
+//	  prompt: 2.50
+//	  completion: 10.00
+func LoadPrices(path string) (Prices, error) {
+	b, err := os.ReadFile(path) //nolint:gosec // Reading this file is intended.
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read price table %q", path)
+	}
+	p := Prices{}
+	return p, errors.Wrapf(yaml.Unmarshal(b, &p), "cannot parse price table %q", path)
+}
+
+// Metrics about the function's use of LLMs. A nil *Metrics records nothing.
+type Metrics struct {
+	prices Prices
+
+	calls         *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	tokens        *prometheus.CounterVec
+	cost          *prometheus.CounterVec
+	toolCalls     *prometheus.CounterVec
+	iterations    *prometheus.HistogramVec
+	parseFailures *prometheus.CounterVec
+}
+
+// An Option modifies the underlying Metrics.
+type Option func(*Metrics)
+
+// WithPrices estimates the cost of LLM calls using the supplied prices. Cost
+// isn't estimated for models without a price.
+func WithPrices(p Prices) Option {
+	return func(m *Metrics) {
+		m.prices = p
+	}
+}
+
+// New returns Metrics registered with the supplied registerer.
+func New(r prometheus.Registerer, opts ...Option) (*Metrics, error) {
+	m := &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_calls_total",
+			Help:      "Number of calls made to LLMs, by result.",
+		}, append(labelNames, "result")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "llm_call_duration_seconds",
+			Help:      "How long calls to LLMs take.",
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+		}, labelNames),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_tokens_total",
+			Help:      "Number of tokens used by calls to LLMs, by type (prompt or completion).",
+		}, append(labelNames, "type")),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_estimated_cost_usd_total",
+			Help:      "Estimated cost of calls to LLMs, in USD, according to the configured price table.",
+		}, labelNames),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tool_calls_total",
+			Help:      "Number of tools invoked by agents, by tool.",
+		}, append(labelNames, "tool")),
+		iterations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "agent_iterations",
+			Help:      "Number of LLM calls an agent makes to respond to a prompt.",
+			Buckets:   []float64{1, 2, 3, 5, 8, 13, 20},
+		}, labelNames),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "parse_failures_total",
+			Help:      "Number of LLM responses that couldn't be parsed.",
+		}, labelNames),
+	}
+	for _, o := range opts {
+		o(m)
+	}
+
+	for _, c := range []prometheus.Collector{m.calls, m.latency, m.tokens, m.cost, m.toolCalls, m.iterations, m.parseFailures} {
+		if err := r.Register(c); err != nil {
+			return nil, errors.Wrap(err, "cannot register metric")
+		}
+	}
+	return m, nil
+}
+
+// ParseFailure records that a response couldn't be parsed.
+func (m *Metrics) ParseFailure(l Labels) {
+	if m == nil {
+		return
+	}
+	m.parseFailures.WithLabelValues(l.values()...).Inc()
+}
+
+// An Invocation records metrics about a single agent invocation.
+type Invocation struct {
+	m     *Metrics
+	l     Labels
+	calls int
+}
+
+// Invocation returns an Invocation recording metrics with the supplied labels.
+func (m *Metrics) Invocation(l Labels) *Invocation {
+	return &Invocation{m: m, l: l}
+}
+
+// Model wraps the supplied model, recording metrics about each call to it.
+func (i *Invocation) Model(model llms.Model) llms.Model { //nolint:ireturn // Wrapping the interface is the point.
+	if i.m == nil {
+		return model
+	}
+	return &instrumentedModel{Model: model, i: i}
+}
+
+// Handler returns an agent callbacks handler that records tool invocations.
+func (i *Invocation) Handler() callbacks.Handler { //nolint:ireturn // Satisfying the interface is the point.
+	return &handler{i: i}
+}
+
+// Done records the number of agent iterations the invocation took.
+func (i *Invocation) Done() {
+	if i.m == nil || i.calls == 0 {
+		return
+	}
+	i.m.iterations.WithLabelValues(i.l.values()...).Observe(float64(i.calls))
+}
+
+type instrumentedModel struct {
+	llms.Model
+	i *Invocation
+}
+
+// GenerateContent calls the wrapped model, recording the call, its latency and
+// its token usage.
+func (m *instrumentedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	start := time.Now()
+	rsp, err := m.Model.GenerateContent(ctx, messages, opts...)
+	m.i.calls++
+
+	mt, l := m.i.m, m.i.l
+	mt.latency.WithLabelValues(l.values()...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		mt.calls.WithLabelValues(l.values(resultError)...).Inc()
+		return rsp, err
+	}
+	mt.calls.WithLabelValues(l.values(resultSuccess)...).Inc()
+
+	prompt, completion := llm.Usage(rsp)
+	mt.tokens.WithLabelValues(l.values(tokensPrompt)...).Add(float64(prompt))
+	mt.tokens.WithLabelValues(l.values(tokensCompletion)...).Add(float64(completion))
+	if p, ok := mt.prices[l.Model]; ok {
+		mt.cost.WithLabelValues(l.values()...).Add((float64(prompt)*p.Prompt + float64(completion)*p.Completion) / 1e6)
+	}
+	return rsp, nil
+}
+
+type handler struct {
+	callbacks.SimpleHandler
+	i *Invocation
+}
+
+// HandleAgentAction records the tool the agent invokes.
+func (h *handler) HandleAgentAction(_ context.Context, a schema.AgentAction) {
+	if h.i.m == nil {
+		return
+	}
+	h.i.m.toolCalls.WithLabelValues(h.i.l.values(a.Tool)...).Inc()
+}
+
+// Serve the metrics gathered by the supplied gatherer at /metrics on the
+// supplied address. It returns once the address is listening, or if it can't
+// be listened on.
+func Serve(address string, g prometheus.Gatherer) error {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "cannot listen for metrics requests at %q", address)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(lis) //nolint:errcheck // The server runs until the function exits.
+	return nil
+}
@@ -0,0 +1,185 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// model is a stand-in llms.Model that responds with the supplied generation
+// info, or error.
+type model struct {
+	llms.Model
+	info map[string]any
+	err  error
+}
+
+func (m *model) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "hello", GenerationInfo: m.info}}}, nil
+}
+
+func TestInvocation(t *testing.T) {
+	l := Labels{Model: "gpt-4o", Pipeline: PipelineComposition, CompositeKind: "XBucket"}
+
+	type call struct {
+		info map[string]any
+		err  error
+	}
+
+	type want struct {
+		metrics string
+	}
+
+	cases := map[string]struct {
+		reason string
+		calls  []call
+		tools  []string
+		want   want
+	}{
+		"OpenAI": {
+			reason: "Token usage reported by OpenAI compatible providers should be recorded and priced.",
+			calls: []call{
+				{info: map[string]any{"PromptTokens": 1000, "CompletionTokens": 500}},
+				{info: map[string]any{"PromptTokens": 3000, "CompletionTokens": 500}},
+			},
+			tools: []string{"get-bucket"},
+			want: want{metrics: `
+# HELP function_openai_agent_iterations Number of LLM calls an agent makes to respond to a prompt.
+# TYPE function_openai_agent_iterations histogram
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="1"} 0
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="2"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="3"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="5"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="8"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="13"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="20"} 1
+function_openai_agent_iterations_bucket{composite_kind="XBucket",model="gpt-4o",pipeline="composition",le="+Inf"} 1
+function_openai_agent_iterations_sum{composite_kind="XBucket",model="gpt-4o",pipeline="composition"} 2
+function_openai_agent_iterations_count{composite_kind="XBucket",model="gpt-4o",pipeline="composition"} 1
+# HELP function_openai_llm_calls_total Number of calls made to LLMs, by result.
+# TYPE function_openai_llm_calls_total counter
+function_openai_llm_calls_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",result="success"} 2
+# HELP function_openai_llm_estimated_cost_usd_total Estimated cost of calls to LLMs, in USD, according to the configured price table.
+# TYPE function_openai_llm_estimated_cost_usd_total counter
+function_openai_llm_estimated_cost_usd_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition"} 0.02
+# HELP function_openai_llm_tokens_total Number of tokens used by calls to LLMs, by type (prompt or completion).
+# TYPE function_openai_llm_tokens_total counter
+function_openai_llm_tokens_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",type="completion"} 1000
+function_openai_llm_tokens_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",type="prompt"} 4000
+# HELP function_openai_tool_calls_total Number of tools invoked by agents, by tool.
+# TYPE function_openai_tool_calls_total counter
+function_openai_tool_calls_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",tool="get-bucket"} 1
+`},
+		},
+		"Anthropic": {
+			reason: "Token usage reported by Anthropic should be recorded.",
+			calls: []call{
+				{info: map[string]any{"InputTokens": 10, "OutputTokens": 20}},
+			},
+			want: want{metrics: `
+# HELP function_openai_llm_tokens_total Number of tokens used by calls to LLMs, by type (prompt or completion).
+# TYPE function_openai_llm_tokens_total counter
+function_openai_llm_tokens_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",type="completion"} 20
+function_openai_llm_tokens_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",type="prompt"} 10
+`},
+		},
+		"Error": {
+			reason: "Failed calls should be recorded as errors.",
+			calls: []call{
+				{err: errors.New("boom")},
+			},
+			want: want{metrics: `
+# HELP function_openai_llm_calls_total Number of calls made to LLMs, by result.
+# TYPE function_openai_llm_calls_total counter
+function_openai_llm_calls_total{composite_kind="XBucket",model="gpt-4o",pipeline="composition",result="error"} 1
+`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := prometheus.NewRegistry()
+			m, err := New(r, WithPrices(Prices{"gpt-4o": {Prompt: 2.5, Completion: 10}}))
+			if err != nil {
+				t.Fatalf("New(...): %v", err)
+			}
+
+			inv := m.Invocation(l)
+			for _, c := range tc.calls {
+				_, _ = inv.Model(&model{info: c.info, err: c.err}).GenerateContent(t.Context(), nil)
+			}
+			for _, tool := range tc.tools {
+				inv.Handler().HandleAgentAction(t.Context(), schema.AgentAction{Tool: tool})
+			}
+			inv.Done()
+
+			names := make([]string, 0)
+			for _, line := range strings.Split(tc.want.metrics, "\n") {
+				if n, ok := strings.CutPrefix(line, "# TYPE "); ok {
+					names = append(names, strings.Fields(n)[0])
+				}
+			}
+			if err := testutil.GatherAndCompare(r, strings.NewReader(tc.want.metrics), names...); err != nil {
+				t.Errorf("%s\nGatherAndCompare(...): %v", tc.reason, err)
+			}
+		})
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	want := &model{info: map[string]any{"PromptTokens": 1}}
+
+	inv := m.Invocation(Labels{})
+	if got := inv.Model(want); got != want {
+		t.Errorf("Model(...): want the model unwrapped when metrics are disabled, got %T", got)
+	}
+	inv.Handler().HandleAgentAction(t.Context(), schema.AgentAction{Tool: "tool"})
+	inv.Done()
+	m.ParseFailure(Labels{})
+}
+
+func TestLoadPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.yaml")
+	if err := os.WriteFile(path, []byte("gpt-4o:\n  prompt: 2.5\n  completion: 10\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadPrices(path)
+	if err != nil {
+		t.Fatalf("LoadPrices(...): %v", err)
+	}
+	want := Prices{"gpt-4o": {Prompt: 2.5, Completion: 10}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadPrices(...): -want, +got:\n%s", diff)
+	}
+}
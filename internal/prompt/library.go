@@ -0,0 +1,143 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package prompt
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// Keys of a template, whether in a file or a ConfigMap's data.
+const (
+	KeySystemPrompt = "systemPrompt"
+	KeyUserPrompt   = "userPrompt"
+)
+
+//go:embed templates/*.yaml
+var builtin embed.FS
+
+// A Template is a named pair of prompts.
+type Template struct {
+	// SystemPrompt to send to the model.
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+
+	// UserPrompt to send to the model. It's rendered as a Go template.
+	UserPrompt string `json:"userPrompt,omitempty"`
+}
+
+// A Library of templates, keyed by name.
+type Library map[string]Template
+
+// Builtin returns the templates built into the function.
+func Builtin() Library {
+	l, err := load(builtin, "templates")
+	if err != nil {
+		// The builtin templates are embedded at build time, and tested.
+		panic(err)
+	}
+	return l
+}
+
+// LoadDir loads templates from the supplied directory. Each template is a
+// YAML file with systemPrompt and userPrompt keys. The template is named
+// after the file, without its .yaml or .yml extension.
+func LoadDir(dir string) (Library, error) {
+	return load(os.DirFS(dir), ".")
+}
+
+func load(fsys fs.FS, dir string) (Library, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read template directory %q", dir)
+	}
+
+	l := Library{}
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read template %q", e.Name())
+		}
+		t := Template{}
+		if err := yaml.Unmarshal(b, &t); err != nil {
+			return nil, errors.Wrapf(err, "cannot parse template %q", e.Name())
+		}
+		l[strings.TrimSuffix(e.Name(), ext)] = t
+	}
+	return l, nil
+}
+
+// FromConfigMaps returns a library of the templates found in the supplied
+// objects. Any ConfigMap with a systemPrompt or userPrompt data key is a
+// template, named after the ConfigMap. Other objects are ignored.
+func FromConfigMaps(objs []map[string]any) Library {
+	l := Library{}
+	for _, o := range objs {
+		if o["apiVersion"] != "v1" || o["kind"] != "ConfigMap" {
+			continue
+		}
+		data, _ := o["data"].(map[string]any)
+		sp, _ := data[KeySystemPrompt].(string)
+		up, _ := data[KeyUserPrompt].(string)
+		if sp == "" && up == "" {
+			continue
+		}
+		meta, _ := o["metadata"].(map[string]any)
+		name, _ := meta["name"].(string)
+		l[name] = Template{SystemPrompt: sp, UserPrompt: up}
+	}
+	return l
+}
+
+// Lookup returns the named template from the first of the supplied libraries
+// that has it.
+func Lookup(name string, libs ...Library) (Template, bool) {
+	for _, l := range libs {
+		if t, ok := l[name]; ok {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// Names returns the sorted, unique names of the templates in the supplied
+// libraries.
+func Names(libs ...Library) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0)
+	for _, l := range libs {
+		for name := range l {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,139 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuiltin(t *testing.T) {
+	l := Builtin()
+	for _, name := range []string{"compose-resources", "operations-remediation"} {
+		tmpl, ok := l[name]
+		if !ok {
+			t.Errorf("Builtin(): missing template %q", name)
+			continue
+		}
+		if tmpl.SystemPrompt == "" || tmpl.UserPrompt == "" {
+			t.Errorf("Builtin(): template %q is missing a prompt", name)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":  "systemPrompt: A system\nuserPrompt: A user\n",
+		"b.yml":   "userPrompt: B user\n",
+		"c.txt":   "ignored",
+		"d/e.yml": "userPrompt: ignored\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir(...): %v", err)
+	}
+	want := Library{
+		"a": {SystemPrompt: "A system", UserPrompt: "A user"},
+		"b": {UserPrompt: "B user"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadDir(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestFromConfigMaps(t *testing.T) {
+	objs := []map[string]any{
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "template"},
+			"data":       map[string]any{"systemPrompt": "system", "userPrompt": "user"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "not-a-template"},
+			"data":       map[string]any{"foo": "bar"},
+		},
+		{
+			"apiVersion": "example.org/v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "wrong-group"},
+			"data":       map[string]any{"userPrompt": "user"},
+		},
+	}
+
+	want := Library{"template": {SystemPrompt: "system", UserPrompt: "user"}}
+	if diff := cmp.Diff(want, FromConfigMaps(objs)); diff != "" {
+		t.Errorf("FromConfigMaps(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	first := Library{"a": {UserPrompt: "first"}}
+	second := Library{"a": {UserPrompt: "second"}, "b": {UserPrompt: "second"}}
+
+	cases := map[string]struct {
+		reason string
+		name   string
+		want   Template
+		ok     bool
+	}{
+		"Precedence": {
+			reason: "The template should be returned from the first library that has it.",
+			name:   "a",
+			want:   Template{UserPrompt: "first"},
+			ok:     true,
+		},
+		"Fallback": {
+			reason: "Later libraries should be searched if earlier ones don't have the template.",
+			name:   "b",
+			want:   Template{UserPrompt: "second"},
+			ok:     true,
+		},
+		"Missing": {
+			reason: "An unknown template should not be found.",
+			name:   "c",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := Lookup(tc.name, first, second)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nLookup(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.ok, ok); diff != "" {
+				t.Errorf("\n%s\nLookup(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
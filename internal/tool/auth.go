@@ -0,0 +1,122 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// redacted replaces Auth when it's formatted, so that secrets aren't logged.
+const redacted = "[redacted]"
+
+// Auth configures how a client authenticates to an MCP server. Auth formats
+// as [redacted], so that its secrets aren't logged.
+type Auth struct {
+	// Headers sent with every request to the server.
+	Headers map[string]string
+
+	// BearerToken sent in the Authorization header of every request to the
+	// server.
+	BearerToken string
+
+	// CA certificates trusted to verify the server's certificate, PEM
+	// encoded. The system's certificate authorities are trusted if empty.
+	CA []byte
+
+	// Cert and Key of the client certificate presented to the server, PEM
+	// encoded.
+	Cert []byte
+	Key  []byte
+}
+
+// String returns [redacted].
+func (a Auth) String() string { return redacted }
+
+// GoString returns [redacted].
+func (a Auth) GoString() string { return redacted }
+
+// IsZero returns true if the Auth doesn't configure authentication.
+func (a Auth) IsZero() bool {
+	return len(a.Headers) == 0 && a.BearerToken == "" && len(a.CA) == 0 && len(a.Cert) == 0 && len(a.Key) == 0
+}
+
+// Valid returns no error if the Auth is valid.
+func (a Auth) Valid() error {
+	if (len(a.Cert) == 0) != (len(a.Key) == 0) {
+		return errors.New("invalid mcp config: a client certificate and key must be supplied together")
+	}
+	if _, err := a.tlsConfig(); err != nil {
+		return errors.Wrap(err, "invalid mcp config")
+	}
+	return nil
+}
+
+// headers returns the headers to send with every request, including any
+// bearer token.
+func (a Auth) headers() map[string]string {
+	if len(a.Headers) == 0 && a.BearerToken == "" {
+		return nil
+	}
+	h := make(map[string]string, len(a.Headers)+1)
+	for k, v := range a.Headers {
+		h[k] = v
+	}
+	if a.BearerToken != "" {
+		h["Authorization"] = "Bearer " + a.BearerToken
+	}
+	return h
+}
+
+// httpClient returns an HTTP client that uses the Auth's TLS configuration,
+// or nil if it doesn't configure TLS.
+func (a Auth) httpClient() (*http.Client, error) {
+	cfg, err := a.tlsConfig()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // The default transport is always an *http.Transport.
+	t.TLSClientConfig = cfg
+	return &http.Client{Transport: t}, nil
+}
+
+// tlsConfig returns the Auth's TLS configuration, or nil if it doesn't
+// configure TLS. Errors never include the supplied certificates or key.
+func (a Auth) tlsConfig() (*tls.Config, error) {
+	if len(a.CA) == 0 && len(a.Cert) == 0 {
+		return nil, nil //nolint:nilnil // No TLS configuration isn't an error.
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(a.CA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(a.CA) {
+			return nil, errors.New("cannot parse CA certificates")
+		}
+		cfg.RootCAs = pool
+	}
+	if len(a.Cert) > 0 {
+		cert, err := tls.X509KeyPair(a.Cert, a.Key)
+		if err != nil {
+			return nil, errors.New("cannot parse client certificate and key")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
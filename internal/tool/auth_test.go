@@ -0,0 +1,126 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAuthHeaders(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		auth   Auth
+		want   map[string]string
+	}{
+		"None": {
+			reason: "No headers should be sent if none are configured.",
+		},
+		"HeadersAndBearerToken": {
+			reason: "A bearer token should be sent in the Authorization header, along with any other headers.",
+			auth:   Auth{Headers: map[string]string{"X-Tenant": "acme"}, BearerToken: "s3cr3t"},
+			want:   map[string]string{"X-Tenant": "acme", "Authorization": "Bearer s3cr3t"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.auth.headers()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nheaders(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAuthValid(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		auth   Auth
+		want   error
+	}{
+		"None": {
+			reason: "No authentication is valid.",
+		},
+		"CertWithoutKey": {
+			reason: "A client certificate without a key is invalid.",
+			auth:   Auth{Cert: []byte("cert")},
+			want:   cmpopts.AnyError,
+		},
+		"InvalidCA": {
+			reason: "CA certificates that can't be parsed are invalid.",
+			auth:   Auth{CA: []byte("not a certificate")},
+			want:   cmpopts.AnyError,
+		},
+		"InvalidKeyPair": {
+			reason: "A client certificate and key that can't be parsed are invalid.",
+			auth:   Auth{Cert: []byte("cert"), Key: []byte("key")},
+			want:   cmpopts.AnyError,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.auth.Valid()
+			if diff := cmp.Diff(tc.want, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nValid(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAuthRedacted(t *testing.T) {
+	cfg := Config{Transport: SSE, BaseURL: "http://docs", Auth: Auth{Headers: map[string]string{"X-API-Key": "k3y"}, BearerToken: "s3cr3t", Key: []byte("key")}}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		got := fmt.Sprintf(format, cfg)
+		for _, secret := range []string{"k3y", "s3cr3t", "key"} {
+			if strings.Contains(got, secret) {
+				t.Errorf("Sprintf(%q, cfg): %q contains secret %q", format, got, secret)
+			}
+		}
+	}
+}
+
+func TestAuthHTTPClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	hc, err := Auth{CA: ca}.httpClient()
+	if err != nil {
+		t.Fatalf("httpClient(): %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := hc.Do(req)
+	if err != nil {
+		t.Fatalf("Do(...): a client that trusts the server's CA should connect: %v", err)
+	}
+	_ = rsp.Body.Close()
+}
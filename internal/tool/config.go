@@ -16,12 +16,42 @@
 
 package tool
 
-import "github.com/crossplane/function-sdk-go/errors"
+import (
+	"path"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
 
 // Config represents an MCP toplevel configuration.
 type Config struct {
 	Transport Transport `json:"transport"`
 	BaseURL   string    `json:"baseURL"`
+
+	// Command that runs a stdio server, the Args it's run with, and
+	// environment variables, in KEY=VALUE form, set in addition to the
+	// function's own.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Env     []string `json:"env,omitempty"`
+
+	// AllowedTools the agent may call, as names or globs. All of the
+	// server's tools may be called if empty.
+	AllowedTools []string `json:"allowedTools,omitempty"`
+
+	// DeniedTools the agent may not call, as names or globs. Takes
+	// precedence over AllowedTools.
+	DeniedTools []string `json:"deniedTools,omitempty"`
+
+	// Arguments constrains the arguments the agent may call tools with.
+	Arguments []ArgumentPolicy `json:"-"`
+
+	// ReadOnly only allows the agent to call tools the server annotates as
+	// read-only.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// Auth used to connect to the server. Never serialized.
+	Auth Auth `json:"-"`
 }
 
 // Transport defines specific transport types that are supported.
@@ -32,18 +62,134 @@ var (
 	SSE Transport = "sse"
 	// StreamableHTTP represents Streamable HTTP.
 	StreamableHTTP Transport = "http-stream"
+	// Stdio represents a server run as a subprocess of the function, that
+	// communicates over its standard input and output.
+	Stdio Transport = "stdio"
 )
 
+// Merge the supplied Configs. Each field takes its value from the first of the
+// supplied Configs that sets it.
+func Merge(cfgs ...Config) Config {
+	out := Config{}
+	for _, c := range cfgs {
+		if out.Transport == "" {
+			out.Transport = c.Transport
+		}
+		if out.BaseURL == "" {
+			out.BaseURL = c.BaseURL
+		}
+		if out.Command == "" {
+			out.Command = c.Command
+		}
+		if len(out.Args) == 0 {
+			out.Args = c.Args
+		}
+		if len(out.Env) == 0 {
+			out.Env = c.Env
+		}
+		if len(out.AllowedTools) == 0 {
+			out.AllowedTools = c.AllowedTools
+		}
+		if len(out.DeniedTools) == 0 {
+			out.DeniedTools = c.DeniedTools
+		}
+		if len(out.Arguments) == 0 {
+			out.Arguments = c.Arguments
+		}
+		out.ReadOnly = out.ReadOnly || c.ReadOnly
+		if out.Auth.IsZero() {
+			out.Auth = c.Auth
+		}
+	}
+	return out
+}
+
+// FromResource derives a Config from the supplied Kubernetes resource. A
+// ConfigMap configures a server using its transport, baseURL, allowedTools,
+// deniedTools and readOnly data keys, with tools separated by commas. Other
+// resources configure a server using the same fields of their spec.
+func FromResource(obj map[string]any) Config {
+	if obj["apiVersion"] == "v1" && obj["kind"] == "ConfigMap" {
+		data, _ := obj["data"].(map[string]any)
+		transport, _ := data["transport"].(string)
+		baseURL, _ := data["baseURL"].(string)
+		allowed, _ := data["allowedTools"].(string)
+		denied, _ := data["deniedTools"].(string)
+		readOnly, _ := data["readOnly"].(string)
+		return Config{
+			Transport:    Transport(transport),
+			BaseURL:      baseURL,
+			AllowedTools: splitList(allowed),
+			DeniedTools:  splitList(denied),
+			ReadOnly:     strings.EqualFold(readOnly, "true"),
+		}
+	}
+
+	spec, _ := obj["spec"].(map[string]any)
+	transport, _ := spec["transport"].(string)
+	baseURL, _ := spec["baseURL"].(string)
+	readOnly, _ := spec["readOnly"].(bool)
+	return Config{
+		Transport:    Transport(transport),
+		BaseURL:      baseURL,
+		AllowedTools: stringList(spec["allowedTools"]),
+		DeniedTools:  stringList(spec["deniedTools"]),
+		ReadOnly:     readOnly,
+	}
+}
+
+// splitList returns the non-empty elements of the supplied comma separated
+// list.
+func splitList(l string) []string {
+	var out []string
+	for _, e := range strings.Split(l, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// stringList returns the non-empty strings of the supplied array.
+func stringList(v any) []string {
+	l, _ := v.([]any)
+	var out []string
+	for _, e := range l {
+		if s, ok := e.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 // Valid returns no error if the provided Config is valid.
 func (c Config) Valid() error {
+	for _, g := range append(append([]string{}, c.AllowedTools...), c.DeniedTools...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return errors.Wrapf(err, "invalid mcp config: invalid tool glob %q", g)
+		}
+	}
+	for _, p := range c.Arguments {
+		if err := p.valid(); err != nil {
+			return errors.Wrap(err, "invalid mcp config")
+		}
+	}
+
+	if c.Transport == Stdio {
+		if len(c.Command) == 0 {
+			return errors.New("invalid mcp config: command required")
+		}
+		return nil
+	}
+
 	if len(c.BaseURL) == 0 {
 		return errors.New("invalid mcp config: baseURL required")
 	}
 
 	switch c.Transport {
 	case SSE, StreamableHTTP:
-		return nil
+		return c.Auth.Valid()
 	default:
-		return errors.New("invalid mcp config: transport must be one of 'sse' or 'http-stream")
+		return errors.New("invalid mcp config: transport must be one of 'sse', 'http-stream' or 'stdio'")
 	}
 }
@@ -38,6 +38,18 @@ func TestValidate(t *testing.T) {
 	}{
 		"InvalidIncorrectTransport": {
 			reason: "If an invalid transport is supplied, validation should fail.",
+			args: args{
+				config: Config{
+					Transport: "websocket",
+					BaseURL:   "./local",
+				},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"InvalidStdioNoCommand": {
+			reason: "If a stdio config without a command is supplied, validation should fail.",
 			args: args{
 				config: Config{
 					Transport: "stdio",
@@ -48,6 +60,15 @@ func TestValidate(t *testing.T) {
 				err: cmpopts.AnyError,
 			},
 		},
+		"ValidConfigStdio": {
+			reason: "If a valid stdio config is supplied, no error should be returned.",
+			args: args{
+				config: Config{
+					Transport: "stdio",
+					Command:   "/usr/local/bin/kubectl-mcp",
+				},
+			},
+		},
 		"InvalidBadBaseURL": {
 			reason: "If an invalid baseURL is supplied, validation should fail.",
 			args: args{
@@ -60,6 +81,45 @@ func TestValidate(t *testing.T) {
 				err: cmpopts.AnyError,
 			},
 		},
+		"InvalidToolGlob": {
+			reason: "If an invalid tool glob is supplied, validation should fail.",
+			args: args{
+				config: Config{
+					Transport:   "sse",
+					BaseURL:     "http://localhost/sse",
+					DeniedTools: []string{"delete-["},
+				},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"InvalidArgumentRule": {
+			reason: "If an argument rule that doesn't evaluate to a bool is supplied, validation should fail.",
+			args: args{
+				config: Config{
+					Transport: "sse",
+					BaseURL:   "http://localhost/sse",
+					Arguments: []ArgumentPolicy{{Tool: "*", Rule: "args.namespace"}},
+				},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
+		"InvalidEmptyArgumentPolicy": {
+			reason: "If an argument policy with neither a schema nor a rule is supplied, validation should fail.",
+			args: args{
+				config: Config{
+					Transport: "sse",
+					BaseURL:   "http://localhost/sse",
+					Arguments: []ArgumentPolicy{{Tool: "get-*"}},
+				},
+			},
+			want: want{
+				err: cmpopts.AnyError,
+			},
+		},
 		"ValidConfigSSE": {
 			reason: "If a valid SSE config is supplied, no error should be returned.",
 			args: args{
@@ -90,3 +150,51 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestFromResource(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		obj    map[string]any
+		want   Config
+	}{
+		"ConfigMap": {
+			reason: "A ConfigMap's data should configure a server, with its allowed and denied tools separated by commas.",
+			obj: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"data": map[string]any{
+					"transport":    "sse",
+					"baseURL":      "http://docs",
+					"allowedTools": "read-docs, list-docs,",
+					"deniedTools":  "delete-*",
+					"readOnly":     "true",
+				},
+			},
+			want: Config{Transport: SSE, BaseURL: "http://docs", AllowedTools: []string{"read-docs", "list-docs"}, DeniedTools: []string{"delete-*"}, ReadOnly: true},
+		},
+		"Spec": {
+			reason: "Any other resource's spec should configure a server.",
+			obj: map[string]any{
+				"apiVersion": "mcp.example.org/v1",
+				"kind":       "MCPServer",
+				"spec": map[string]any{
+					"transport":    "http-stream",
+					"baseURL":      "http://search",
+					"allowedTools": []any{"search"},
+					"deniedTools":  []any{"delete-*"},
+					"readOnly":     true,
+				},
+			},
+			want: Config{Transport: StreamableHTTP, BaseURL: "http://search", AllowedTools: []string{"search"}, DeniedTools: []string{"delete-*"}, ReadOnly: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := FromResource(tc.obj)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nFromResource(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
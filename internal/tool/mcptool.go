@@ -0,0 +1,95 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+// callTimeout is how long a server has to respond to a tool call.
+const callTimeout = 30 * time.Second
+
+// A caller calls tools served by an MCP server.
+type caller interface {
+	CallTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
+// An mcpTool is a tool served by an MCP server. Calls are checked against the
+// server's argument policies before they're made. Errors, including denied
+// calls, are returned to the agent as the tool's output so it may correct
+// them.
+type mcpTool struct {
+	tool   mcp.Tool
+	client caller
+	cfg    Config
+	log    logging.Logger
+}
+
+// Name of the tool.
+func (t *mcpTool) Name() string {
+	return t.tool.Name
+}
+
+// Description of the tool, including its input schema.
+func (t *mcpTool) Description() string {
+	schema, _ := json.Marshal(t.tool.InputSchema)
+	return t.tool.Description + "\n The input schema is: " + string(schema)
+}
+
+// Call the tool with the supplied JSON arguments.
+func (t *mcpTool) Call(ctx context.Context, input string) (string, error) {
+	args := map[string]any{}
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "call the tool error: input must be valid json, retry tool calling with correct json", nil
+	}
+
+	if err := t.cfg.CheckArguments(t.tool.Name, args); err != nil {
+		t.log.Info("denied tool call", "tool", t.tool.Name, "reason", err.Error())
+		return fmt.Sprintf("call the tool error: call denied by policy: %s", err), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = t.tool.Name
+	req.Params.Arguments = args
+	rsp, err := t.client.CallTool(ctx, req)
+	if err != nil {
+		return fmt.Sprintf("call the tool error: %s", err), nil
+	}
+
+	texts := make([]string, 0, len(rsp.Content))
+	for _, c := range rsp.Content {
+		if tc, ok := c.(mcp.TextContent); ok {
+			texts = append(texts, tc.Text)
+		}
+	}
+	out := strings.Join(texts, "\n")
+	if rsp.IsError {
+		return "call the tool error: " + out, nil
+	}
+	return out, nil
+}
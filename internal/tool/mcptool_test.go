@@ -0,0 +1,125 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+// fakeCaller is a stand-in caller that records the tool calls it's asked to
+// make, and returns the supplied result, or error.
+type fakeCaller struct {
+	calls []string
+	rsp   *mcp.CallToolResult
+	err   error
+}
+
+func (c *fakeCaller) CallTool(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	c.calls = append(c.calls, req.Params.Name)
+	return c.rsp, c.err
+}
+
+func TestMCPToolCall(t *testing.T) {
+	policy := Config{Arguments: []ArgumentPolicy{{
+		Tool:    "get-*",
+		Rule:    "args.namespace != 'kube-system'",
+		Message: "kube-system is off limits",
+	}}}
+
+	type args struct {
+		cfg    Config
+		client *fakeCaller
+		input  string
+	}
+	type want struct {
+		out   string
+		calls []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Allowed": {
+			reason: "A call that satisfies the server's argument policies should be made.",
+			args: args{
+				cfg:    policy,
+				client: &fakeCaller{rsp: mcp.NewToolResultText("bucket")},
+				input:  `{"namespace":"default"}`,
+			},
+			want: want{out: "bucket", calls: []string{"get-bucket"}},
+		},
+		"Denied": {
+			reason: "A call that doesn't satisfy the server's argument policies should not be made, and the agent told why.",
+			args: args{
+				cfg:    policy,
+				client: &fakeCaller{rsp: mcp.NewToolResultText("bucket")},
+				input:  `{"namespace":"kube-system"}`,
+			},
+			want: want{out: "call the tool error: call denied by policy: kube-system is off limits"},
+		},
+		"InvalidInput": {
+			reason: "A call with arguments that aren't JSON should not be made.",
+			args: args{
+				client: &fakeCaller{},
+				input:  `namespace: default`,
+			},
+			want: want{out: "call the tool error: input must be valid json, retry tool calling with correct json"},
+		},
+		"ToolError": {
+			reason: "An error returned by the tool should be returned to the agent.",
+			args: args{
+				client: &fakeCaller{rsp: mcp.NewToolResultError("no such bucket")},
+				input:  `{}`,
+			},
+			want: want{out: "call the tool error: no such bucket", calls: []string{"get-bucket"}},
+		},
+		"CallError": {
+			reason: "An error calling the tool should be returned to the agent.",
+			args: args{
+				client: &fakeCaller{err: errors.New("boom")},
+				input:  `{}`,
+			},
+			want: want{out: "call the tool error: boom", calls: []string{"get-bucket"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			mt := &mcpTool{tool: mcp.NewTool("get-bucket"), client: tc.args.client, cfg: tc.args.cfg, log: logging.NewNopLogger()}
+
+			out, err := mt.Call(t.Context(), tc.args.input)
+			if err != nil {
+				t.Fatalf("%s\nCall(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.out, out); diff != "" {
+				t.Errorf("%s\nCall(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.calls, tc.args.client.calls); diff != "" {
+				t.Errorf("%s\nCall(...): -want calls, +got calls:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
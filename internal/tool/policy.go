@@ -0,0 +1,171 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/mark3labs/mcp-go/mcp"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+// An ArgumentPolicy constrains the arguments the agent may call tools with.
+type ArgumentPolicy struct {
+	// Tool the policy applies to, as a name or glob.
+	Tool string
+
+	// Schema the arguments must validate against, if any.
+	Schema *spec.Schema
+
+	// Rule is a CEL expression the arguments, available as args, must
+	// satisfy, if any.
+	Rule string
+
+	// Message explains why arguments that don't satisfy the policy are
+	// denied.
+	Message string
+}
+
+// matches returns true if the supplied name matches any of the supplied names
+// or globs. Invalid globs match nothing.
+func matches(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns true if the agent may call the named tool. Tools must match
+// one of the allowed tools, if any, and must not match any denied tools.
+func (c Config) Allows(tool string) bool {
+	if matches(c.DeniedTools, tool) {
+		return false
+	}
+	return len(c.AllowedTools) == 0 || matches(c.AllowedTools, tool)
+}
+
+// AllowsAnnotations returns true if the agent may call a tool with the
+// supplied annotations. Only tools annotated as read-only are allowed if the
+// Config requires it.
+func (c Config) AllowsAnnotations(a mcp.ToolAnnotation) bool {
+	return !c.ReadOnly || (a.ReadOnlyHint != nil && *a.ReadOnlyHint)
+}
+
+// CheckArguments returns an error explaining why the agent may not call the
+// named tool with the supplied arguments, if it may not.
+func (c Config) CheckArguments(tool string, args map[string]any) error {
+	for _, p := range c.Arguments {
+		if ok, _ := path.Match(p.Tool, tool); !ok {
+			continue
+		}
+		if err := p.check(args); err != nil {
+			if p.Message != "" {
+				return errors.New(p.Message)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// check the supplied arguments satisfy the policy.
+func (p ArgumentPolicy) check(args map[string]any) error {
+	if p.Schema != nil {
+		r := validate.NewSchemaValidator(p.Schema, nil, "", strfmt.Default).Validate(args)
+		if !r.IsValid() {
+			msgs := make([]string, 0, len(r.Errors))
+			for _, err := range r.Errors {
+				msgs = append(msgs, err.Error())
+			}
+			return errors.Errorf("arguments don't satisfy schema: %s", strings.Join(msgs, "; "))
+		}
+	}
+	if p.Rule != "" {
+		prg, err := program(p.Rule)
+		if err != nil {
+			return err
+		}
+		out, _, err := prg.Eval(map[string]any{"args": args})
+		if err != nil {
+			return errors.Wrapf(err, "cannot evaluate rule %q", p.Rule)
+		}
+		if out != types.True {
+			return errors.Errorf("arguments don't satisfy rule %q", p.Rule)
+		}
+	}
+	return nil
+}
+
+// valid returns no error if the policy is valid.
+func (p ArgumentPolicy) valid() error {
+	if _, err := path.Match(p.Tool, ""); err != nil {
+		return errors.Wrapf(err, "invalid tool glob %q", p.Tool)
+	}
+	if p.Schema == nil && p.Rule == "" {
+		return errors.Errorf("argument policy for tool %q must set a schema or a rule", p.Tool)
+	}
+	if p.Rule != "" {
+		if _, err := program(p.Rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	celEnv = sync.OnceValues(func() (*cel.Env, error) {
+		return cel.NewEnv(cel.Variable("args", cel.MapType(cel.StringType, cel.DynType)))
+	})
+
+	// programs caches compiled rules, keyed by rule.
+	programs sync.Map
+)
+
+// program returns the compiled CEL program for the supplied rule, which must
+// evaluate to a bool.
+func program(rule string) (cel.Program, error) { //nolint:ireturn // cel.Program is an interface.
+	if prg, ok := programs.Load(rule); ok {
+		return prg.(cel.Program), nil //nolint:forcetypeassert // We only store cel.Program.
+	}
+	env, err := celEnv()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create CEL environment")
+	}
+	ast, iss := env.Compile(rule)
+	if iss.Err() != nil {
+		return nil, errors.Wrapf(iss.Err(), "cannot compile rule %q", rule)
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, errors.Errorf("rule %q must evaluate to a bool", rule)
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot compile rule %q", rule)
+	}
+	programs.Store(rule, prg)
+	return prg, nil
+}
@@ -0,0 +1,182 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mark3labs/mcp-go/mcp"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/utils/ptr"
+)
+
+func TestAllows(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		tool   string
+		want   bool
+	}{
+		"NoAllowedTools": {
+			reason: "Every tool should be allowed if no allowed tools are configured.",
+			tool:   "search",
+			want:   true,
+		},
+		"Allowed": {
+			reason: "A configured tool should be allowed.",
+			cfg:    Config{AllowedTools: []string{"read-docs", "search"}},
+			tool:   "search",
+			want:   true,
+		},
+		"AllowedGlob": {
+			reason: "A tool matching a configured glob should be allowed.",
+			cfg:    Config{AllowedTools: []string{"get-*"}},
+			tool:   "get-bucket",
+			want:   true,
+		},
+		"NotAllowed": {
+			reason: "A tool that isn't configured should not be allowed.",
+			cfg:    Config{AllowedTools: []string{"read-docs"}},
+			tool:   "delete-docs",
+			want:   false,
+		},
+		"Denied": {
+			reason: "A denied tool should not be allowed, even if it's also allowed.",
+			cfg:    Config{AllowedTools: []string{"*"}, DeniedTools: []string{"delete-*"}},
+			tool:   "delete-bucket",
+			want:   false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.cfg.Allows(tc.tool)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nAllows(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAllowsAnnotations(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		a      mcp.ToolAnnotation
+		want   bool
+	}{
+		"NotRequired": {
+			reason: "A tool that isn't read-only should be allowed if read-only tools aren't required.",
+			a:      mcp.ToolAnnotation{ReadOnlyHint: ptr.To(false)},
+			want:   true,
+		},
+		"ReadOnly": {
+			reason: "A read-only tool should be allowed if read-only tools are required.",
+			cfg:    Config{ReadOnly: true},
+			a:      mcp.ToolAnnotation{ReadOnlyHint: ptr.To(true)},
+			want:   true,
+		},
+		"NotReadOnly": {
+			reason: "A tool that isn't read-only should not be allowed if read-only tools are required.",
+			cfg:    Config{ReadOnly: true},
+			a:      mcp.ToolAnnotation{ReadOnlyHint: ptr.To(false)},
+			want:   false,
+		},
+		"NotAnnotated": {
+			reason: "A tool that isn't annotated should not be allowed if read-only tools are required.",
+			cfg:    Config{ReadOnly: true},
+			want:   false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.cfg.AllowsAnnotations(tc.a)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nAllowsAnnotations(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheckArguments(t *testing.T) {
+	namespaced := &spec.Schema{SchemaProps: spec.SchemaProps{
+		Type:     spec.StringOrArray{"object"},
+		Required: []string{"namespace"},
+	}}
+
+	type args struct {
+		tool string
+		args map[string]any
+	}
+
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		args   args
+		want   error
+	}{
+		"NoPolicies": {
+			reason: "Any arguments should be allowed if no policies are configured.",
+			args:   args{tool: "get-bucket", args: map[string]any{"name": "a"}},
+		},
+		"OtherTool": {
+			reason: "Policies for other tools shouldn't apply.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "delete-*", Schema: namespaced}}},
+			args:   args{tool: "get-bucket", args: map[string]any{"name": "a"}},
+		},
+		"SchemaSatisfied": {
+			reason: "Arguments that validate against a policy's schema should be allowed.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "get-*", Schema: namespaced}}},
+			args:   args{tool: "get-bucket", args: map[string]any{"namespace": "default"}},
+		},
+		"SchemaNotSatisfied": {
+			reason: "Arguments that don't validate against a policy's schema should be denied.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "get-*", Schema: namespaced}}},
+			args:   args{tool: "get-bucket", args: map[string]any{"name": "a"}},
+			want:   cmpopts.AnyError,
+		},
+		"RuleSatisfied": {
+			reason: "Arguments that satisfy a policy's rule should be allowed.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "*", Rule: "args.namespace != 'kube-system'"}}},
+			args:   args{tool: "get-bucket", args: map[string]any{"namespace": "default"}},
+		},
+		"RuleNotSatisfied": {
+			reason: "Arguments that don't satisfy a policy's rule should be denied.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "*", Rule: "args.namespace != 'kube-system'"}}},
+			args:   args{tool: "get-bucket", args: map[string]any{"namespace": "kube-system"}},
+			want:   cmpopts.AnyError,
+		},
+		"RuleError": {
+			reason: "Arguments a policy's rule can't be evaluated against should be denied.",
+			cfg:    Config{Arguments: []ArgumentPolicy{{Tool: "*", Rule: "args.namespace != 'kube-system'"}}},
+			args:   args{tool: "get-bucket", args: map[string]any{}},
+			want:   cmpopts.AnyError,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.CheckArguments(tc.args.tool, tc.args.args)
+			if diff := cmp.Diff(tc.want, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nCheckArguments(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
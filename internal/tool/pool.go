@@ -0,0 +1,313 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+const (
+	// healthCheckInterval is how often a pooled session with a remote
+	// server is pinged. Sessions with stdio servers are pinged every time
+	// they're used, because it's cheap.
+	healthCheckInterval = 30 * time.Second
+
+	// pingTimeout is how long a server has to respond to a ping before its
+	// session is considered unhealthy.
+	pingTimeout = 5 * time.Second
+
+	// connectTimeout is how long a server has to respond to the initialize
+	// request once its session is started.
+	connectTimeout = 30 * time.Second
+
+	// stopTimeout is how long a stdio server has to exit once its session
+	// is closed, before it's killed.
+	stopTimeout = 5 * time.Second
+
+	// idleTimeout is how long a session may go unused before it's closed.
+	idleTimeout = 10 * time.Minute
+
+	// minBackoff and maxBackoff bound how long the Resolver waits before
+	// reconnecting to a server it failed to connect to. The wait doubles
+	// with each consecutive failure.
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// A session is a started and initialized client of an MCP server.
+type session struct {
+	client *mcpclient.Client
+
+	// cancel stops the session's long lived connection, or kills its stdio
+	// server.
+	cancel context.CancelFunc
+
+	// cmd is the session's stdio server, if any.
+	cmd *exec.Cmd
+
+	// lost is set if the session's connection is lost, and stale if the
+	// server notifies that the tools it serves changed.
+	lost  atomic.Bool
+	stale atomic.Bool
+
+	// tools the server serves, cached until they're stale.
+	tools []mcp.Tool
+
+	// checked is when the session was last known to be healthy.
+	checked time.Time
+}
+
+// A conn is a pooled connection to an MCP server.
+type conn struct {
+	mu sync.Mutex
+
+	// s is the connection's session, or nil if it isn't connected.
+	s *session
+
+	// failures is the number of consecutive failed attempts to connect,
+	// and retry is when the next attempt may be made.
+	failures int
+	retry    time.Time
+
+	// used is when the connection was last used. Guarded by the
+	// Resolver's mutex, not the conn's.
+	used time.Time
+}
+
+// poolKey identifies the pooled connection to the server the supplied Config
+// configures. It's a digest, so that the pool doesn't hold secrets in its
+// keys.
+func poolKey(cfg Config) string {
+	b, _ := json.Marshal(struct {
+		Transport Transport
+		BaseURL   string
+		Command   string
+		Args      []string
+		Env       []string
+		Auth      Auth
+	}{Transport: cfg.Transport, BaseURL: cfg.BaseURL, Command: cfg.Command, Args: cfg.Args, Env: cfg.Env, Auth: cfg.Auth})
+	k := sha256.Sum256(b)
+	return hex.EncodeToString(k[:])
+}
+
+// tools returns the tools served by the server the supplied Config
+// configures, and a client that may call them, connecting to the server if
+// the Resolver isn't already connected. An unhealthy connection is
+// reconnected. Failed connection attempts are retried with exponential
+// backoff.
+func (r *Resolver) tools(ctx context.Context, log logging.Logger, cfg Config) ([]mcp.Tool, caller, error) {
+	now := r.now()
+	c := r.conn(cfg, now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.s != nil && !c.healthy(ctx, cfg, now) {
+		log.Info("mcp server isn't healthy, reconnecting")
+		c.s.close()
+		c.s = nil
+	}
+
+	if c.s == nil {
+		if now.Before(c.retry) {
+			return nil, nil, errors.Errorf("not reconnecting to mcp server for %s after %d failed attempts", c.retry.Sub(now).Round(time.Second), c.failures)
+		}
+		s, err := r.connect(log, cfg)
+		if err != nil {
+			c.failures++
+			c.retry = now.Add(backoff(c.failures))
+			return nil, nil, err
+		}
+		log.Debug("mcp client successfully started")
+		c.s, c.failures, c.retry = s, 0, time.Time{}
+	}
+
+	if c.s.tools == nil || c.s.stale.Swap(false) {
+		lctx, cancel := context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+		rsp, err := c.s.client.ListTools(lctx, mcp.ListToolsRequest{})
+		if err != nil {
+			// Reconnect next time.
+			c.s.close()
+			c.s = nil
+			return nil, nil, errors.Wrap(err, "cannot list tools")
+		}
+		c.s.tools = rsp.Tools
+	}
+	return c.s.tools, c.s.client, nil
+}
+
+// conn returns the pooled connection to the server the supplied Config
+// configures, creating it if necessary. Connections that have been idle for
+// longer than the idle timeout are closed.
+func (r *Resolver) conn(cfg Config, now time.Time) *conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, c := range r.conns {
+		if now.Sub(c.used) <= idleTimeout || !c.mu.TryLock() {
+			continue
+		}
+		if c.s != nil {
+			r.log.Debug("closing idle mcp client")
+			c.s.close()
+			c.s = nil
+		}
+		delete(r.conns, k)
+		c.mu.Unlock()
+	}
+
+	k := poolKey(cfg)
+	c, ok := r.conns[k]
+	if !ok {
+		c = &conn{}
+		r.conns[k] = c
+	}
+	c.used = now
+	return c
+}
+
+// healthy returns true if the connection's session is healthy. The session's
+// server is pinged if it hasn't been within the health check interval.
+func (c *conn) healthy(ctx context.Context, cfg Config, now time.Time) bool {
+	if c.s.lost.Load() {
+		return false
+	}
+	if cfg.Transport != Stdio && now.Sub(c.s.checked) < healthCheckInterval {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := c.s.client.Ping(ctx); err != nil {
+		return false
+	}
+	c.s.checked = now
+	return true
+}
+
+// connect starts and initializes a session with the server the supplied
+// Config configures. The session outlives the request that starts it, so it
+// isn't started with the request's context.
+func (r *Resolver) connect(log logging.Logger, cfg Config) (*session, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{cancel: cancel, checked: r.now()}
+
+	var t transport.Interface
+	switch cfg.Transport {
+	case Stdio:
+		t = newStdio(log, s, cfg)
+	default:
+		var err error
+		if t, err = newTransport(log, cfg); err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "failed to initialize mcp client for server")
+		}
+	}
+
+	s.client = mcpclient.NewClient(t)
+	if err := s.client.Start(ctx); err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "failed to start mcp client")
+	}
+	if st, ok := t.(*transport.Stdio); ok {
+		go logStderr(log, st)
+	}
+	s.client.OnConnectionLost(func(err error) {
+		log.Debug("lost connection to mcp server", "error", err)
+		s.lost.Store(true)
+	})
+	s.client.OnNotification(func(n mcp.JSONRPCNotification) {
+		if n.Method == mcp.MethodNotificationToolsListChanged {
+			s.stale.Store(true)
+		}
+	})
+
+	ictx, icancel := context.WithTimeout(ctx, connectTimeout)
+	defer icancel()
+	req := mcp.InitializeRequest{}
+	req.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	req.Params.ClientInfo = mcp.Implementation{Name: "function-openai"}
+	if _, err := s.client.Initialize(ictx, req); err != nil {
+		s.close()
+		return nil, errors.Wrap(err, "failed to initialize mcp server")
+	}
+	return s, nil
+}
+
+// close the session. A stdio server is given time to exit gracefully once
+// its standard input is closed, before it's killed.
+func (s *session) close() {
+	t := time.AfterFunc(stopTimeout, s.cancel)
+	defer t.Stop()
+	_ = s.client.Close()
+	s.cancel()
+}
+
+// backoff returns how long to wait before reconnecting to a server after the
+// supplied number of consecutive failed attempts.
+func backoff(failures int) time.Duration {
+	d := minBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Close closes every pooled session, stopping any stdio servers.
+func (r *Resolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, c := range r.conns {
+		c.mu.Lock()
+		if c.s != nil {
+			c.s.close()
+			c.s = nil
+		}
+		c.mu.Unlock()
+		delete(r.conns, k)
+	}
+	return nil
+}
+
+// mcpLogger logs messages from MCP clients at debug level.
+type mcpLogger struct {
+	log logging.Logger
+}
+
+func (l mcpLogger) Infof(format string, v ...any) {
+	l.log.Debug(fmt.Sprintf(format, v...))
+}
+
+func (l mcpLogger) Errorf(format string, v ...any) {
+	l.log.Debug(fmt.Sprintf(format, v...))
+}
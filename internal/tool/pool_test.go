@@ -0,0 +1,179 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func echo(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return mcp.NewToolResultText(req.GetString("message", "")), nil
+}
+
+func TestResolvePool(t *testing.T) {
+	s := server.NewMCPServer("echo", "v0.1.0", server.WithToolCapabilities(true))
+	s.AddTool(mcp.NewTool("echo", mcp.WithString("message")), echo)
+	srv := server.NewTestServer(s)
+	defer srv.Close()
+
+	cfg := Config{Transport: SSE, BaseURL: srv.URL + "/sse"}
+	cfgs := map[string]Config{"echo": cfg}
+
+	r := NewResolver()
+	defer r.Close() //nolint:errcheck // Close never fails.
+
+	resolve := func(reason string, want ...string) *session {
+		t.Helper()
+		got := toolString(r.Resolve(t.Context(), cfgs))
+		if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+			t.Errorf("%s\nResolve(...): -want tools, +got tools:\n%s", reason, diff)
+		}
+		return r.conns[poolKey(cfg)].s
+	}
+
+	connected := resolve("A server's tools should be resolved once it's connected to.", "echo")
+	if reused := resolve("A connected server's cached tools should be resolved.", "echo"); reused != connected {
+		t.Errorf("Resolve(...): want the pooled session to be reused")
+	}
+
+	// Adding a tool notifies connected clients that the server's tools
+	// changed.
+	s.AddTool(mcp.NewTool("shout", mcp.WithString("message")), echo)
+	deadline := time.Now().Add(5 * time.Second)
+	for !connected.stale.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if refreshed := resolve("A server's tools should be refreshed once it notifies they changed.", "echo", "shout"); refreshed != connected {
+		t.Errorf("Resolve(...): want the pooled session to be reused")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.conns) != 0 {
+		t.Errorf("Close(): want no pooled connections, got %d", len(r.conns))
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	s := server.NewMCPServer("buckets", "v0.1.0")
+	s.AddTool(mcp.NewTool("get-bucket", mcp.WithReadOnlyHintAnnotation(true)), echo)
+	s.AddTool(mcp.NewTool("list-buckets", mcp.WithReadOnlyHintAnnotation(true)), echo)
+	s.AddTool(mcp.NewTool("create-bucket"), echo)
+	s.AddTool(mcp.NewTool("delete-bucket"), echo)
+	srv := server.NewTestServer(s)
+	defer srv.Close()
+
+	cases := map[string]struct {
+		reason string
+		cfg    Config
+		want   []string
+	}{
+		"NoPolicy": {
+			reason: "All of a server's tools should be resolved if no policy is configured.",
+			cfg:    Config{},
+			want:   []string{"create-bucket", "delete-bucket", "get-bucket", "list-buckets"},
+		},
+		"AllowedAndDenied": {
+			reason: "Only allowed tools that aren't denied should be resolved.",
+			cfg:    Config{AllowedTools: []string{"*-bucket"}, DeniedTools: []string{"delete-*"}},
+			want:   []string{"create-bucket", "get-bucket"},
+		},
+		"ReadOnly": {
+			reason: "Only tools annotated as read-only should be resolved if the server requires them.",
+			cfg:    Config{ReadOnly: true},
+			want:   []string{"get-bucket", "list-buckets"},
+		},
+	}
+
+	r := NewResolver()
+	defer r.Close() //nolint:errcheck // Close never fails.
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.cfg.Transport = SSE
+			tc.cfg.BaseURL = srv.URL + "/sse"
+			got := toolString(r.Resolve(t.Context(), map[string]Config{"buckets": tc.cfg}))
+			if diff := cmp.Diff(tc.want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("%s\nResolve(...): -want tools, +got tools:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestResolveBackoff(t *testing.T) {
+	// A server that's been shut down refuses connections.
+	srv := server.NewTestServer(server.NewMCPServer("echo", "v0.1.0"))
+	srv.Close()
+
+	cfg := Config{Transport: StreamableHTTP, BaseURL: srv.URL + "/mcp"}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewResolver()
+	r.now = func() time.Time { return now }
+	defer r.Close() //nolint:errcheck // Close never fails.
+
+	type step struct {
+		wait     time.Duration
+		failures int
+	}
+	steps := []step{
+		// The first attempt fails.
+		{failures: 1},
+		// Attempts aren't made until a second has passed.
+		{wait: 500 * time.Millisecond, failures: 1},
+		{wait: 500 * time.Millisecond, failures: 2},
+		// Then until two seconds have passed.
+		{wait: time.Second, failures: 2},
+		{wait: time.Second, failures: 3},
+	}
+	for i, s := range steps {
+		now = now.Add(s.wait)
+		if got := r.Resolve(t.Context(), map[string]Config{"echo": cfg}); len(got) != 0 {
+			t.Errorf("step %d: Resolve(...): want no tools, got %v", i, toolString(got))
+		}
+		if got := r.conns[poolKey(cfg)].failures; got != s.failures {
+			t.Errorf("step %d: Resolve(...): want %d failed attempts, got %d", i, s.failures, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := map[string]struct {
+		failures int
+		want     time.Duration
+	}{
+		"First":    {failures: 1, want: time.Second},
+		"Doubling": {failures: 4, want: 8 * time.Second},
+		"Capped":   {failures: 20, want: maxBackoff},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, backoff(tc.failures)); diff != "" {
+				t.Errorf("backoff(%d): -want, +got:\n%s", tc.failures, diff)
+			}
+		})
+	}
+}
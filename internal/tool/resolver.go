@@ -18,14 +18,19 @@ package tool
 
 import (
 	"context"
+	"maps"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
-	mcpadapter "github.com/i2y/langchaingo-mcp-adapter"
-	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/tmc/langchaingo/tools"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
+	"github.com/crossplane/function-sdk-go/errors"
 	"github.com/crossplane/function-sdk-go/logging"
 )
 
@@ -40,10 +45,20 @@ const (
 )
 
 // Resolver is used for resolving MCP server configs from the environment
-// and converting them into langchaingo tools.
+// and converting them into langchaingo tools. It maintains a pool of
+// connections to MCP servers, which are reused across calls to Resolve until
+// the Resolver is closed.
 type Resolver struct {
-	log logging.Logger
-	eg  environGetter
+	log    logging.Logger
+	eg     environGetter
+	tracer trace.Tracer
+	now    func() time.Time
+
+	env     map[string]Config
+	envOnce sync.Once
+
+	mu    sync.Mutex
+	conns map[string]*conn
 }
 
 // Option modifies the underlying Resolver.
@@ -56,11 +71,22 @@ func WithLogger(log logging.Logger) Option {
 	}
 }
 
+// WithTracerProvider records a span for each call to a resolved tool using
+// the supplied tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(r *Resolver) {
+		r.tracer = tp.Tracer(tracerName)
+	}
+}
+
 // NewResolver constructs a Resolver.
 func NewResolver(opts ...Option) *Resolver {
 	r := &Resolver{
-		log: logging.NewNopLogger(),
-		eg:  defaultEnvironGetter,
+		log:    logging.NewNopLogger(),
+		eg:     defaultEnvironGetter,
+		tracer: noop.NewTracerProvider().Tracer(tracerName),
+		now:    time.Now,
+		conns:  map[string]*conn{},
 	}
 	for _, o := range opts {
 		o(r)
@@ -75,56 +101,89 @@ func (r *Resolver) Resolve(ctx context.Context, cfgs map[string]Config) []tools.
 	res := make([]tools.Tool, 0)
 	for _, v := range cfgs {
 
-		var mc *mcpclient.Client
-		var err error
-
-		switch v.Transport {
-		case SSE:
-			mc, err = mcpclient.NewSSEMCPClient(v.BaseURL)
-		case StreamableHTTP:
-			mc, err = mcpclient.NewStreamableHttpClient(v.BaseURL)
-		}
-
-		log := r.log.WithValues("transport", v.Transport, "baseURL", v.BaseURL)
-
-		if err != nil {
-			log.Info("failed to initialize mcp client for server", "error", err)
-			continue
-		}
-
-		// Start the client
-		if err := mc.Start(ctx); err != nil {
-			log.Info("failed to start mcp client", "error", err)
-			continue
-		}
-		log.Debug("mcp client successfully started")
-
-		// Create the adapter for this server
-		adapter, err := mcpadapter.New(mc)
-		if err != nil {
-			log.Info("failed to initialize langchain adapter for mcp server", "error", err)
-			continue
+		log := r.log.WithValues("transport", v.Transport, "baseURL", redactURL(v.BaseURL))
+		if v.Transport == Stdio {
+			log = r.log.WithValues("transport", v.Transport, "command", v.Command)
 		}
 
 		// Get tools from this MCP server
-		tools, err := adapter.Tools()
+		tools, client, err := r.tools(ctx, log, v)
 		if err != nil {
 			log.Info("failed to get the available tools from mcp server", "error", err)
 			continue
 		}
 
-		// Aggregate tools from this server
-		res = append(res, tools...)
-		log.Debug("successfully added tools from mcp server", "tools", toolString(tools))
+		// Aggregate the tools the agent is allowed to call from this
+		// server
+		added := make([]string, 0, len(tools))
+		for _, t := range tools {
+			if !v.Allows(t.Name) {
+				log.Debug("skipping tool that isn't allowed", "tool", t.Name)
+				continue
+			}
+			if !v.AllowsAnnotations(t.Annotations) {
+				log.Debug("skipping tool that isn't annotated as read-only", "tool", t.Name)
+				continue
+			}
+			mt := &mcpTool{tool: t, client: client, cfg: v, log: log}
+			res = append(res, &tracedTool{Tool: mt, tracer: r.tracer, cfg: v})
+			added = append(added, t.Name)
+		}
+		log.Debug("successfully added tools from mcp server", "tools", added)
 	}
 
 	return res
 }
 
+// newTransport returns a transport for the supplied remote MCP server that
+// authenticates using its Auth.
+func newTransport(log logging.Logger, cfg Config) (transport.Interface, error) {
+	hc, err := cfg.Auth.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	headers := cfg.Auth.headers()
+
+	switch cfg.Transport {
+	case SSE:
+		opts := []transport.ClientOption{transport.WithSSELogger(mcpLogger{log: log})}
+		if headers != nil {
+			opts = append(opts, transport.WithHeaders(headers))
+		}
+		if hc != nil {
+			opts = append(opts, transport.WithHTTPClient(hc))
+		}
+		return transport.NewSSE(cfg.BaseURL, opts...)
+	case StreamableHTTP:
+		// Listen for notifications, so that the tools the server
+		// serves are refreshed when they change.
+		opts := []transport.StreamableHTTPCOption{transport.WithHTTPLogger(mcpLogger{log: log}), transport.WithContinuousListening()}
+		if headers != nil {
+			opts = append(opts, transport.WithHTTPHeaders(headers))
+		}
+		if hc != nil {
+			opts = append(opts, transport.WithHTTPBasicClient(hc))
+		}
+		return transport.NewStreamableHTTP(cfg.BaseURL, opts...)
+	default:
+		return nil, errors.Errorf("unsupported transport %q", cfg.Transport)
+	}
+}
+
 // FromEnvVars derives Configs for MCP servers from the environment variables
 // supplied to the process. If the resulting Config is invalid, it is not
-// returned.
+// returned. The environment is only read once; the returned map is a copy
+// the caller may modify.
 func (r *Resolver) FromEnvVars() map[string]Config {
+	r.envOnce.Do(func() {
+		r.env = r.fromEnvVars()
+	})
+	return maps.Clone(r.env)
+}
+
+// fromEnvVars derives Configs for MCP servers from the environment variables
+// supplied to the process.
+func (r *Resolver) fromEnvVars() map[string]Config {
 	cfgs := map[string]Config{}
 
 	for _, e := range r.eg.Environ() {
@@ -148,9 +207,15 @@ func (r *Resolver) FromEnvVars() map[string]Config {
 }
 
 // parse the supplied k=v environment variable from an MCP_SERVER_TOOL_*
-// environment variable.
+// environment variable. Only the variable's name is matched, so that values
+// may contain underscores. The values of commands, their arguments and
+// environment variables are case sensitive.
 func (r *Resolver) parse(e string) (string, Config) {
-	matches := re.FindStringSubmatch(e)
+	k, v, _ := strings.Cut(e, "=")
+	matches := re.FindStringSubmatch(k)
+	if matches == nil {
+		return "", Config{}
+	}
 
 	names := re.SubexpNames()
 	result := make(map[string]string)
@@ -161,12 +226,23 @@ func (r *Resolver) parse(e string) (string, Config) {
 	}
 
 	cfg := Config{}
-	vtype := strings.Split(result[cfgtype], "=")
-	switch vtype[0] {
+	switch result[cfgtype] {
 	case "transport":
-		cfg.Transport = Transport(vtype[1])
+		cfg.Transport = Transport(strings.ToLower(v))
 	case "baseurl":
-		cfg.BaseURL = vtype[1]
+		cfg.BaseURL = strings.ToLower(v)
+	case "command":
+		cfg.Command = v
+	case "args":
+		cfg.Args = strings.Fields(v)
+	case "env":
+		cfg.Env = splitList(v)
+	case "allowedtools":
+		cfg.AllowedTools = splitList(v)
+	case "deniedtools":
+		cfg.DeniedTools = splitList(v)
+	case "readonly":
+		cfg.ReadOnly = strings.EqualFold(v, "true")
 	}
 
 	return result[key], cfg
@@ -175,14 +251,7 @@ func (r *Resolver) parse(e string) (string, Config) {
 // merge two MCP server Configs. If the current Config has an unset value, the
 // value from new is applied.
 func (r *Resolver) merge(currentc, newc Config) Config {
-	if currentc.Transport == "" && newc.Transport != "" {
-		currentc.Transport = newc.Transport
-	}
-	if currentc.BaseURL == "" && newc.BaseURL != "" {
-		currentc.BaseURL = newc.BaseURL
-	}
-
-	return currentc
+	return Merge(currentc, newc)
 }
 
 type environGetter interface {
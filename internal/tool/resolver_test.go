@@ -182,6 +182,72 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		"MCP_SERVER_TOOL_*_COMMAND=/usr/local/bin/kubectl_mcp": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_COMMAND=/usr/local/bin/kubectl_mcp",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					Command: "/usr/local/bin/kubectl_mcp",
+				},
+			},
+		},
+		"MCP_SERVER_TOOL_*_ARGS=--read-only --context=Prod": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_ARGS=--read-only --context=Prod",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					Args: []string{"--read-only", "--context=Prod"},
+				},
+			},
+		},
+		"MCP_SERVER_TOOL_*_ENV=KUBECONFIG=/etc/kube/config,LOG_LEVEL=debug": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_ENV=KUBECONFIG=/etc/kube/config,LOG_LEVEL=debug",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					Env: []string{"KUBECONFIG=/etc/kube/config", "LOG_LEVEL=debug"},
+				},
+			},
+		},
+		"MCP_SERVER_TOOL_*_ALLOWEDTOOLS=get-*,list-*": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_ALLOWEDTOOLS=get-*,list-*",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					AllowedTools: []string{"get-*", "list-*"},
+				},
+			},
+		},
+		"MCP_SERVER_TOOL_*_DENIEDTOOLS=delete-*": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_DENIEDTOOLS=delete-*",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					DeniedTools: []string{"delete-*"},
+				},
+			},
+		},
+		"MCP_SERVER_TOOL_*_READONLY=true": {
+			args: args{
+				e: "MCP_SERVER_TOOL_K1_READONLY=true",
+			},
+			want: want{
+				key: "k1",
+				res: Config{
+					ReadOnly: true,
+				},
+			},
+		},
 		"MCP_SERVER_TOOL_*_TRANSPOR=sse": {
 			args: args{
 				e: "MCP_SERVER_TOOL_K1_TRANSPOR=sse",
@@ -0,0 +1,54 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+// newStdio returns a transport that runs the supplied Config's command as a
+// subprocess of the function once it's started. The subprocess is recorded
+// in the supplied session. It's killed when the context the transport is
+// started with is cancelled.
+func newStdio(log logging.Logger, s *session, cfg Config) *transport.Stdio {
+	cmd := func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+		s.cmd = exec.CommandContext(ctx, command, args...) //nolint:gosec // Running the configured command is intended.
+		s.cmd.Env = append(os.Environ(), env...)
+		s.cmd.WaitDelay = stopTimeout
+		return s.cmd, nil
+	}
+	return transport.NewStdioWithOptions(cfg.Command, cfg.Env, cfg.Args,
+		transport.WithCommandFunc(cmd),
+		transport.WithCommandLogger(mcpLogger{log: log}),
+	)
+}
+
+// logStderr logs the started stdio server's standard error at debug level,
+// until the server exits.
+func logStderr(log logging.Logger, t *transport.Stdio) {
+	sc := bufio.NewScanner(t.Stderr())
+	for sc.Scan() {
+		log.Debug("stdio mcp server", "stderr", sc.Text())
+	}
+}
@@ -0,0 +1,87 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// envStdioServer makes the test binary run as a stdio MCP server.
+const envStdioServer = "TOOL_TEST_STDIO_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envStdioServer) == "1" {
+		s := server.NewMCPServer("echo", "v0.1.0")
+		s.AddTool(mcp.NewTool("echo", mcp.WithString("message")), func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(req.GetString("message", "")), nil
+		})
+		_ = server.ServeStdio(s)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestResolveStdio(t *testing.T) {
+	cfg := Config{Transport: Stdio, Command: os.Args[0], Env: []string{envStdioServer + "=1"}}
+	cfgs := map[string]Config{"echo": cfg}
+
+	r := NewResolver()
+	defer r.Close() //nolint:errcheck // Close never fails.
+
+	resolve := func(reason string) int {
+		t.Helper()
+		ts := r.Resolve(t.Context(), cfgs)
+		if diff := cmp.Diff([]string{"echo"}, toolString(ts)); diff != "" {
+			t.Fatalf("%s\nResolve(...): -want tools, +got tools:\n%s", reason, diff)
+		}
+		out, err := ts[0].Call(t.Context(), `{"message":"hello"}`)
+		if err != nil {
+			t.Fatalf("%s\nCall(...): %v", reason, err)
+		}
+		if diff := cmp.Diff("hello", out); diff != "" {
+			t.Errorf("%s\nCall(...): -want, +got:\n%s", reason, diff)
+		}
+		return r.conns[poolKey(cfg)].s.cmd.Process.Pid
+	}
+
+	started := resolve("A stdio server's tools should be resolved once it's started.")
+	if reused := resolve("A running stdio server's tools should be resolved."); reused != started {
+		t.Errorf("Resolve(...): want running server %d to be reused, got new server %d", started, reused)
+	}
+
+	p := r.conns[poolKey(cfg)].s.cmd.Process
+	if err := p.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = p.Wait()
+	if restarted := resolve("A crashed stdio server should be restarted."); restarted == started {
+		t.Errorf("Resolve(...): want crashed server %d to be restarted", started)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.conns) != 0 {
+		t.Errorf("Close(): want no running stdio servers, got %d", len(r.conns))
+	}
+}
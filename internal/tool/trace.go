@@ -0,0 +1,75 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package tool
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/tmc/langchaingo/tools"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans the resolver's tools record.
+const tracerName = "github.com/upbound/function-openai/internal/tool"
+
+// Span attributes, following the OpenTelemetry semantic conventions for
+// generative AI where they apply.
+const (
+	attrToolName  = attribute.Key("gen_ai.tool.name")
+	attrTransport = attribute.Key("mcp.transport")
+	attrServer    = attribute.Key("mcp.server.url")
+)
+
+// A tracedTool records a span for each call to an MCP server's tool.
+type tracedTool struct {
+	tools.Tool
+
+	tracer trace.Tracer
+	cfg    Config
+}
+
+// Call the wrapped tool. The span records the tool and the MCP server that
+// serves it, but not the tool's input or output, which may be sensitive.
+func (t *tracedTool) Call(ctx context.Context, input string) (string, error) {
+	ctx, span := t.tracer.Start(ctx, "tool.Call", trace.WithAttributes(
+		attrToolName.String(t.Name()),
+		attrTransport.String(string(t.cfg.Transport)),
+		attrServer.String(redactURL(t.cfg.BaseURL)),
+	))
+	defer span.End()
+
+	out, err := t.Tool.Call(ctx, input)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return out, err
+}
+
+// redactURL returns the supplied URL without its userinfo, query or fragment,
+// any of which may carry credentials. It returns an empty string if the URL
+// can't be parsed.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
@@ -0,0 +1,263 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package validate
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	kjson "sigs.k8s.io/json"
+
+	"github.com/crossplane/function-sdk-go/errors"
+)
+
+const (
+	// CRDKind is the kind of a CustomResourceDefinition.
+	CRDKind = "CustomResourceDefinition"
+	// CRDGroup is the API group of a CustomResourceDefinition.
+	CRDGroup = "apiextensions.k8s.io"
+
+	errUnknownField = "unknown field"
+
+	extPreserveUnknownFields = "x-kubernetes-preserve-unknown-fields"
+	extEmbeddedResource      = "x-kubernetes-embedded-resource"
+)
+
+var reUnknownField = regexp.MustCompile(`^unknown field "(.*)"$`)
+
+// core is the bundled set of core Kubernetes types resources can be
+// validated against without supplying a CRD.
+var core = func() *runtime.Scheme {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		corev1.AddToScheme,
+		appsv1.AddToScheme,
+		autoscalingv2.AddToScheme,
+		batchv1.AddToScheme,
+		networkingv1.AddToScheme,
+		policyv1.AddToScheme,
+		rbacv1.AddToScheme,
+	} {
+		if err := add(s); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}()
+
+// A Validator validates resources against OpenAPI schemas. Schemas are
+// loaded from CRDs, or from a bundled set of core Kubernetes types.
+type Validator struct {
+	schemas map[schema.GroupVersionKind]*spec.Schema
+}
+
+// NewValidator constructs a Validator that knows about the core Kubernetes
+// types.
+func NewValidator() *Validator {
+	return &Validator{schemas: make(map[schema.GroupVersionKind]*spec.Schema)}
+}
+
+// IsCRD returns true if the supplied object is a CustomResourceDefinition.
+func IsCRD(obj map[string]any) bool {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	return kind == CRDKind && strings.HasPrefix(apiVersion, CRDGroup+"/")
+}
+
+// AddCRD loads the OpenAPI schema of every version of the supplied
+// CustomResourceDefinition.
+func (v *Validator) AddCRD(obj map[string]any) error {
+	crd := &struct {
+		Spec struct {
+			Group string `json:"group"`
+			Names struct {
+				Kind string `json:"kind"`
+			} `json:"names"`
+			Versions []struct {
+				Name   string `json:"name"`
+				Schema struct {
+					OpenAPIV3Schema *spec.Schema `json:"openAPIV3Schema"`
+				} `json:"schema"`
+			} `json:"versions"`
+		} `json:"spec"`
+	}{}
+
+	j, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal CRD")
+	}
+	if err := json.Unmarshal(j, crd); err != nil {
+		return errors.Wrap(err, "cannot unmarshal CRD")
+	}
+
+	for _, ver := range crd.Spec.Versions {
+		if ver.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: ver.Name, Kind: crd.Spec.Names.Kind}
+		v.schemas[gvk] = ver.Schema.OpenAPIV3Schema
+	}
+	return nil
+}
+
+// Validate the supplied resource against its schema. It returns false if no
+// schema is known for the resource's kind.
+func (v *Validator) Validate(obj map[string]any) (field.ErrorList, bool) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+
+	if s, ok := v.schemas[gvk]; ok {
+		return validateSchema(obj, s), true
+	}
+	if core.Recognizes(gvk) {
+		return validateCore(obj, gvk), true
+	}
+	return nil, false
+}
+
+// validateSchema validates the supplied resource against an OpenAPI schema.
+// Like the API server it treats fields that aren't declared in a structural
+// schema as errors.
+func validateSchema(obj map[string]any, s *spec.Schema) field.ErrorList {
+	errs := unknownFields(nil, obj, s)
+
+	r := validate.NewSchemaValidator(s, nil, "", strfmt.Default).Validate(obj)
+	for _, err := range r.Errors {
+		var verr *openapierrors.Validation
+		if errors.As(err, &verr) {
+			detail := strings.TrimPrefix(verr.Error(), verr.Name+" in body ")
+			errs = append(errs, field.Invalid(field.NewPath(verr.Name), verr.Value, detail))
+			continue
+		}
+		errs = append(errs, field.Invalid(field.NewPath(""), nil, err.Error()))
+	}
+	return errs
+}
+
+// unknownFields returns an error for each field of v that isn't declared by
+// the supplied schema.
+func unknownFields(p *field.Path, v any, s *spec.Schema) field.ErrorList {
+	if s == nil || extension(s, extPreserveUnknownFields) {
+		return nil
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		errs := field.ErrorList{}
+		for k, cv := range t {
+			cp := child(p, k)
+			if ps, ok := s.Properties[k]; ok {
+				errs = append(errs, unknownFields(cp, cv, &ps)...)
+				continue
+			}
+			if ap := s.AdditionalProperties; ap != nil {
+				if ap.Schema != nil {
+					errs = append(errs, unknownFields(cp, cv, ap.Schema)...)
+				}
+				continue
+			}
+			// The API server handles type and object metadata of resources.
+			if (p == nil || extension(s, extEmbeddedResource)) && (k == "apiVersion" || k == "kind" || k == "metadata") {
+				continue
+			}
+			// Only treat fields as unknown if the schema declares some.
+			if len(s.Properties) == 0 {
+				continue
+			}
+			errs = append(errs, field.Forbidden(cp, errUnknownField))
+		}
+		return errs
+	case []any:
+		if s.Items == nil || s.Items.Schema == nil {
+			return nil
+		}
+		errs := field.ErrorList{}
+		for i, cv := range t {
+			errs = append(errs, unknownFields(index(p, i), cv, s.Items.Schema)...)
+		}
+		return errs
+	}
+	return nil
+}
+
+// validateCore validates the supplied resource by strictly decoding it into
+// its core Kubernetes type.
+func validateCore(obj map[string]any, gvk schema.GroupVersionKind) field.ErrorList {
+	o, err := core.New(gvk)
+	if err != nil {
+		return field.ErrorList{field.InternalError(nil, err)}
+	}
+
+	j, err := json.Marshal(obj)
+	if err != nil {
+		return field.ErrorList{field.InternalError(nil, err)}
+	}
+
+	errs := field.ErrorList{}
+	serrs, err := kjson.UnmarshalStrict(j, o, kjson.DisallowDuplicateFields, kjson.DisallowUnknownFields)
+	if err != nil {
+		var terr *json.UnmarshalTypeError
+		if errors.As(err, &terr) {
+			errs = append(errs, field.Invalid(field.NewPath(terr.Field), terr.Value, "must be of type "+terr.Type.String()))
+		} else {
+			errs = append(errs, field.Invalid(field.NewPath(""), nil, err.Error()))
+		}
+	}
+	for _, serr := range serrs {
+		if m := reUnknownField.FindStringSubmatch(serr.Error()); m != nil {
+			errs = append(errs, field.Forbidden(field.NewPath(m[1]), errUnknownField))
+			continue
+		}
+		errs = append(errs, field.Invalid(field.NewPath(""), nil, serr.Error()))
+	}
+	return errs
+}
+
+func extension(s *spec.Schema, name string) bool {
+	b, _ := s.Extensions.GetBool(name)
+	return b
+}
+
+func child(p *field.Path, name string) *field.Path {
+	if p == nil {
+		return field.NewPath(name)
+	}
+	return p.Child(name)
+}
+
+func index(p *field.Path, i int) *field.Path {
+	if p == nil {
+		return field.NewPath("").Index(i)
+	}
+	return p.Index(i)
+}
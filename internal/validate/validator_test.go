@@ -0,0 +1,190 @@
+// /*
+// Copyright 2025 The Upbound Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// */
+
+package validate
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const crd = `{
+	"apiVersion": "apiextensions.k8s.io/v1",
+	"kind": "CustomResourceDefinition",
+	"spec": {
+		"group": "example.org",
+		"names": {"kind": "Bucket"},
+		"versions": [{
+			"name": "v1",
+			"schema": {"openAPIV3Schema": {
+				"type": "object",
+				"properties": {
+					"apiVersion": {"type": "string"},
+					"kind": {"type": "string"},
+					"metadata": {"type": "object"},
+					"spec": {
+						"type": "object",
+						"required": ["region"],
+						"properties": {
+							"region": {"type": "string"},
+							"size": {"type": "integer"},
+							"tags": {"type": "object", "additionalProperties": {"type": "string"}},
+							"rules": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}}}},
+							"raw": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+						}
+					}
+				}
+			}}
+		}]
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	type want struct {
+		errs  []string
+		known bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		obj    string
+		want   want
+	}{
+		"ValidCustomResource": {
+			reason: "A resource that conforms to its CRD's schema should be valid.",
+			obj:    `{"apiVersion":"example.org/v1","kind":"Bucket","metadata":{"name":"b"},"spec":{"region":"us","size":3,"tags":{"a":"b"},"rules":[{"name":"r"}],"raw":{"any":"thing"}}}`,
+			want: want{
+				errs:  []string{},
+				known: true,
+			},
+		},
+		"InvalidCustomResource": {
+			reason: "Unknown fields, missing required fields and wrongly typed fields should be invalid.",
+			obj:    `{"apiVersion":"example.org/v1","kind":"Bucket","spec":{"sizee":3,"size":"big","rules":[{"nme":"r"}]}}`,
+			want: want{
+				errs: []string{
+					`spec.region: Invalid value: "null": is required`,
+					`spec.rules[0].nme: Forbidden: unknown field`,
+					`spec.size: Invalid value: "string": must be of type integer: "string"`,
+					`spec.sizee: Forbidden: unknown field`,
+				},
+				known: true,
+			},
+		},
+		"ValidCoreResource": {
+			reason: "A core resource that conforms to its type should be valid.",
+			obj:    `{"apiVersion":"apps/v1","kind":"Deployment","spec":{"replicas":3}}`,
+			want: want{
+				errs:  []string{},
+				known: true,
+			},
+		},
+		"InvalidCoreResource": {
+			reason: "Unknown fields of core resources should be invalid.",
+			obj:    `{"apiVersion":"apps/v1","kind":"Deployment","spec":{"replicaz":3,"template":{"spec":{"containers":[{"nme":"a"}]}}}}`,
+			want: want{
+				errs: []string{
+					`spec.replicaz: Forbidden: unknown field`,
+					`spec.template.spec.containers[0].nme: Forbidden: unknown field`,
+				},
+				known: true,
+			},
+		},
+		"WronglyTypedCoreResource": {
+			reason: "Wrongly typed fields of core resources should be invalid.",
+			obj:    `{"apiVersion":"apps/v1","kind":"Deployment","spec":{"replicas":"three"}}`,
+			want: want{
+				errs: []string{
+					`spec.replicas: Invalid value: "string": must be of type int32`,
+				},
+				known: true,
+			},
+		},
+		"UnknownKind": {
+			reason: "We should report when we don't know a resource's schema.",
+			obj:    `{"apiVersion":"example.org/v1","kind":"Unknown"}`,
+			want: want{
+				known: false,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := map[string]any{}
+			if err := json.Unmarshal([]byte(crd), &c); err != nil {
+				t.Fatal(err)
+			}
+			v := NewValidator()
+			if err := v.AddCRD(c); err != nil {
+				t.Fatal(err)
+			}
+
+			obj := map[string]any{}
+			if err := json.Unmarshal([]byte(tc.obj), &obj); err != nil {
+				t.Fatal(err)
+			}
+
+			errs, known := v.Validate(obj)
+			if diff := cmp.Diff(tc.want.known, known); diff != "" {
+				t.Errorf("\n%s\nValidate(...): -want known, +got known:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.errs, messages(errs)); diff != "" {
+				t.Errorf("\n%s\nValidate(...): -want errs, +got errs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestIsCRD(t *testing.T) {
+	cases := map[string]struct {
+		obj  map[string]any
+		want bool
+	}{
+		"CRD": {
+			obj:  map[string]any{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition"},
+			want: true,
+		},
+		"NotCRD": {
+			obj:  map[string]any{"apiVersion": "example.org/v1", "kind": "CustomResourceDefinition"},
+			want: false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, IsCRD(tc.obj)); diff != "" {
+				t.Errorf("\n\nIsCRD(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func messages(errs field.ErrorList) []string {
+	if errs == nil {
+		return nil
+	}
+	out := make([]string, 0, len(errs))
+	for _, e := range errs {
+		out = append(out, e.Error())
+	}
+	slices.Sort(out)
+	return out
+}
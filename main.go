@@ -18,13 +18,30 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/alecthomas/kong"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"github.com/crossplane/function-sdk-go"
+	"github.com/crossplane/function-sdk-go/errors"
 
 	"github.com/upbound/function-openai/internal/bootcheck"
+	"github.com/upbound/function-openai/internal/budget"
+	"github.com/upbound/function-openai/internal/cache"
+	"github.com/upbound/function-openai/internal/metrics"
+	"github.com/upbound/function-openai/internal/prompt"
 )
 
 func init() {
@@ -43,6 +60,42 @@ type CLI struct {
 	TLSCertsDir        string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure           bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
 	MaxRecvMessageSize int    `help:"Maximum size of received messages in MB." default:"4"`
+
+	Cache     string `help:"Where to cache GPT's responses. One of memory, disk, or none." default:"memory" enum:"memory,disk,none"`
+	CacheDir  string `help:"Directory in which to cache GPT's responses when --cache=disk." default:"/tmp/function-openai/cache"`
+	CacheSize int    `help:"Maximum number of GPT responses to cache." default:"1024"`
+
+	PromptTemplateDir string `help:"Directory from which to load prompt templates, in addition to the built in templates." env:"PROMPT_TEMPLATE_DIR"`
+
+	MCPSecretDir          string `help:"Directory from which MCP server authentication may read secret files. Secret files can't be read if unset." env:"MCP_SECRET_DIR"`
+	MCPAllowLLMCredential bool   `help:"Allow MCP server authentication to send the gpt credential, which holds the LLM API key, to MCP servers." env:"MCP_ALLOW_LLM_CREDENTIAL"`
+
+	MetricsAddress string `help:"Address at which to serve Prometheus metrics. Metrics aren't served if unset." env:"METRICS_ADDRESS"`
+	PriceTable     string `help:"YAML file of model prices, in USD per million prompt and completion tokens, used to estimate the cost of LLM calls." env:"PRICE_TABLE"`
+
+	TracingEndpoint    string  `help:"OTLP endpoint to export traces to, as host:port. Traces aren't exported if unset." env:"TRACING_ENDPOINT"`
+	TracingProtocol    string  `help:"OTLP protocol used to export traces. One of grpc or http." default:"grpc" enum:"grpc,http" env:"TRACING_PROTOCOL"`
+	TracingInsecure    bool    `help:"Export traces without TLS." env:"TRACING_INSECURE"`
+	TracingSampleRatio float64 `help:"Fraction of function runs to trace, between 0 and 1." default:"1" env:"TRACING_SAMPLE_RATIO"`
+
+	ModelBudget         BudgetFlags `embed:"" prefix:"model-budget-" envprefix:"MODEL_BUDGET_" group:"Budget per model"`
+	CompositeKindBudget BudgetFlags `embed:"" prefix:"composite-kind-budget-" envprefix:"COMPOSITE_KIND_BUDGET_" group:"Budget per composite resource kind"`
+	CompositeBudget     BudgetFlags `embed:"" prefix:"composite-budget-" envprefix:"COMPOSITE_BUDGET_" group:"Budget per composite resource"`
+}
+
+// BudgetFlags limit use of GPT. Zero limits aren't enforced.
+type BudgetFlags struct {
+	RequestsPerMinute int `help:"Maximum number of times GPT is asked to respond in any minute." env:"REQUESTS_PER_MINUTE"`
+	TokensPerHour     int `help:"Maximum number of tokens GPT may use in any hour." env:"TOKENS_PER_HOUR"`
+	TokensPerDay      int `help:"Maximum number of tokens GPT may use in any day." env:"TOKENS_PER_DAY"`
+}
+
+// Limits returns the limits the flags configure.
+func (f BudgetFlags) Limits() (budget.Limits, error) {
+	if f.RequestsPerMinute < 0 || f.TokensPerHour < 0 || f.TokensPerDay < 0 {
+		return budget.Limits{}, errors.New("budget limits must not be negative")
+	}
+	return budget.Limits{RequestsPerMinute: f.RequestsPerMinute, TokensPerHour: f.TokensPerHour, TokensPerDay: f.TokensPerDay}, nil
 }
 
 // Run this Function.
@@ -52,12 +105,147 @@ func (c *CLI) Run() error {
 		return err
 	}
 
-	return function.Serve(
-		NewFunction(WithLogger(log)),
-		function.Listen(c.Network, c.Address),
-		function.MTLSCertificates(c.TLSCertsDir),
-		function.Insecure(c.Insecure),
-		function.MaxRecvMessageSize(c.MaxRecvMessageSize*1024*1024))
+	opts := []Option{WithLogger(log)}
+	switch c.Cache {
+	case "memory":
+		opts = append(opts, WithCache(cache.NewMemory(c.CacheSize)))
+	case "disk":
+		d, err := cache.NewDisk(c.CacheDir, c.CacheSize)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithCache(d))
+	}
+
+	if c.PromptTemplateDir != "" {
+		l, err := prompt.LoadDir(c.PromptTemplateDir)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithPromptTemplates(l))
+	}
+
+	if c.MCPSecretDir != "" {
+		opts = append(opts, WithMCPSecretDir(c.MCPSecretDir))
+	}
+	if c.MCPAllowLLMCredential {
+		opts = append(opts, WithMCPLLMCredential())
+	}
+
+	model, err := c.ModelBudget.Limits()
+	if err != nil {
+		return errors.Wrap(err, "invalid model budget")
+	}
+	kind, err := c.CompositeKindBudget.Limits()
+	if err != nil {
+		return errors.Wrap(err, "invalid composite resource kind budget")
+	}
+	xr, err := c.CompositeBudget.Limits()
+	if err != nil {
+		return errors.Wrap(err, "invalid composite resource budget")
+	}
+	opts = append(opts, WithBudgets(model, kind, xr))
+
+	if c.MetricsAddress != "" {
+		m, err := c.metrics()
+		if err != nil {
+			return err
+		}
+		opts = append(opts, WithMetrics(m))
+	}
+
+	if c.TracingEndpoint != "" {
+		tp, err := c.tracing(context.Background())
+		if err != nil {
+			return err
+		}
+		// Flush any buffered spans when the function stops serving.
+		defer tp.Shutdown(context.Background()) //nolint:errcheck // There's nothing to do if flushing fails.
+		opts = append(opts, WithTracerProvider(tp))
+	}
+
+	fn := NewFunction(opts...)
+	// Close pooled MCP clients, stopping any stdio MCP servers, when the
+	// function stops serving.
+	defer fn.tools.Close() //nolint:errcheck // There's nothing to do if closing fails.
+
+	// Serve until the function is told to stop, so that deferred cleanup
+	// runs before it exits.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- function.Serve(
+			fn,
+			function.Listen(c.Network, c.Address),
+			function.MTLSCertificates(c.TLSCertsDir),
+			function.Insecure(c.Insecure),
+			function.MaxRecvMessageSize(c.MaxRecvMessageSize*1024*1024))
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		log.Info("Stopping function")
+		return nil
+	}
+}
+
+// tracing returns a tracer provider that exports traces to the configured
+// OTLP endpoint.
+func (c *CLI) tracing(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return nil, errors.Errorf("tracing sample ratio must be between 0 and 1, got %v", c.TracingSampleRatio)
+	}
+
+	var exp *otlptrace.Exporter
+	var err error
+	switch c.TracingProtocol {
+	case "http":
+		hopts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(c.TracingEndpoint)}
+		if c.TracingInsecure {
+			hopts = append(hopts, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(ctx, hopts...)
+	default:
+		gopts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.TracingEndpoint)}
+		if c.TracingInsecure {
+			gopts = append(gopts, otlptracegrpc.WithInsecure())
+		}
+		exp, err = otlptracegrpc.New(ctx, gopts...)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create OTLP trace exporter for %q", c.TracingEndpoint)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.TracingSampleRatio))),
+		sdktrace.WithResource(sdkresource.NewSchemaless(semconv.ServiceName("function-openai"))),
+	), nil
+}
+
+// metrics starts serving Prometheus metrics, and returns the metrics the
+// function records.
+func (c *CLI) metrics() (*metrics.Metrics, error) {
+	var mopts []metrics.Option
+	if c.PriceTable != "" {
+		p, err := metrics.LoadPrices(c.PriceTable)
+		if err != nil {
+			return nil, err
+		}
+		mopts = append(mopts, metrics.WithPrices(p))
+	}
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m, err := metrics.New(r, mopts...)
+	if err != nil {
+		return nil, err
+	}
+	return m, metrics.Serve(c.MetricsAddress, r)
 }
 
 func main() {
@@ -0,0 +1,346 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/tool"
+)
+
+// mcpServerRequirement returns the name of the requirement for the resource
+// the named MCP server is configured from.
+func mcpServerRequirement(server string) string {
+	return "openai.fn.upbound.io/mcp-server-" + strings.ToLower(server)
+}
+
+// mcpServerSourceType returns the API version and kind of the supplied source,
+// which default to those of a ConfigMap.
+func mcpServerSourceType(s *v1alpha1.MCPServerSource) (apiVersion, kind string) {
+	apiVersion, kind = s.APIVersion, s.Kind
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	if kind == "" {
+		kind = "ConfigMap"
+	}
+	return apiVersion, kind
+}
+
+// withMCPServers makes tools from the supplied MCP servers available to the
+// agent, keyed by server name.
+func withMCPServers(cfgs map[string]tool.Config) invokeOption {
+	return func(o *invokeOptions) {
+		o.mcpServers = cfgs
+	}
+}
+
+// mcpServers returns the MCP servers the agent may call tools from, keyed by
+// lower case server name. Servers configured by the input are merged with any
+// of the same name configured by environment variables. Fields set by the
+// input take precedence over those of the resource the server is configured
+// from, which take precedence over the environment variables.
+func (f *Function) mcpServers(req *fnv1.RunFunctionRequest, in *v1alpha1.Prompt) (map[string]tool.Config, error) {
+	out := map[string]tool.Config{}
+	if f.tools != nil {
+		out = f.tools.FromEnvVars()
+	}
+
+	seen := map[string]bool{}
+	for _, s := range in.MCPServers {
+		name := strings.ToLower(s.Name)
+		if name == "" {
+			return nil, errors.New("MCP servers must have a name")
+		}
+		if seen[name] {
+			return nil, errors.Errorf("MCP server %q is declared more than once", s.Name)
+		}
+		seen[name] = true
+
+		if s.Disabled {
+			delete(out, name)
+			continue
+		}
+
+		// Stdio servers run commands in the function's container, so
+		// only the function's environment variables may configure them.
+		if tool.Transport(s.Transport) == tool.Stdio {
+			return nil, errors.Errorf("MCP server %q: stdio servers may only be configured by the function's environment variables", s.Name)
+		}
+
+		var from tool.Config
+		if s.From != nil {
+			obj, ok := requiredResource(req, mcpServerRequirement(s.Name))
+			if !ok {
+				_, kind := mcpServerSourceType(s.From)
+				return nil, errors.Errorf("cannot find %s %q to configure MCP server %q", kind, s.From.Name, s.Name)
+			}
+			from = tool.FromResource(obj)
+			if from.Transport == tool.Stdio {
+				return nil, errors.Errorf("MCP server %q: stdio servers may only be configured by the function's environment variables", s.Name)
+			}
+		}
+
+		auth, err := f.mcpAuth(req, s.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot configure authentication for MCP server %q", s.Name)
+		}
+
+		args, err := mcpToolArguments(s.ToolArguments)
+		if err != nil {
+			return nil, errors.Wrapf(err, "MCP server %q", s.Name)
+		}
+
+		cfg := tool.Merge(tool.Config{
+			Transport:    tool.Transport(s.Transport),
+			BaseURL:      s.BaseURL,
+			AllowedTools: s.AllowedTools,
+			DeniedTools:  s.DeniedTools,
+			Arguments:    args,
+			Auth:         auth,
+		}, from, out[name])
+		if s.RequireReadOnly != nil {
+			cfg.ReadOnly = *s.RequireReadOnly
+		}
+		if err := cfg.Valid(); err != nil {
+			return nil, errors.Wrapf(err, "MCP server %q", s.Name)
+		}
+		out[name] = cfg
+	}
+
+	// Composition pipelines run every time a composite resource is
+	// reconciled, so by default the agent may only call read-only tools
+	// there. The input may opt a server out of this.
+	if inCompositionPipeline(req) {
+		for name, cfg := range out {
+			if s := mcpServer(in, name); s != nil && s.RequireReadOnly != nil {
+				continue
+			}
+			cfg.ReadOnly = true
+			out[name] = cfg
+		}
+	}
+	return out, nil
+}
+
+// mcpServer returns the input's MCP server of the supplied lower case name, if
+// any.
+func mcpServer(in *v1alpha1.Prompt, name string) *v1alpha1.MCPServer {
+	for i := range in.MCPServers {
+		if strings.ToLower(in.MCPServers[i].Name) == name {
+			return &in.MCPServers[i]
+		}
+	}
+	return nil
+}
+
+// mcpToolArguments returns the supplied tool argument policies.
+func mcpToolArguments(in []v1alpha1.MCPToolArgumentPolicy) ([]tool.ArgumentPolicy, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make([]tool.ArgumentPolicy, 0, len(in))
+	for _, p := range in {
+		ap := tool.ArgumentPolicy{Tool: p.Tool, Rule: p.Rule, Message: p.Message}
+		if p.Schema != nil && len(p.Schema.Raw) > 0 {
+			ap.Schema = &spec.Schema{}
+			if err := json.Unmarshal(p.Schema.Raw, ap.Schema); err != nil {
+				return nil, errors.Wrapf(err, "cannot parse argument schema for tool %q", p.Tool)
+			}
+		}
+		out = append(out, ap)
+	}
+	return out, nil
+}
+
+// mcpSecrets limits the secrets MCP server authentication may read. The input
+// chooses which server the secrets are sent to, so it mustn't be able to read
+// just any file or credential.
+type mcpSecrets struct {
+	// dir from which secret files may be read. Files may not be read if
+	// empty.
+	dir string
+
+	// allowLLMCredential allows reading the credential the LLM API key is
+	// read from.
+	allowLLMCredential bool
+}
+
+// WithMCPSecretDir allows MCP server authentication to read secret files from
+// the supplied directory.
+func WithMCPSecretDir(dir string) Option {
+	return func(f *Function) {
+		f.mcpSecrets.dir = dir
+	}
+}
+
+// WithMCPLLMCredential allows MCP server authentication to read the credential
+// the LLM API key is read from.
+func WithMCPLLMCredential() Option {
+	return func(f *Function) {
+		f.mcpSecrets.allowLLMCredential = true
+	}
+}
+
+// mcpAuth reads the secrets the supplied authentication configuration
+// references. Errors never include secret values.
+func (f *Function) mcpAuth(req *fnv1.RunFunctionRequest, a *v1alpha1.MCPServerAuth) (tool.Auth, error) {
+	out := tool.Auth{}
+	if a == nil {
+		return out, nil
+	}
+
+	for _, h := range a.Headers {
+		v := h.Value
+		if h.ValueFrom != nil {
+			b, err := f.secret(req, h.ValueFrom)
+			if err != nil {
+				return tool.Auth{}, errors.Wrapf(err, "cannot read value of header %q", h.Name)
+			}
+			v = strings.TrimSpace(string(b))
+		}
+		if out.Headers == nil {
+			out.Headers = map[string]string{}
+		}
+		out.Headers[h.Name] = v
+	}
+
+	if a.BearerToken != nil {
+		b, err := f.secret(req, a.BearerToken)
+		if err != nil {
+			return tool.Auth{}, errors.Wrap(err, "cannot read bearer token")
+		}
+		out.BearerToken = strings.TrimSpace(string(b))
+	}
+
+	if a.TLS == nil {
+		return out, nil
+	}
+	for _, s := range []struct {
+		name string
+		src  *v1alpha1.SecretSource
+		into *[]byte
+	}{
+		{name: "CA certificates", src: a.TLS.CA, into: &out.CA},
+		{name: "client certificate", src: a.TLS.Cert, into: &out.Cert},
+		{name: "client key", src: a.TLS.Key, into: &out.Key},
+	} {
+		if s.src == nil {
+			continue
+		}
+		b, err := f.secret(req, s.src)
+		if err != nil {
+			return tool.Auth{}, errors.Wrapf(err, "cannot read %s", s.name)
+		}
+		*s.into = b
+	}
+	return out, nil
+}
+
+// secret reads the value of the supplied secret source, either from one of
+// the function's credentials or from a file in the MCP secret directory.
+func (f *Function) secret(req *fnv1.RunFunctionRequest, s *v1alpha1.SecretSource) ([]byte, error) {
+	switch {
+	case s.CredentialRef != nil && s.File != "":
+		return nil, errors.New("only one of credentialRef and file may be set")
+	case s.CredentialRef != nil:
+		if s.CredentialRef.Name == credName && !f.mcpSecrets.allowLLMCredential {
+			return nil, errors.Errorf("credential %q holds the LLM API key, and may not be sent to MCP servers unless the function is run with --mcp-allow-llm-credential", credName)
+		}
+		c, err := request.GetCredentials(req, s.CredentialRef.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get credential %q", s.CredentialRef.Name)
+		}
+		if c.Type != resource.CredentialsTypeData {
+			return nil, errors.Errorf("expected credential %q to be %q, got %q", s.CredentialRef.Name, resource.CredentialsTypeData, c.Type)
+		}
+		b, ok := c.Data[s.CredentialRef.Key]
+		if !ok {
+			return nil, errors.Errorf("credential %q is missing key %q", s.CredentialRef.Name, s.CredentialRef.Key)
+		}
+		return b, nil
+	case s.File != "":
+		path, err := f.mcpSecrets.path(s.File)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(path) //nolint:gosec // path is within the MCP secret directory.
+		return b, errors.Wrapf(err, "cannot read file %q", s.File)
+	default:
+		return nil, errors.New("one of credentialRef and file must be set")
+	}
+}
+
+// path returns the supplied secret file's path, which must be within the MCP
+// secret directory. Relative paths are relative to the directory. Symbolic
+// links are resolved, so a link can't escape the directory.
+func (s mcpSecrets) path(file string) (string, error) {
+	if s.dir == "" {
+		return "", errors.Errorf("cannot read file %q: the function must be run with --mcp-secret-dir to read MCP secrets from files", file)
+	}
+	path := filepath.Clean(file)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dir, path)
+	}
+	// Check the path before resolving links, so that nothing outside the
+	// directory is even stat'd.
+	if !within(filepath.Clean(s.dir), path) {
+		return "", errors.Errorf("cannot read file %q: it isn't within the MCP secret directory", file)
+	}
+	dir, err := filepath.EvalSymlinks(s.dir)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot resolve MCP secret directory")
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read file %q", file)
+	}
+	if !within(dir, resolved) {
+		return "", errors.Errorf("cannot read file %q: it isn't within the MCP secret directory", file)
+	}
+	return resolved, nil
+}
+
+// within returns true if the supplied path is within the supplied directory.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && rel != "."
+}
+
+// requiredResource returns the first resource Crossplane supplied for the
+// named requirement, as required or extra resources.
+func requiredResource(req *fnv1.RunFunctionRequest, name string) (map[string]any, bool) {
+	rs, ok := req.GetRequiredResources()[name]
+	if !ok {
+		rs = req.GetExtraResources()[name]
+	}
+	if len(rs.GetItems()) == 0 {
+		return nil, false
+	}
+	return rs.GetItems()[0].GetResource().AsMap(), true
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/tool"
+)
+
+func TestMCPServers(t *testing.T) {
+	// Environment variables configure the docs and search servers.
+	t.Setenv("MCP_SERVER_TOOL_DOCS_TRANSPORT", "sse")
+	t.Setenv("MCP_SERVER_TOOL_DOCS_BASEURL", "http://docs")
+	t.Setenv("MCP_SERVER_TOOL_SEARCH_TRANSPORT", "http-stream")
+	t.Setenv("MCP_SERVER_TOOL_SEARCH_BASEURL", "http://search")
+
+	// Secret files may only be read from the secret directory.
+	secrets := t.TempDir()
+	token := filepath.Join(secrets, "token")
+	if err := os.WriteFile(token, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(outside, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(secrets, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	creds := map[string]*fnv1.Credentials{
+		"mcp": {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+			Data: map[string][]byte{"api-key": []byte("k3y")},
+		}}},
+		credName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+			Data: map[string][]byte{credKey: []byte("sk-llm")},
+		}}},
+	}
+
+	type args struct {
+		servers  []v1alpha1.MCPServer
+		rrs      map[string]*fnv1.Resources
+		creds    map[string]*fnv1.Credentials
+		observed *fnv1.State
+		allowLLM bool
+	}
+	type want struct {
+		cfgs map[string]tool.Config
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"EnvironmentOnly": {
+			reason: "Servers configured by environment variables should be used if the input configures none.",
+			want: want{cfgs: map[string]tool.Config{
+				"docs":   {Transport: tool.SSE, BaseURL: "http://docs"},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search"},
+			}},
+		},
+		"Precedence": {
+			reason: "The input should take precedence over the resource a server is configured from, which should take precedence over environment variables.",
+			args: args{
+				servers: []v1alpha1.MCPServer{
+					{Name: "Docs", AllowedTools: []string{"search-docs"}, From: &v1alpha1.MCPServerSource{Name: "docs-mcp"}},
+					{Name: "search", Disabled: true},
+					{Name: "cloud", Transport: "http-stream", BaseURL: "http://cloud"},
+				},
+				rrs: map[string]*fnv1.Resources{
+					"openai.fn.upbound.io/mcp-server-docs": {Items: []*fnv1.Resource{
+						{Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"docs-mcp"},"data":{"baseURL":"http://docs.example.org","allowedTools":"read-docs, list-docs"}}`)},
+					}},
+				},
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs":  {Transport: tool.SSE, BaseURL: "http://docs.example.org", AllowedTools: []string{"search-docs"}},
+				"cloud": {Transport: tool.StreamableHTTP, BaseURL: "http://cloud"},
+			}},
+		},
+		"Auth": {
+			reason: "Secrets referenced by a server's authentication configuration should be read from the function's credentials and files.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{
+						Headers: []v1alpha1.MCPServerHeader{
+							{Name: "X-Tenant", Value: "acme"},
+							{Name: "X-API-Key", ValueFrom: &v1alpha1.SecretSource{CredentialRef: &v1alpha1.CredentialKeySelector{Name: "mcp", Key: "api-key"}}},
+						},
+						BearerToken: &v1alpha1.SecretSource{File: token},
+					},
+				}},
+				creds: creds,
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs": {
+					Transport: tool.SSE,
+					BaseURL:   "http://docs",
+					Auth: tool.Auth{
+						Headers:     map[string]string{"X-Tenant": "acme", "X-API-Key": "k3y"},
+						BearerToken: "s3cr3t",
+					},
+				},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search"},
+			}},
+		},
+		"RelativeFile": {
+			reason: "Relative secret files should be read from the secret directory.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{File: "token"}},
+				}},
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs":   {Transport: tool.SSE, BaseURL: "http://docs", Auth: tool.Auth{BearerToken: "s3cr3t"}},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search"},
+			}},
+		},
+		"FileOutsideSecretDir": {
+			reason: "We should return an error if a secret file isn't within the secret directory.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{File: outside}},
+				}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"FileEscapesSecretDir": {
+			reason: "We should return an error if a secret file's path escapes the secret directory.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{File: filepath.Join(secrets, "..", filepath.Base(filepath.Dir(outside)), "token")}},
+				}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"SymlinkEscapesSecretDir": {
+			reason: "We should return an error if a secret file links to a file outside the secret directory.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{File: "escape"}},
+				}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"LLMCredential": {
+			reason: "We should return an error if a server's authentication configuration references the LLM API key's credential.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{CredentialRef: &v1alpha1.CredentialKeySelector{Name: credName, Key: credKey}}},
+				}},
+				creds: creds,
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"LLMCredentialAllowed": {
+			reason: "The LLM API key's credential should be read if the function allows it.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{BearerToken: &v1alpha1.SecretSource{CredentialRef: &v1alpha1.CredentialKeySelector{Name: credName, Key: credKey}}},
+				}},
+				creds:    creds,
+				allowLLM: true,
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs":   {Transport: tool.SSE, BaseURL: "http://docs", Auth: tool.Auth{BearerToken: "sk-llm"}},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search"},
+			}},
+		},
+		"MissingCredentialKey": {
+			reason: "We should return an error if a server's authentication configuration references a missing credential key.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{
+						BearerToken: &v1alpha1.SecretSource{CredentialRef: &v1alpha1.CredentialKeySelector{Name: "mcp", Key: "token"}},
+					},
+				}},
+				creds: creds,
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"AmbiguousSecret": {
+			reason: "We should return an error if a secret source sets both a credential and a file.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name: "docs",
+					Auth: &v1alpha1.MCPServerAuth{
+						BearerToken: &v1alpha1.SecretSource{File: token, CredentialRef: &v1alpha1.CredentialKeySelector{Name: "mcp", Key: "api-key"}},
+					},
+				}},
+				creds: creds,
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"MissingResource": {
+			reason: "We should return an error if the resource a server is configured from doesn't exist.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{Name: "docs", From: &v1alpha1.MCPServerSource{Name: "docs-mcp"}}},
+				rrs:     map[string]*fnv1.Resources{"openai.fn.upbound.io/mcp-server-docs": {}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"Invalid": {
+			reason: "We should return an error if a server's merged configuration is invalid.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{Name: "cloud", Transport: "sse"}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"Stdio": {
+			reason: "We should return an error if the input configures a stdio server.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{Name: "kubectl", Transport: "stdio"}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"Policies": {
+			reason: "Tool policies configured by the input should be used.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name:            "docs",
+					DeniedTools:     []string{"delete-*"},
+					ToolArguments:   []v1alpha1.MCPToolArgumentPolicy{{Tool: "search-*", Rule: "size(args.query) < 100", Message: "queries must be short"}},
+					RequireReadOnly: ptr.To(true),
+				}},
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs": {
+					Transport:   tool.SSE,
+					BaseURL:     "http://docs",
+					DeniedTools: []string{"delete-*"},
+					Arguments:   []tool.ArgumentPolicy{{Tool: "search-*", Rule: "size(args.query) < 100", Message: "queries must be short"}},
+					ReadOnly:    true,
+				},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search"},
+			}},
+		},
+		"InvalidArgumentSchema": {
+			reason: "We should return an error if a tool argument policy's schema isn't a JSON Schema.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{
+					Name:          "docs",
+					ToolArguments: []v1alpha1.MCPToolArgumentPolicy{{Tool: "*", Schema: &runtime.RawExtension{Raw: []byte(`["type"]`)}}},
+				}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"CompositionPipeline": {
+			reason: "Servers should require read-only tools in composition pipelines, unless the input says otherwise.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{Name: "docs", RequireReadOnly: ptr.To(false)}},
+				observed: &fnv1.State{Composite: &fnv1.Resource{
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"}}`),
+				}},
+			},
+			want: want{cfgs: map[string]tool.Config{
+				"docs":   {Transport: tool.SSE, BaseURL: "http://docs"},
+				"search": {Transport: tool.StreamableHTTP, BaseURL: "http://search", ReadOnly: true},
+			}},
+		},
+		"Duplicate": {
+			reason: "We should return an error if two servers have the same name.",
+			args: args{
+				servers: []v1alpha1.MCPServer{{Name: "docs"}, {Name: "DOCS"}},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{tools: tool.NewResolver(), mcpSecrets: mcpSecrets{dir: secrets, allowLLMCredential: tc.args.allowLLM}}
+			got, err := f.mcpServers(&fnv1.RunFunctionRequest{RequiredResources: tc.args.rrs, Credentials: tc.args.creds, Observed: tc.args.observed}, &v1alpha1.Prompt{MCPServers: tc.args.servers})
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nmcpServers(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cfgs, got); diff != "" {
+				t.Errorf("%s\nmcpServers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+// mergeComposed combines the supplied generated composed resources with the
+// composed resources desired by previous functions in the pipeline, according
+// to the supplied merge strategy.
+func mergeComposed(log logging.Logger, s v1alpha1.MergeStrategy, desired, generated map[string]*fnv1.Resource) map[string]*fnv1.Resource {
+	if s == "" || s == v1alpha1.MergeReplace {
+		return generated
+	}
+
+	out := make(map[string]*fnv1.Resource, len(desired)+len(generated))
+	for name, dcd := range desired {
+		out[name] = dcd
+	}
+	for name, dcd := range generated {
+		if _, ok := desired[name]; ok && s == v1alpha1.MergeAdditiveOnly {
+			log.Debug("Ignoring generated composed resource that is already desired", "name", name)
+			continue
+		}
+		out[name] = dcd
+	}
+	return out
+}
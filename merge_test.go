@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+func TestMergeComposed(t *testing.T) {
+	cd := func(kind string) *fnv1.Resource {
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"` + kind + `"}`)}
+	}
+	desired := map[string]*fnv1.Resource{"a": cd("Desired"), "b": cd("Desired")}
+	generated := map[string]*fnv1.Resource{"b": cd("Generated"), "c": cd("Generated")}
+
+	cases := map[string]struct {
+		reason   string
+		strategy v1alpha1.MergeStrategy
+		want     map[string]*fnv1.Resource
+	}{
+		"Default": {
+			reason: "Generated composed resources should replace desired composed resources by default.",
+			want:   generated,
+		},
+		"Replace": {
+			reason:   "Generated composed resources should replace desired composed resources.",
+			strategy: v1alpha1.MergeReplace,
+			want:     generated,
+		},
+		"MergeByName": {
+			reason:   "Generated composed resources should replace desired composed resources of the same name.",
+			strategy: v1alpha1.MergeByName,
+			want:     map[string]*fnv1.Resource{"a": cd("Desired"), "b": cd("Generated"), "c": cd("Generated")},
+		},
+		"AdditiveOnly": {
+			reason:   "Only generated composed resources that aren't already desired should be added.",
+			strategy: v1alpha1.MergeAdditiveOnly,
+			want:     map[string]*fnv1.Resource{"a": cd("Desired"), "b": cd("Desired"), "c": cd("Generated")},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := mergeComposed(logging.NewNopLogger(), tc.strategy, desired, generated)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nmergeComposed(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
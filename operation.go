@@ -0,0 +1,158 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/budget"
+)
+
+// defaultMaxConcurrency is the default maximum number of prompts run at once
+// in FanOut mode.
+const defaultMaxConcurrency = 4
+
+// An operationResult is the outcome of prompting GPT to process a batch of
+// watched resources.
+type operationResult struct {
+	// rsp records the results of processing the batch.
+	rsp *fnv1.RunFunctionResponse
+
+	// desired resources GPT returned.
+	desired map[string]*fnv1.Resource
+
+	// proposal awaiting approval in Propose mode, as it's written to the
+	// pipeline context.
+	proposal any
+}
+
+// batchesFor splits the supplied watched resources into the batches processed
+// by each prompt.
+func batchesFor(op *v1alpha1.Operation, rs []resource.Required) [][]resource.Required {
+	if len(rs) == 0 {
+		return nil
+	}
+	if op == nil || op.Mode != v1alpha1.OperationModeFanOut {
+		return [][]resource.Required{rs}
+	}
+	out := make([][]resource.Required, 0, len(rs))
+	for i := range rs {
+		out = append(out, rs[i:i+1])
+	}
+	return out
+}
+
+// maxConcurrency returns the maximum number of prompts to run at once.
+func maxConcurrency(op *v1alpha1.Operation) int {
+	if op == nil || op.MaxConcurrency == nil || *op.MaxConcurrency < 1 {
+		return defaultMaxConcurrency
+	}
+	return *op.MaxConcurrency
+}
+
+// operate prompts GPT to process the supplied batch of watched resources.
+func (f *Function) operate(ctx context.Context, log logging.Logger, d pipelineDetails, vars OperationVariables, batch []resource.Required) (_ *operationResult, err error) {
+	ctx, span := f.startSpan(ctx, "operate", trace.WithAttributes(attrBatchSize.Int(len(batch))))
+	defer func() { endSpan(span, err) }()
+
+	// Record results in a response of our own, so that several batches can
+	// be processed at once.
+	d.rsp = &fnv1.RunFunctionResponse{}
+	out := &operationResult{rsp: d.rsp}
+
+	if d.in.Mode == v1alpha1.PromptModePropose {
+		out.desired, out.proposal, err = f.proposeOperation(ctx, log, d, vars, batch)
+	} else {
+		out.desired, err = f.process(ctx, log, d, vars, batch)
+	}
+	if errors.Is(err, budget.ErrExhausted) {
+		log.Info("Cannot ask GPT to process watched resources", "reason", err.Error())
+		response.Warning(d.rsp, errors.Wrap(err, "cannot ask GPT to process watched resources"))
+		return &operationResult{rsp: d.rsp}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// process prompts GPT to process the supplied batch of watched resources, and
+// returns the desired resources it responds with.
+func (f *Function) process(ctx context.Context, log logging.Logger, d pipelineDetails, vars OperationVariables, batch []resource.Required) (map[string]*fnv1.Resource, error) {
+	var v any = batch[0].Resource.UnstructuredContent()
+	if len(batch) > 1 {
+		objs := make([]map[string]any, len(batch))
+		for i, r := range batch {
+			objs[i] = r.Resource.UnstructuredContent()
+		}
+		v = objs
+	}
+	rb, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal watched resources")
+	}
+	vars.Resources = string(rb)
+
+	prompt, err := renderPrompt(d, &vars)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("Using prompt", "prompt", prompt)
+
+	if d.in.Operation != nil && d.in.Operation.Output == v1alpha1.OperationOutputActions {
+		return f.operateActions(ctx, log, d, prompt, batch)
+	}
+
+	var resp string
+	var desired map[string]*fnv1.Resource
+	var perr error
+	attempt := func(ctx context.Context, prompt string) (string, []string, error) {
+		r, err := f.invoke(ctx, log, d, prompt)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to run chain")
+		}
+		resp = r
+		desired, perr = f.resourceFrom(r)
+		if perr != nil {
+			f.metrics.ParseFailure(metricsLabels(d))
+			return r, []string{perr.Error()}, nil
+		}
+		return r, nil, nil
+	}
+
+	if err := f.repair(ctx, log, d, prompt, attempt); err != nil {
+		return nil, err
+	}
+	if perr != nil {
+		// we didn't get a JSON based response from GPT
+		log.Debug("failed to get a JSON response back, no desired resources will be sent back to crossplane")
+	}
+
+	response.Normal(d.rsp, resp)
+	return desired, nil
+}
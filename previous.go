@@ -0,0 +1,287 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+const (
+	// annotationPreviousOutput records the composed resources GPT previously
+	// generated for a composite resource.
+	annotationPreviousOutput = "openai.fn.upbound.io/previous-output"
+
+	// annotationRegenerate may be set on a composite resource by a user.
+	// Changing its value asks GPT to regenerate composed resources.
+	annotationRegenerate = "openai.fn.upbound.io/regenerate"
+)
+
+// maxPreviousOutputSize is the largest previous output annotation the
+// function records. Kubernetes rejects objects whose annotations total more
+// than 256KiB, so leave room for the composite resource's other annotations.
+const maxPreviousOutputSize = 128 * 1024
+
+// previousOutput is the composed resources GPT previously generated, along
+// with what they were generated from.
+type previousOutput struct {
+	// SpecDigest is the digest of the composite resource's spec, and the
+	// prompts, template parameters and composite output the resources were
+	// generated from.
+	SpecDigest string `json:"specDigest"`
+
+	// Regenerate is the value of the composite resource's regenerate
+	// annotation when the resources were generated.
+	Regenerate string `json:"regenerate,omitempty"`
+
+	// Composite is true if the input allowed GPT to write the composite
+	// resource, in which case any resource named compositeName is the
+	// composite resource's status and connection details.
+	Composite bool `json:"composite,omitempty"`
+
+	// Resources GPT generated.
+	Resources map[string]map[string]any `json:"resources"`
+}
+
+// regeneration determines whether GPT needs to generate composed resources,
+// or whether previously generated ones can be reused.
+type regeneration struct {
+	policy     v1alpha1.RegeneratePolicy
+	digest     string
+	regenerate string
+	composite  bool
+	previous   *previousOutput
+}
+
+// regenerationFor the supplied pipeline. Previous output that can't be read
+// is ignored, and thus regenerated.
+func regenerationFor(d pipelineDetails) (*regeneration, error) {
+	r := &regeneration{policy: d.in.Regenerate, composite: d.in.Composite != nil}
+	if r.policy == "" || r.policy == v1alpha1.RegenerateAlways {
+		return r, nil
+	}
+
+	oxr, err := request.GetObservedCompositeResource(d.req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get observed composite resource")
+	}
+
+	r.digest, err = digestOf(generatedFrom(d, oxr))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot digest composite resource spec")
+	}
+
+	a := oxr.Resource.GetAnnotations()
+	r.regenerate = a[annotationRegenerate]
+	if raw, ok := a[annotationPreviousOutput]; ok {
+		if p, err := decodePreviousOutput(raw); err == nil {
+			r.previous = p
+		}
+	}
+
+	return r, nil
+}
+
+// generatedFrom returns what GPT generates composed resources from: the
+// composite resource's spec, the prompts, the template parameters and what the
+// input allows GPT to write to the composite resource.
+func generatedFrom(d pipelineDetails, oxr *resource.Composite) map[string]any {
+	in := map[string]any{
+		"spec":         oxr.Resource.Object["spec"],
+		"systemPrompt": d.in.SystemPrompt,
+		"userPrompt":   d.in.UserPrompt,
+	}
+	// Only digest template parameters if there are any, so that digests
+	// recorded before templates had parameters still match.
+	if p := parameters(d.in); len(p) > 0 {
+		in["parameters"] = p
+	}
+	// The previous output only includes a composite resource if the input
+	// allowed GPT to write one, so it can't be reused once that changes.
+	if d.in.Composite != nil {
+		in["composite"] = d.in.Composite
+	}
+	return in
+}
+
+// digestOf returns the hex encoded SHA-256 digest of the supplied value's JSON
+// encoding. Maps are encoded with sorted keys, so equal values have equal
+// digests.
+func digestOf(v any) (string, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot marshal digested value")
+	}
+	h := sha256.Sum256(j)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Reusable returns the previously generated composed resources if they can be
+// reused, or false if GPT must generate them.
+func (r *regeneration) Reusable() (map[string]*fnv1.Resource, bool) {
+	if r.previous == nil || r.previous.Regenerate != r.regenerate {
+		return nil, false
+	}
+	if r.policy == v1alpha1.RegenerateOnSpecChange && r.previous.SpecDigest != r.digest {
+		return nil, false
+	}
+
+	out, err := r.previous.desired(r.composite)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// desired returns the previously generated composed resources. The composite
+// resource GPT previously generated is omitted unless the input still allows
+// GPT to write it, so it's never mistaken for a composed resource.
+func (p *previousOutput) desired(composite bool) (map[string]*fnv1.Resource, error) {
+	out := make(map[string]*fnv1.Resource, len(p.Resources))
+	for name, obj := range p.Resources {
+		if p.Composite && !composite && name == compositeName {
+			continue
+		}
+		s, err := structpb.NewStruct(obj)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot convert previously generated composed resource %q", name)
+		}
+		out[name] = &fnv1.Resource{Resource: s}
+	}
+	return out, nil
+}
+
+// Record the supplied composed resources as the desired composite resource's
+// previous output. The record must be written every time the function runs,
+// or it would be removed when Crossplane applies the desired composite
+// resource. A Warning result is returned instead if the record is too large
+// to store in an annotation, in which case GPT will generate the composed
+// resources again next time.
+func (r *regeneration) Record(rsp *fnv1.RunFunctionResponse, dcds map[string]*fnv1.Resource) error {
+	if r.policy == "" || r.policy == v1alpha1.RegenerateAlways {
+		return nil
+	}
+
+	p := &previousOutput{
+		SpecDigest: r.digest,
+		Regenerate: r.regenerate,
+		Composite:  r.composite,
+		Resources:  make(map[string]map[string]any, len(dcds)),
+	}
+	for name, dcd := range dcds {
+		p.Resources[name] = dcd.GetResource().AsMap()
+	}
+	raw, err := encodePreviousOutput(p)
+	if err != nil {
+		return err
+	}
+	if len(raw) > maxPreviousOutputSize {
+		response.Warning(rsp, errors.Errorf("cannot record previously generated composed resources: the %s annotation would be %d bytes, more than the maximum of %d bytes; composed resources will be generated again next time", annotationPreviousOutput, len(raw), maxPreviousOutputSize))
+		return nil
+	}
+
+	return setCompositeAnnotation(rsp, annotationPreviousOutput, raw)
+}
+
+// encodePreviousOutput encodes the supplied previous output using
+// encodeAnnotation.
+func encodePreviousOutput(p *previousOutput) (string, error) {
+	return encodeAnnotation(p)
+}
+
+// decodePreviousOutput decodes previous output recorded by
+// encodePreviousOutput. It also reads the plain JSON previous output recorded
+// by earlier versions of the function.
+func decodePreviousOutput(raw string) (*previousOutput, error) {
+	p := &previousOutput{}
+	if strings.HasPrefix(raw, "{") {
+		return p, errors.Wrap(json.Unmarshal([]byte(raw), p), "cannot unmarshal previous output")
+	}
+	return p, decodeAnnotation(raw, p)
+}
+
+// encodeAnnotation encodes the supplied value as gzipped, base64 encoded JSON,
+// so that it takes as little annotation space as possible.
+func encodeAnnotation(v any) (string, error) {
+	b := &bytes.Buffer{}
+	w := base64.NewEncoder(base64.StdEncoding, b)
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return "", errors.Wrap(err, "cannot marshal annotation")
+	}
+	if err := zw.Close(); err != nil {
+		return "", errors.Wrap(err, "cannot compress annotation")
+	}
+	if err := w.Close(); err != nil {
+		return "", errors.Wrap(err, "cannot encode annotation")
+	}
+	return b.String(), nil
+}
+
+// decodeAnnotation decodes a value encoded by encodeAnnotation into v.
+func decodeAnnotation(raw string, v any) error {
+	zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, strings.NewReader(raw)))
+	if err != nil {
+		return errors.Wrap(err, "cannot decompress annotation")
+	}
+	return errors.Wrap(json.NewDecoder(zr).Decode(v), "cannot unmarshal annotation")
+}
+
+// setCompositeAnnotation sets the supplied annotation on the desired composite
+// resource of the supplied response.
+func setCompositeAnnotation(rsp *fnv1.RunFunctionResponse, key, value string) error {
+	xr := composite.New()
+	if err := resource.AsObject(rsp.GetDesired().GetComposite().GetResource(), xr); err != nil {
+		return errors.Wrap(err, "cannot get desired composite resource")
+	}
+
+	a := xr.GetAnnotations()
+	if a == nil {
+		a = map[string]string{}
+	}
+	a[key] = value
+	xr.SetAnnotations(a)
+
+	s, err := resource.AsStruct(xr)
+	if err != nil {
+		return errors.Wrap(err, "cannot set desired composite resource")
+	}
+	if rsp.GetDesired() == nil {
+		rsp.Desired = &fnv1.State{}
+	}
+	if rsp.GetDesired().GetComposite() == nil {
+		rsp.Desired.Composite = &fnv1.Resource{}
+	}
+	rsp.Desired.Composite.Resource = s
+	return nil
+}
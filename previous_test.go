@@ -0,0 +1,340 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+func TestRegeneration(t *testing.T) {
+	generated := map[string]*fnv1.Resource{
+		"some-name": {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Some"}`)},
+	}
+
+	// xr returns an observed composite resource with the supplied spec and
+	// annotations.
+	xr := func(size string, annotations map[string]string) *fnv1.Resource {
+		a, _ := json.Marshal(annotations)
+		return &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "example.org/v1",
+			"kind": "XR",
+			"metadata": {"name": "cool-xr", "annotations": ` + string(a) + `},
+			"spec": {"size": "` + size + `"}
+		}`)}
+	}
+
+	// in returns an input with the supplied policy and template parameters.
+	in := func(policy v1alpha1.RegeneratePolicy, params map[string]string) *v1alpha1.Prompt {
+		p := &v1alpha1.Prompt{UserPrompt: "compose", Regenerate: policy}
+		if params != nil {
+			p.Template = &v1alpha1.TemplateRef{Name: "compose-resources", Parameters: params}
+		}
+		return p
+	}
+
+	// previous returns the output previously recorded for an XR of the
+	// supplied size, regenerate annotation and template parameters.
+	previous := func(policy v1alpha1.RegeneratePolicy, size, regenerate string, params map[string]string) string {
+		d := pipelineDetails{
+			req: &fnv1.RunFunctionRequest{Observed: &fnv1.State{Composite: xr(size, map[string]string{annotationRegenerate: regenerate})}},
+			rsp: &fnv1.RunFunctionResponse{},
+			in:  in(policy, params),
+		}
+		r, err := regenerationFor(d)
+		if err != nil {
+			t.Fatalf("regenerationFor(...): %v", err)
+		}
+		if err := r.Record(d.rsp, generated); err != nil {
+			t.Fatalf("Record(...): %v", err)
+		}
+		return d.rsp.GetDesired().GetComposite().GetResource().GetFields()["metadata"].GetStructValue().GetFields()["annotations"].GetStructValue().GetFields()[annotationPreviousOutput].GetStringValue()
+	}
+
+	// legacy returns the supplied previous output as the plain JSON earlier
+	// versions of the function recorded.
+	legacy := func(raw string) string {
+		p, err := decodePreviousOutput(raw)
+		if err != nil {
+			t.Fatalf("decodePreviousOutput(...): %v", err)
+		}
+		j, _ := json.Marshal(p)
+		return string(j)
+	}
+
+	type args struct {
+		policy v1alpha1.RegeneratePolicy
+		params map[string]string
+		xr     *fnv1.Resource
+	}
+	type want struct {
+		dcds map[string]*fnv1.Resource
+		ok   bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Always": {
+			reason: "Previous output should never be reused when always regenerating.",
+			args: args{
+				policy: v1alpha1.RegenerateAlways,
+				xr:     xr("large", map[string]string{annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", nil)}),
+			},
+		},
+		"NoPreviousOutput": {
+			reason: "Composed resources should be generated if there's no previous output.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr:     xr("large", nil),
+			},
+		},
+		"UnreadablePreviousOutput": {
+			reason: "Composed resources should be generated if the previous output can't be read.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr:     xr("large", map[string]string{annotationPreviousOutput: "{"}),
+			},
+		},
+		"OnSpecChangeUnchanged": {
+			reason: "Previous output should be reused if the spec is unchanged.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr:     xr("large", map[string]string{annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", nil)}),
+			},
+			want: want{dcds: generated, ok: true},
+		},
+		"OnSpecChangeLegacyUnchanged": {
+			reason: "Previous output recorded as plain JSON should be reused if the spec is unchanged.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr:     xr("large", map[string]string{annotationPreviousOutput: legacy(previous(v1alpha1.RegenerateOnSpecChange, "large", "", nil))}),
+			},
+			want: want{dcds: generated, ok: true},
+		},
+		"OnSpecChangeSpecChanged": {
+			reason: "Composed resources should be regenerated if the spec changed.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr:     xr("small", map[string]string{annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", nil)}),
+			},
+		},
+		"OnSpecChangeParametersUnchanged": {
+			reason: "Previous output should be reused if the spec and template parameters are unchanged.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				params: map[string]string{"instructions": "compose a bucket"},
+				xr:     xr("large", map[string]string{annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", map[string]string{"instructions": "compose a bucket"})}),
+			},
+			want: want{dcds: generated, ok: true},
+		},
+		"OnSpecChangeParametersChanged": {
+			reason: "Composed resources should be regenerated if the template parameters changed.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				params: map[string]string{"instructions": "compose a database"},
+				xr:     xr("large", map[string]string{annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", map[string]string{"instructions": "compose a bucket"})}),
+			},
+		},
+		"OnSpecChangeRegenerateAnnotationChanged": {
+			reason: "Composed resources should be regenerated if the regenerate annotation changed.",
+			args: args{
+				policy: v1alpha1.RegenerateOnSpecChange,
+				xr: xr("large", map[string]string{
+					annotationPreviousOutput: previous(v1alpha1.RegenerateOnSpecChange, "large", "", nil),
+					annotationRegenerate:     "1",
+				}),
+			},
+		},
+		"ManualSpecChanged": {
+			reason: "Previous output should be reused if the spec changed but the regenerate annotation didn't.",
+			args: args{
+				policy: v1alpha1.RegenerateManual,
+				xr: xr("small", map[string]string{
+					annotationPreviousOutput: previous(v1alpha1.RegenerateManual, "large", "1", nil),
+					annotationRegenerate:     "1",
+				}),
+			},
+			want: want{dcds: generated, ok: true},
+		},
+		"ManualRegenerateAnnotationChanged": {
+			reason: "Composed resources should be regenerated if the regenerate annotation changed.",
+			args: args{
+				policy: v1alpha1.RegenerateManual,
+				xr: xr("large", map[string]string{
+					annotationPreviousOutput: previous(v1alpha1.RegenerateManual, "large", "1", nil),
+					annotationRegenerate:     "2",
+				}),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := pipelineDetails{
+				req: &fnv1.RunFunctionRequest{Observed: &fnv1.State{Composite: tc.args.xr}},
+				in:  in(tc.args.policy, tc.args.params),
+			}
+			r, err := regenerationFor(d)
+			if err != nil {
+				t.Fatalf("\n%s\nregenerationFor(...): %v", tc.reason, err)
+			}
+
+			dcds, ok := r.Reusable()
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nReusable(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.dcds, dcds, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nReusable(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRegenerationComposite(t *testing.T) {
+	generated := map[string]*fnv1.Resource{
+		"some-name":   {Resource: resource.MustStructJSON(`{"apiVersion":"some.group/v1","kind":"Some"}`)},
+		compositeName: {Resource: resource.MustStructJSON(`{"status":{"ready":true}}`)},
+	}
+	composite := &v1alpha1.CompositeOutput{StatusPaths: []string{"status.ready"}}
+
+	// run returns the previously generated resources reusable by an input
+	// with the supplied policy and composite output, given output previously
+	// recorded for an input with the supplied composite output.
+	run := func(policy v1alpha1.RegeneratePolicy, recorded, current *v1alpha1.CompositeOutput) (map[string]*fnv1.Resource, bool) {
+		oxr := func(annotations map[string]string) *fnv1.State {
+			a, _ := json.Marshal(annotations)
+			return &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "example.org/v1",
+				"kind": "XR",
+				"metadata": {"name": "cool-xr", "annotations": ` + string(a) + `},
+				"spec": {"size": "large"}
+			}`)}}
+		}
+
+		d := pipelineDetails{
+			req: &fnv1.RunFunctionRequest{Observed: oxr(nil)},
+			rsp: &fnv1.RunFunctionResponse{},
+			in:  &v1alpha1.Prompt{UserPrompt: "compose", Regenerate: policy, Composite: recorded},
+		}
+		r, err := regenerationFor(d)
+		if err != nil {
+			t.Fatalf("regenerationFor(...): %v", err)
+		}
+		if err := r.Record(d.rsp, generated); err != nil {
+			t.Fatalf("Record(...): %v", err)
+		}
+		raw := d.rsp.GetDesired().GetComposite().GetResource().GetFields()["metadata"].GetStructValue().GetFields()["annotations"].GetStructValue().GetFields()[annotationPreviousOutput].GetStringValue()
+
+		d = pipelineDetails{
+			req: &fnv1.RunFunctionRequest{Observed: oxr(map[string]string{annotationPreviousOutput: raw})},
+			in:  &v1alpha1.Prompt{UserPrompt: "compose", Regenerate: policy, Composite: current},
+		}
+		r, err = regenerationFor(d)
+		if err != nil {
+			t.Fatalf("regenerationFor(...): %v", err)
+		}
+		return r.Reusable()
+	}
+
+	type args struct {
+		policy   v1alpha1.RegeneratePolicy
+		recorded *v1alpha1.CompositeOutput
+		current  *v1alpha1.CompositeOutput
+	}
+	type want struct {
+		dcds map[string]*fnv1.Resource
+		ok   bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"OnSpecChangeUnchanged": {
+			reason: "Previous output, including the composite resource, should be reused if the composite output is unchanged.",
+			args:   args{policy: v1alpha1.RegenerateOnSpecChange, recorded: composite, current: composite},
+			want:   want{dcds: generated, ok: true},
+		},
+		"OnSpecChangeCompositeDisabled": {
+			reason: "Composed resources should be regenerated if the input no longer allows GPT to write the composite resource.",
+			args:   args{policy: v1alpha1.RegenerateOnSpecChange, recorded: composite},
+		},
+		"ManualCompositeDisabled": {
+			reason: "The previously generated composite resource shouldn't be reused as a composed resource once the input no longer allows GPT to write it.",
+			args:   args{policy: v1alpha1.RegenerateManual, recorded: composite},
+			want: want{
+				dcds: map[string]*fnv1.Resource{"some-name": generated["some-name"]},
+				ok:   true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dcds, ok := run(tc.args.policy, tc.args.recorded, tc.args.current)
+			if diff := cmp.Diff(tc.want.ok, ok); diff != "" {
+				t.Errorf("\n%s\nReusable(...): -want ok, +got ok:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.dcds, dcds, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nReusable(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRecordTooLarge(t *testing.T) {
+	// Random data doesn't compress, so its encoding exceeds the maximum.
+	b := make([]byte, maxPreviousOutputSize)
+	_, _ = rand.Read(b)
+	dcds := map[string]*fnv1.Resource{
+		"some-name": {Resource: resource.MustStructJSON(`{"data":"` + base64.StdEncoding.EncodeToString(b) + `"}`)},
+	}
+
+	d := pipelineDetails{
+		req: &fnv1.RunFunctionRequest{Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{"spec":{}}`)}}},
+		rsp: &fnv1.RunFunctionResponse{},
+		in:  &v1alpha1.Prompt{UserPrompt: "compose", Regenerate: v1alpha1.RegenerateOnSpecChange},
+	}
+	r, err := regenerationFor(d)
+	if err != nil {
+		t.Fatalf("regenerationFor(...): %v", err)
+	}
+	if err := r.Record(d.rsp, dcds); err != nil {
+		t.Fatalf("Record(...): %v", err)
+	}
+
+	if d.rsp.GetDesired().GetComposite() != nil {
+		t.Errorf("Record(...): want no previous output annotation when it's too large")
+	}
+	if len(d.rsp.GetResults()) != 1 || d.rsp.GetResults()[0].GetSeverity() != fnv1.Severity_SEVERITY_WARNING {
+		t.Errorf("Record(...): want a Warning result when the previous output is too large, got %v", d.rsp.GetResults())
+	}
+}
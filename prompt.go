@@ -0,0 +1,74 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/prompt"
+)
+
+// resolvePrompts fills in any prompts the input omits from the template it
+// references. Templates supplied as required or extra resources take
+// precedence over the function's own templates.
+func (f *Function) resolvePrompts(req *fnv1.RunFunctionRequest, in *v1alpha1.Prompt) error {
+	if in.Template != nil {
+		supplied := prompt.FromConfigMaps(suppliedResources(req))
+		t, ok := prompt.Lookup(in.Template.Name, supplied, f.templates)
+		if !ok {
+			return errors.Errorf("unknown prompt template %q: must be one of %v", in.Template.Name, prompt.Names(supplied, f.templates))
+		}
+		if in.SystemPrompt == "" {
+			in.SystemPrompt = t.SystemPrompt
+		}
+		if in.UserPrompt == "" {
+			in.UserPrompt = t.UserPrompt
+		}
+	}
+
+	if in.UserPrompt == "" {
+		return errors.New("a userPrompt is required, either in the input or from its template")
+	}
+	return nil
+}
+
+// parameters returns the input's template parameters.
+func parameters(in *v1alpha1.Prompt) map[string]string {
+	if in.Template == nil {
+		return nil
+	}
+	return in.Template.Parameters
+}
+
+// suppliedResources returns the required and extra resources supplied to the
+// function.
+func suppliedResources(req *fnv1.RunFunctionRequest) []map[string]any {
+	out := make([]map[string]any, 0)
+	for _, rs := range req.GetRequiredResources() {
+		for _, r := range rs.GetItems() {
+			out = append(out, r.GetResource().AsMap())
+		}
+	}
+	for _, rs := range req.GetExtraResources() {
+		for _, r := range rs.GetItems() {
+			out = append(out, r.GetResource().AsMap())
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/prompt"
+)
+
+func TestResolvePrompts(t *testing.T) {
+	templates := prompt.Library{
+		"builtin":  {SystemPrompt: "builtin system", UserPrompt: "builtin user"},
+		"shadowed": {SystemPrompt: "builtin system", UserPrompt: "builtin user"},
+	}
+	req := &fnv1.RunFunctionRequest{
+		RequiredResources: map[string]*fnv1.Resources{
+			"templates": {Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{
+				"apiVersion": "v1",
+				"kind": "ConfigMap",
+				"metadata": {"name": "shadowed"},
+				"data": {"systemPrompt": "configmap system", "userPrompt": "configmap user"}
+			}`)}}},
+		},
+	}
+
+	type want struct {
+		in  *v1alpha1.Prompt
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		in     *v1alpha1.Prompt
+		want   want
+	}{
+		"NoTemplate": {
+			reason: "The input's prompts should be used as is if it doesn't reference a template.",
+			in:     &v1alpha1.Prompt{SystemPrompt: "system", UserPrompt: "user"},
+			want: want{
+				in: &v1alpha1.Prompt{SystemPrompt: "system", UserPrompt: "user"},
+			},
+		},
+		"MissingUserPrompt": {
+			reason: "A user prompt is required.",
+			in:     &v1alpha1.Prompt{SystemPrompt: "system"},
+			want: want{
+				in:  &v1alpha1.Prompt{SystemPrompt: "system"},
+				err: cmpopts.AnyError,
+			},
+		},
+		"Builtin": {
+			reason: "Prompts the input omits should be taken from the referenced template.",
+			in:     &v1alpha1.Prompt{UserPrompt: "user", Template: &v1alpha1.TemplateRef{Name: "builtin"}},
+			want: want{
+				in: &v1alpha1.Prompt{SystemPrompt: "builtin system", UserPrompt: "user", Template: &v1alpha1.TemplateRef{Name: "builtin"}},
+			},
+		},
+		"ConfigMap": {
+			reason: "Templates supplied as required resources should take precedence over the function's templates.",
+			in:     &v1alpha1.Prompt{Template: &v1alpha1.TemplateRef{Name: "shadowed"}},
+			want: want{
+				in: &v1alpha1.Prompt{SystemPrompt: "configmap system", UserPrompt: "configmap user", Template: &v1alpha1.TemplateRef{Name: "shadowed"}},
+			},
+		},
+		"UnknownTemplate": {
+			reason: "Referencing an unknown template should return an error.",
+			in:     &v1alpha1.Prompt{Template: &v1alpha1.TemplateRef{Name: "unknown"}},
+			want: want{
+				in:  &v1alpha1.Prompt{Template: &v1alpha1.TemplateRef{Name: "unknown"}},
+				err: cmpopts.AnyError,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{templates: templates}
+			err := f.resolvePrompts(req, tc.in)
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nresolvePrompts(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.in, tc.in); diff != "" {
+				t.Errorf("\n%s\nresolvePrompts(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,547 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/internal/budget"
+)
+
+const (
+	// annotationProposal records what GPT proposed in Propose mode, on the
+	// composite resource or on the watched resources of an operation.
+	annotationProposal = "openai.fn.upbound.io/proposal"
+
+	// annotationApprovedProposal may be set by a user to the digest of a
+	// proposal to apply it.
+	annotationApprovedProposal = "openai.fn.upbound.io/approved-proposal"
+
+	// contextKeyProposals is the pipeline context key the function writes
+	// pending proposals to, so that later functions in the pipeline can
+	// act on them.
+	contextKeyProposals = "openai.fn.upbound.io/proposals"
+)
+
+// maxProposalSize is the largest proposal annotation the function records. Like
+// previous output, it must leave room for the resource's other annotations.
+const maxProposalSize = 128 * 1024
+
+// redacted replaces composite resource connection details in reported
+// proposals, so that their values aren't exposed in results.
+const redacted = "(redacted)"
+
+// Operations a proposal may make to a resource.
+const (
+	changeCreate = "Create"
+	changeUpdate = "Update"
+	changeDelete = "Delete"
+)
+
+// A proposal is what GPT generated in Propose mode.
+type proposal struct {
+	// Digest identifies the proposal. It's the digest of its resources.
+	Digest string `json:"digest"`
+
+	// Resources GPT generated.
+	Resources map[string]map[string]any `json:"resources"`
+}
+
+// newProposal returns a proposal to apply the supplied resources.
+func newProposal(rs map[string]*fnv1.Resource) (*proposal, error) {
+	p := &proposal{Resources: make(map[string]map[string]any, len(rs))}
+	for name, r := range rs {
+		p.Resources[name] = r.GetResource().AsMap()
+	}
+	digest, err := digestOf(p.Resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot digest proposal")
+	}
+	p.Digest = digest
+	return p, nil
+}
+
+// desired returns the proposal's resources as desired resources.
+func (p *proposal) desired() (map[string]*fnv1.Resource, error) {
+	out := make(map[string]*fnv1.Resource, len(p.Resources))
+	for name, obj := range p.Resources {
+		s, err := structpb.NewStruct(obj)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot convert proposed resource %q", name)
+		}
+		out[name] = &fnv1.Resource{Resource: s}
+	}
+	return out, nil
+}
+
+// A proposalRecord is recorded in the proposal annotation.
+type proposalRecord struct {
+	// InputDigest is the digest of what GPT generated the pending proposal
+	// from. GPT isn't asked again until it changes.
+	InputDigest string `json:"inputDigest"`
+
+	// Pending is the proposal awaiting approval, if any.
+	Pending *proposal `json:"pending,omitempty"`
+
+	// Applied is the approved proposal whose resources are desired. Only
+	// recorded in composition pipelines, where the composed resources must
+	// be desired every time the function runs.
+	Applied *proposal `json:"applied,omitempty"`
+}
+
+// proposalRecordFrom returns the proposal record in the supplied annotations. A
+// record that can't be read is ignored, and thus proposed again.
+func proposalRecordFrom(a map[string]string) *proposalRecord {
+	r := &proposalRecord{}
+	raw, ok := a[annotationProposal]
+	if !ok {
+		return r
+	}
+	if err := decodeAnnotation(raw, r); err != nil {
+		return &proposalRecord{}
+	}
+	return r
+}
+
+// approve returns the pending proposal, and removes it from the record, if its
+// digest is one of the supplied approved digests. It returns nil otherwise.
+func (r *proposalRecord) approve(approved ...string) *proposal {
+	if r.Pending == nil || !slices.Contains(approved, r.Pending.Digest) {
+		return nil
+	}
+	p := r.Pending
+	r.Pending = nil
+	return p
+}
+
+// encode the record for the proposal annotation. A Warning result is returned
+// instead if the record is too large to store in an annotation, in which case
+// false is returned.
+func (r *proposalRecord) encode(rsp *fnv1.RunFunctionResponse) (string, bool, error) {
+	raw, err := encodeAnnotation(r)
+	if err != nil {
+		return "", false, errors.Wrap(err, "cannot encode proposal")
+	}
+	if len(raw) > maxProposalSize {
+		response.Warning(rsp, errors.Errorf("cannot record proposal: the %s annotation would be %d bytes, more than the maximum of %d bytes; the proposal can't be approved", annotationProposal, len(raw), maxProposalSize))
+		return "", false, nil
+	}
+	return raw, true, nil
+}
+
+// A resourceChange is a change a proposal makes to a resource.
+type resourceChange struct {
+	// Resource changed.
+	Resource string `json:"resource"`
+
+	// Operation is Create, Update or Delete.
+	Operation string `json:"operation"`
+
+	// Fields the proposal sets that differ from the observed resource.
+	Fields []fieldChange `json:"fields,omitempty"`
+}
+
+// A fieldChange is a change a proposal makes to a field of a resource.
+type fieldChange struct {
+	Path     string `json:"path"`
+	Observed any    `json:"observed,omitempty"`
+	Proposed any    `json:"proposed,omitempty"`
+}
+
+// proposedChanges returns how the supplied proposed resources differ from the
+// observed resources. Only fields the proposal sets are compared, because
+// observed resources include fields set by the API server and controllers.
+// Previously applied resources the proposal omits are deleted.
+func proposedChanges(observed, applied, proposed map[string]map[string]any) []resourceChange {
+	out := make([]resourceChange, 0)
+	for _, name := range sortedKeys(proposed) {
+		obs, ok := observed[name]
+		c := resourceChange{Resource: name, Operation: changeUpdate}
+		if !ok {
+			c.Operation = changeCreate
+		}
+		diffFields("", obs, proposed[name], &c.Fields)
+		if c.Operation == changeUpdate && len(c.Fields) == 0 {
+			continue
+		}
+		out = append(out, c)
+	}
+	for _, name := range sortedKeys(applied) {
+		if _, ok := proposed[name]; !ok {
+			out = append(out, resourceChange{Resource: name, Operation: changeDelete})
+		}
+	}
+	return out
+}
+
+// diffFields appends a change for each field of proposed that differs from
+// observed to out. Arrays are compared as a whole.
+func diffFields(path string, observed, proposed any, out *[]fieldChange) {
+	p, ok := proposed.(map[string]any)
+	o, isMap := observed.(map[string]any)
+	if ok && (isMap || observed == nil) {
+		for _, k := range sortedKeys(p) {
+			diffFields(join(path, k), o[k], p[k], out)
+		}
+		return
+	}
+	if !reflect.DeepEqual(observed, proposed) {
+		*out = append(*out, fieldChange{Path: path, Observed: observed, Proposed: proposed})
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// reportProposal returns a Normal result for each change the supplied proposal
+// makes, and one explaining how to approve it. The changes are returned as
+// JSON, so that they can be read by tools.
+func reportProposal(rsp *fnv1.RunFunctionResponse, p *proposal, changes []resourceChange, approveOn string) error {
+	for _, c := range changes {
+		j, err := json.Marshal(c)
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal proposed change")
+		}
+		response.Normalf(rsp, "Proposal %s: %s", p.Digest, j)
+	}
+	response.Normalf(rsp, "Proposal %s changes %d resources; annotate the %s with %s=%s to apply it", p.Digest, len(changes), approveOn, annotationApprovedProposal, p.Digest)
+	return nil
+}
+
+// proposalContext returns the supplied pending proposal as it's written to
+// the pipeline context.
+func proposalContext(p *proposal, resources map[string]map[string]any, changes []resourceChange) (any, error) {
+	j, err := json.Marshal(map[string]any{
+		"digest":    p.Digest,
+		"resources": resources,
+		"changes":   changes,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal proposal")
+	}
+	var out any
+	return out, errors.Wrap(json.Unmarshal(j, &out), "cannot unmarshal proposal")
+}
+
+// setProposalsContext writes the supplied pending proposals to the pipeline
+// context.
+func setProposalsContext(rsp *fnv1.RunFunctionResponse, proposals []any) error {
+	v, err := structpb.NewValue(proposals)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert proposals for the pipeline context")
+	}
+	response.SetContextKey(rsp, contextKeyProposals, v)
+	return nil
+}
+
+// proposeComposition runs the composition pipeline in Propose mode. GPT's
+// composed resources are recorded as a proposal in an annotation of the
+// composite resource, rather than desired. Once the proposal is approved its
+// composed resources are desired every time the function runs, until another
+// proposal is approved.
+func (f *Function) proposeComposition(ctx context.Context, log logging.Logger, d pipelineDetails) (*fnv1.RunFunctionResponse, error) {
+	oxr, err := request.GetObservedCompositeResource(d.req)
+	if err != nil {
+		response.Fatal(d.rsp, errors.Wrap(err, "cannot get observed composite resource"))
+		return d.rsp, err
+	}
+	a := oxr.Resource.GetAnnotations()
+
+	rec := proposalRecordFrom(a)
+	if p := rec.approve(a[annotationApprovedProposal]); p != nil {
+		log.Debug("Applying approved proposal", "digest", p.Digest)
+		response.Normalf(d.rsp, "Applying approved proposal %s", p.Digest)
+		rec.Applied = p
+	}
+
+	in := generatedFrom(d, oxr)
+	if r := a[annotationRegenerate]; r != "" {
+		in["regenerate"] = r
+	}
+	digest, err := digestOf(in)
+	if err != nil {
+		response.Fatal(d.rsp, errors.Wrap(err, "cannot digest composite resource spec"))
+		return d.rsp, err
+	}
+
+	if rec.InputDigest != digest {
+		p, err := f.propose(ctx, log, d)
+		switch {
+		case errors.Is(err, budget.ErrExhausted):
+			// Keep the current proposal. GPT is asked again next time,
+			// because the input digest is unchanged.
+			log.Info("Cannot ask GPT to propose composed resources", "reason", err.Error())
+			response.Warning(d.rsp, errors.Wrap(err, "cannot ask GPT to propose composed resources; keeping the current proposal"))
+		case err != nil:
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		default:
+			rec.InputDigest = digest
+			rec.Pending = p
+			if rec.Applied != nil && rec.Applied.Digest == p.Digest {
+				rec.Pending = nil
+			}
+		}
+	}
+
+	if rec.Pending != nil {
+		var applied map[string]map[string]any
+		if rec.Applied != nil {
+			applied = rec.Applied.Resources
+		}
+		observed, proposed := compositionProposalState(d, rec.Pending)
+		changes := proposedChanges(observed, applied, proposed)
+		if err := reportProposal(d.rsp, rec.Pending, changes, "composite resource"); err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+		pc, err := proposalContext(rec.Pending, proposed, changes)
+		if err == nil {
+			err = setProposalsContext(d.rsp, []any{pc})
+		}
+		if err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+	}
+
+	if rec.Applied != nil {
+		dcds, err := rec.Applied.desired()
+		if err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+		dcds, xr := splitComposite(d.in.Composite, dcds)
+		if err := f.applyComposite(d, xr); err != nil {
+			response.Fatal(d.rsp, err)
+			return d.rsp, err
+		}
+		d.rsp.Desired.Resources = mergeComposed(log, d.in.Merge, d.req.GetDesired().GetResources(), dcds)
+	}
+
+	// The record must be written every time the function runs, or it would
+	// be removed when Crossplane applies the desired composite resource.
+	raw, ok, err := rec.encode(d.rsp)
+	if err == nil && ok {
+		err = setCompositeAnnotation(d.rsp, annotationProposal, raw)
+	}
+	if err != nil {
+		response.Fatal(d.rsp, err)
+		return d.rsp, err
+	}
+
+	if rec.Applied != nil {
+		f.readiness(ctx, log, d)
+	}
+	return d.rsp, nil
+}
+
+// propose asks GPT to generate composed resources, and returns them as a
+// proposal.
+func (f *Function) propose(ctx context.Context, log logging.Logger, d pipelineDetails) (*proposal, error) {
+	generated, err := f.generate(ctx, log, d)
+	if err != nil {
+		return nil, err
+	}
+	composed, _ := splitComposite(d.in.Composite, generated)
+	if err := f.guard(d, mergeComposed(log, d.in.Merge, d.req.GetDesired().GetResources(), composed)); err != nil {
+		return nil, err
+	}
+	return newProposal(generated)
+}
+
+// compositionProposalState returns the observed resources the supplied
+// proposal is compared to, and the proposed resources with any composite
+// resource connection details redacted.
+func compositionProposalState(d pipelineDetails, p *proposal) (observed, proposed map[string]map[string]any) {
+	observed = make(map[string]map[string]any, len(d.req.GetObserved().GetResources())+1)
+	for name, ocd := range d.req.GetObserved().GetResources() {
+		observed[name] = ocd.GetResource().AsMap()
+	}
+
+	proposed = make(map[string]map[string]any, len(p.Resources))
+	for name, obj := range p.Resources {
+		proposed[name] = obj
+	}
+	if d.in.Composite == nil {
+		return observed, proposed
+	}
+
+	oxr := d.req.GetObserved().GetComposite()
+	ocds := make(map[string]any, len(oxr.GetConnectionDetails()))
+	for k := range oxr.GetConnectionDetails() {
+		ocds[k] = redacted
+	}
+	observed[compositeName] = map[string]any{"status": oxr.GetResource().AsMap()["status"], "connectionDetails": ocds}
+
+	if xr, ok := proposed[compositeName]; ok {
+		cxr := make(map[string]any, len(xr))
+		for k, v := range xr {
+			cxr[k] = v
+		}
+		if cds, ok := xr["connectionDetails"].(map[string]any); ok {
+			rcds := make(map[string]any, len(cds))
+			for k := range cds {
+				rcds[k] = redacted
+			}
+			cxr["connectionDetails"] = rcds
+		}
+		proposed[compositeName] = cxr
+	}
+	return observed, proposed
+}
+
+// proposeOperation processes the supplied batch of watched resources in
+// Propose mode. The resources GPT returns are recorded as a proposal in an
+// annotation of each watched resource, rather than desired. They're desired
+// once the proposal is approved. It returns the desired resources, and the
+// pending proposal to write to the pipeline context, if any.
+func (f *Function) proposeOperation(ctx context.Context, log logging.Logger, d pipelineDetails, vars OperationVariables, batch []resource.Required) (map[string]*fnv1.Resource, any, error) {
+	rec := &proposalRecord{}
+	approved := make([]string, 0, len(batch))
+	observed := make(map[string]map[string]any, len(batch))
+	inputs := make([]map[string]any, len(batch))
+	for i, w := range batch {
+		a := w.Resource.GetAnnotations()
+		if _, ok := a[annotationProposal]; ok && rec.InputDigest == "" {
+			rec = proposalRecordFrom(a)
+		}
+		approved = append(approved, a[annotationApprovedProposal])
+		observed[objectKey(w.Resource.GetNamespace(), w.Resource.GetName())] = w.Resource.UnstructuredContent()
+		inputs[i] = proposalInput(w.Resource.UnstructuredContent())
+	}
+
+	desired := map[string]*fnv1.Resource{}
+	if p := rec.approve(approved...); p != nil {
+		log.Debug("Applying approved proposal", "digest", p.Digest)
+		response.Normalf(d.rsp, "Applying approved proposal %s", p.Digest)
+		dr, err := p.desired()
+		if err != nil {
+			return nil, nil, err
+		}
+		desired = dr
+	}
+
+	digest, err := digestOf(map[string]any{
+		"resources":    inputs,
+		"systemPrompt": d.in.SystemPrompt,
+		"userPrompt":   d.in.UserPrompt,
+		"parameters":   vars.Parameters,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot digest watched resources")
+	}
+
+	if rec.InputDigest != digest {
+		generated, err := f.process(ctx, log, d, vars, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := newProposal(generated)
+		if err != nil {
+			return nil, nil, err
+		}
+		rec.InputDigest = digest
+		rec.Pending = p
+		if len(proposedChanges(observed, nil, p.Resources)) == 0 {
+			response.Normal(d.rsp, "GPT proposed no changes")
+			rec.Pending = nil
+		}
+	}
+
+	var pc any
+	if rec.Pending != nil {
+		changes := proposedChanges(observed, nil, rec.Pending.Resources)
+		if err := reportProposal(d.rsp, rec.Pending, changes, "watched resource"); err != nil {
+			return nil, nil, err
+		}
+		if pc, err = proposalContext(rec.Pending, rec.Pending.Resources, changes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	raw, ok, err := rec.encode(d.rsp)
+	if err != nil || !ok {
+		return desired, pc, err
+	}
+	for _, w := range batch {
+		key := objectKey(w.Resource.GetNamespace(), w.Resource.GetName())
+		obj := map[string]any{
+			"apiVersion": w.Resource.GetAPIVersion(),
+			"kind":       w.Resource.GetKind(),
+			"metadata":   map[string]any{"name": w.Resource.GetName()},
+		}
+		if ns := w.Resource.GetNamespace(); ns != "" {
+			obj["metadata"].(map[string]any)["namespace"] = ns //nolint:forcetypeassert // We just set it.
+		}
+		if dr, ok := desired[key]; ok {
+			obj = dr.GetResource().AsMap()
+		}
+		obj = mergeMaps(obj, map[string]any{"metadata": map[string]any{"annotations": map[string]any{annotationProposal: raw}}})
+		s, err := structpb.NewStruct(obj)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot record proposal on watched resource %q", key)
+		}
+		desired[key] = &fnv1.Resource{Resource: s}
+	}
+	return desired, pc, nil
+}
+
+// proposalInput returns the parts of the supplied watched resource that GPT's
+// proposal depends on. Metadata the API server changes on every write, and the
+// proposal annotations, are omitted, so that recording a proposal doesn't
+// cause GPT to be asked again.
+func proposalInput(obj map[string]any) map[string]any {
+	out := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if k != "metadata" {
+			out[k] = v
+		}
+	}
+	meta, _ := obj["metadata"].(map[string]any)
+	m := map[string]any{"name": meta["name"], "namespace": meta["namespace"], "labels": meta["labels"]}
+	if a, ok := meta["annotations"].(map[string]any); ok {
+		ca := make(map[string]any, len(a))
+		for k, v := range a {
+			if k != annotationProposal && k != annotationApprovedProposal {
+				ca[k] = v
+			}
+		}
+		m["annotations"] = ca
+	}
+	out["metadata"] = m
+	return out
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+func TestProposedChanges(t *testing.T) {
+	type args struct {
+		observed map[string]map[string]any
+		applied  map[string]map[string]any
+		proposed map[string]map[string]any
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []resourceChange
+	}{
+		"Unchanged": {
+			reason: "Resources whose proposed fields match the observed resource shouldn't be changed, even if the observed resource has other fields.",
+			args: args{
+				observed: map[string]map[string]any{"a": {"spec": map[string]any{"size": "small"}, "status": map[string]any{"ready": true}}},
+				proposed: map[string]map[string]any{"a": {"spec": map[string]any{"size": "small"}}},
+			},
+			want: []resourceChange{},
+		},
+		"Changes": {
+			reason: "Resources should be created, updated and deleted as proposed.",
+			args: args{
+				observed: map[string]map[string]any{
+					"a": {"spec": map[string]any{"size": "small", "tags": []any{"x"}}},
+					"c": {"spec": map[string]any{}},
+				},
+				applied: map[string]map[string]any{"a": {}, "c": {}},
+				proposed: map[string]map[string]any{
+					"a": {"spec": map[string]any{"size": "large", "tags": []any{"x", "y"}}},
+					"b": {"spec": map[string]any{"size": "small"}},
+				},
+			},
+			want: []resourceChange{
+				{Resource: "a", Operation: changeUpdate, Fields: []fieldChange{
+					{Path: "spec.size", Observed: "small", Proposed: "large"},
+					{Path: "spec.tags", Observed: []any{"x"}, Proposed: []any{"x", "y"}},
+				}},
+				{Resource: "b", Operation: changeCreate, Fields: []fieldChange{
+					{Path: "spec.size", Proposed: "small"},
+				}},
+				{Resource: "c", Operation: changeDelete},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := proposedChanges(tc.args.observed, tc.args.applied, tc.args.proposed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nproposedChanges(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestProposeComposition(t *testing.T) {
+	prompted := 0
+	f := &Function{log: logging.NewNopLogger(), ai: &mockAgentInvoker{
+		InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+			prompted++
+			return "---\napiVersion: example.org/v1\nkind: Bucket\nmetadata:\n  annotations:\n    upbound.io/name: bucket\nspec:\n  region: eu-west-1\n", nil
+		},
+	}}
+
+	// req returns a request for an XR with the supplied annotations.
+	req := func(annotations map[string]any) *fnv1.RunFunctionRequest {
+		xr := resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"},"spec":{"size":"small"}}`)
+		a, err := structpb.NewStruct(annotations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xr.GetFields()["metadata"].GetStructValue().GetFields()["annotations"] = structpb.NewStructValue(a)
+		return &fnv1.RunFunctionRequest{
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "openai.fn.upbound.io/v1alpha1",
+				"kind": "Prompt",
+				"userPrompt": "compose",
+				"mode": "Propose"
+			}`),
+			Credentials: mockCredentials(),
+			Observed:    &fnv1.State{Composite: &fnv1.Resource{Resource: xr}},
+			Desired:     &fnv1.State{},
+		}
+	}
+
+	// recorded returns the proposal record of the supplied response.
+	recorded := func(rsp *fnv1.RunFunctionResponse) string {
+		return rsp.GetDesired().GetComposite().GetResource().GetFields()["metadata"].GetStructValue().GetFields()["annotations"].GetStructValue().GetFields()[annotationProposal].GetStringValue()
+	}
+
+	// Propose. Nothing should be desired.
+	rsp, err := f.RunFunction(t.Context(), req(map[string]any{}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	if len(rsp.GetDesired().GetResources()) != 0 {
+		t.Errorf("Propose: desired %d composed resources, want none", len(rsp.GetDesired().GetResources()))
+	}
+	rec := proposalRecordFrom(map[string]string{annotationProposal: recorded(rsp)})
+	if rec.Pending == nil {
+		t.Fatalf("Propose: want a pending proposal, got none")
+	}
+	digest := rec.Pending.Digest
+	wantResults := []*fnv1.Result{
+		{
+			Severity: fnv1.Severity_SEVERITY_NORMAL,
+			Message:  `Proposal ` + digest + `: {"resource":"bucket","operation":"Create","fields":[{"path":"apiVersion","proposed":"example.org/v1"},{"path":"kind","proposed":"Bucket"},{"path":"metadata.annotations.upbound.io/name","proposed":"bucket"},{"path":"spec.region","proposed":"eu-west-1"}]}`,
+			Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+		},
+		{
+			Severity: fnv1.Severity_SEVERITY_NORMAL,
+			Message:  "Proposal " + digest + " changes 1 resources; annotate the composite resource with " + annotationApprovedProposal + "=" + digest + " to apply it",
+			Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+		},
+	}
+	if diff := cmp.Diff(wantResults, rsp.GetResults(), protocmp.Transform()); diff != "" {
+		t.Errorf("Propose: -want results, +got results:\n%s", diff)
+	}
+	if got := rsp.GetContext().GetFields()[contextKeyProposals].GetListValue().GetValues()[0].GetStructValue().GetFields()["digest"].GetStringValue(); got != digest {
+		t.Errorf("Propose: pipeline context proposal digest: want %q, got %q", digest, got)
+	}
+
+	// Run again without approving. GPT shouldn't be asked again.
+	rsp, err = f.RunFunction(t.Context(), req(map[string]any{annotationProposal: recorded(rsp)}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	if prompted != 1 {
+		t.Errorf("Pending: prompted GPT %d times, want 1", prompted)
+	}
+	if len(rsp.GetDesired().GetResources()) != 0 {
+		t.Errorf("Pending: desired %d composed resources, want none", len(rsp.GetDesired().GetResources()))
+	}
+
+	// Approve. The proposal should be desired, without asking GPT again.
+	rsp, err = f.RunFunction(t.Context(), req(map[string]any{annotationProposal: recorded(rsp), annotationApprovedProposal: digest}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	if prompted != 1 {
+		t.Errorf("Approve: prompted GPT %d times, want 1", prompted)
+	}
+	want := map[string]*fnv1.Resource{
+		"bucket": {Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"Bucket","metadata":{"annotations":{"upbound.io/name":"bucket"}},"spec":{"region":"eu-west-1"}}`)},
+	}
+	if diff := cmp.Diff(want, rsp.GetDesired().GetResources(), protocmp.Transform()); diff != "" {
+		t.Errorf("Approve: -want desired, +got desired:\n%s", diff)
+	}
+
+	// Run again. The approved proposal should still be desired.
+	rsp, err = f.RunFunction(t.Context(), req(map[string]any{annotationProposal: recorded(rsp), annotationApprovedProposal: digest}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	if diff := cmp.Diff(want, rsp.GetDesired().GetResources(), protocmp.Transform()); diff != "" {
+		t.Errorf("Applied: -want desired, +got desired:\n%s", diff)
+	}
+	if rec := proposalRecordFrom(map[string]string{annotationProposal: recorded(rsp)}); rec.Pending != nil || rec.Applied.Digest != digest {
+		t.Errorf("Applied: want applied proposal %q and nothing pending, got %+v", digest, rec)
+	}
+}
+
+func TestProposeOperation(t *testing.T) {
+	prompted := 0
+	f := &Function{log: logging.NewNopLogger(), ai: &mockAgentInvoker{
+		InvokeFn: func(_ context.Context, _ llm.Config, _, prompt string, _ ...invokeOption) (string, error) {
+			prompted++
+			if strings.Contains(prompt, `"replicas": "3"`) {
+				return "", errors.New("GPT shouldn't be asked to propose again")
+			}
+			return `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"default"},"data":{"replicas":"3"}}`, nil
+		},
+	}}
+
+	// req returns a request watching a ConfigMap with the supplied annotations.
+	req := func(annotations map[string]any) *fnv1.RunFunctionRequest {
+		cm := resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"default","resourceVersion":"1"},"data":{"replicas":"1"}}`)
+		a, err := structpb.NewStruct(annotations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cm.GetFields()["metadata"].GetStructValue().GetFields()["annotations"] = structpb.NewStructValue(a)
+		return &fnv1.RunFunctionRequest{
+			Input: resource.MustStructJSON(`{
+				"apiVersion": "openai.fn.upbound.io/v1alpha1",
+				"kind": "Prompt",
+				"userPrompt": "{{ .Resources }}",
+				"mode": "Propose"
+			}`),
+			Credentials: mockCredentials(),
+			RequiredResources: map[string]*fnv1.Resources{
+				"ops.crossplane.io/watched-resource": {Items: []*fnv1.Resource{{Resource: cm}}},
+			},
+			Desired: &fnv1.State{},
+		}
+	}
+
+	// recorded returns the proposal record of the supplied response.
+	recorded := func(rsp *fnv1.RunFunctionResponse) string {
+		return rsp.GetDesired().GetResources()["default/cm"].GetResource().GetFields()["metadata"].GetStructValue().GetFields()["annotations"].GetStructValue().GetFields()[annotationProposal].GetStringValue()
+	}
+
+	// Propose. Only the proposal annotation should be desired.
+	rsp, err := f.RunFunction(t.Context(), req(map[string]any{}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	raw := recorded(rsp)
+	rec := proposalRecordFrom(map[string]string{annotationProposal: raw})
+	if rec.Pending == nil {
+		t.Fatalf("Propose: want a pending proposal, got none")
+	}
+	digest := rec.Pending.Digest
+	want := map[string]*fnv1.Resource{
+		"default/cm": {Resource: resource.MustStructJSON(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"default","annotations":{"` + annotationProposal + `":"` + raw + `"}}}`)},
+	}
+	if diff := cmp.Diff(want, rsp.GetDesired().GetResources(), protocmp.Transform()); diff != "" {
+		t.Errorf("Propose: -want desired, +got desired:\n%s", diff)
+	}
+	wantMessage := `Proposal ` + digest + `: {"resource":"default/cm","operation":"Update","fields":[{"path":"data.replicas","observed":"1","proposed":"3"}]}`
+	found := false
+	for _, r := range rsp.GetResults() {
+		found = found || r.GetMessage() == wantMessage
+	}
+	if !found {
+		t.Errorf("Propose: want result %q, got %v", wantMessage, rsp.GetResults())
+	}
+
+	// Approve. The proposal should be desired, without asking GPT again.
+	rsp, err = f.RunFunction(t.Context(), req(map[string]any{annotationProposal: raw, annotationApprovedProposal: digest}))
+	if err != nil {
+		t.Fatalf("RunFunction(...): %v", err)
+	}
+	if prompted != 1 {
+		t.Errorf("Approve: prompted GPT %d times, want 1", prompted)
+	}
+	if got := rsp.GetDesired().GetResources()["default/cm"].GetResource().GetFields()["data"].GetStructValue().GetFields()["replicas"].GetStringValue(); got != "3" {
+		t.Errorf("Approve: desired replicas %q, want %q", got, "3")
+	}
+	if rec := proposalRecordFrom(map[string]string{annotationProposal: recorded(rsp)}); rec.Pending != nil {
+		t.Errorf("Approve: want nothing pending, got %+v", rec.Pending)
+	}
+}
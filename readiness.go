@@ -0,0 +1,296 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	openaillm "github.com/tmc/langchaingo/llms/openai"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// readinessSystemPrompt asks GPT to assess the readiness of composed
+// resources.
+const readinessSystemPrompt = `You assess whether Kubernetes resources managed by Crossplane are ready.
+
+You'll be given a composite resource, and the observed state of the composed resources it desires. A composed resource is ready if it exists and its status shows it's working as intended. A desired composed resource that hasn't been observed isn't ready.
+
+Respond with a JSON object containing:
+- resources: an entry for each desired composed resource, with its name and whether it's ready.
+- conditions: any conditions of the composite resource that summarize the health of its composed resources. Each has a type, a status of True, False or Unknown, a CamelCase reason, and a message. Don't use the Ready or Synced condition types.
+
+Respond only with the JSON object.`
+
+// readinessSchema constrains GPT's readiness assessment.
+var readinessSchema = &llm.Schema{
+	Name:   "readiness",
+	Strict: true,
+	Schema: &openaillm.ResponseFormatJSONSchemaProperty{
+		Type:     "object",
+		Required: []string{"resources", "conditions"},
+		Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+			"resources": {
+				Type: "array",
+				Items: &openaillm.ResponseFormatJSONSchemaProperty{
+					Type:     "object",
+					Required: []string{"name", "ready"},
+					Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+						"name":  {Type: "string", Description: "The composed resource's name."},
+						"ready": {Type: "boolean", Description: "Whether the composed resource is ready."},
+					},
+				},
+			},
+			"conditions": {
+				Type: "array",
+				Items: &openaillm.ResponseFormatJSONSchemaProperty{
+					Type:     "object",
+					Required: []string{"type", "status", "reason", "message"},
+					Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+						"type":    {Type: "string", Description: "The condition's type."},
+						"status":  {Type: "string", Enum: []any{"True", "False", "Unknown"}, Description: "The condition's status."},
+						"reason":  {Type: "string", Description: "A CamelCase reason for the condition's status."},
+						"message": {Type: "string", Description: "A human readable message describing the condition."},
+					},
+				},
+			},
+		},
+	},
+}
+
+// reservedConditionTypes are managed by Crossplane, and can't be set by a
+// function.
+var reservedConditionTypes = []string{"Ready", "Synced"}
+
+// readinessResponse is GPT's readiness assessment.
+type readinessResponse struct {
+	Resources []struct {
+		Name  string `json:"name"`
+		Ready bool   `json:"ready"`
+	} `json:"resources"`
+	Conditions []readinessCondition `json:"conditions"`
+}
+
+type readinessCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// readiness marks the desired composed resources ready or not, and sets any
+// conditions of the composite resource, as configured by the input. Problems
+// assessing readiness are returned as Warning results.
+func (f *Function) readiness(ctx context.Context, log logging.Logger, d pipelineDetails) {
+	if d.in.Readiness == nil {
+		return
+	}
+
+	var ready map[string]bool
+	var conditions []readinessCondition
+	switch d.in.Readiness.Mode {
+	case v1alpha1.ReadinessModeGPT:
+		var err error
+		ready, conditions, err = f.assessReadiness(ctx, log, d)
+		if err != nil {
+			response.Warning(d.rsp, errors.Wrap(err, "cannot assess readiness of composed resources"))
+			return
+		}
+	default:
+		ready = readyByRules(d.in.Readiness.Rules, d.req.GetObserved().GetResources(), d.rsp.GetDesired().GetResources())
+	}
+
+	notReady := make([]string, 0)
+	for name, dcd := range d.rsp.GetDesired().GetResources() {
+		r, ok := ready[name]
+		switch {
+		case !ok:
+			continue
+		case r:
+			dcd.Ready = fnv1.Ready_READY_TRUE
+		default:
+			dcd.Ready = fnv1.Ready_READY_FALSE
+			notReady = append(notReady, name)
+		}
+	}
+	sort.Strings(notReady)
+	log.Debug("Assessed readiness of composed resources", "mode", d.in.Readiness.Mode, "notReady", notReady)
+
+	for _, c := range conditions {
+		if c.Type == "" {
+			response.Warning(d.rsp, errors.New("ignoring composite resource condition generated by GPT: the condition has no type"))
+			continue
+		}
+		if slices.Contains(reservedConditionTypes, c.Type) {
+			response.Warning(d.rsp, errors.Errorf("ignoring composite resource condition %q generated by GPT: the condition type is reserved", c.Type))
+			continue
+		}
+		var co *response.ConditionOption
+		switch c.Status {
+		case "True":
+			co = response.ConditionTrue(d.rsp, c.Type, c.Reason)
+		case "False":
+			co = response.ConditionFalse(d.rsp, c.Type, c.Reason)
+		default:
+			co = response.ConditionUnknown(d.rsp, c.Type, c.Reason)
+		}
+		co.WithMessage(c.Message).TargetCompositeAndClaim()
+	}
+
+	if d.in.Readiness.ConditionType == "" {
+		return
+	}
+	if len(notReady) > 0 {
+		response.ConditionFalse(d.rsp, d.in.Readiness.ConditionType, "ComposedResourcesNotReady").
+			WithMessage(fmt.Sprintf("Composed resources are not ready: %s", strings.Join(notReady, ", "))).
+			TargetCompositeAndClaim()
+		return
+	}
+	response.ConditionTrue(d.rsp, d.in.Readiness.ConditionType, "ComposedResourcesReady").TargetCompositeAndClaim()
+}
+
+// readyByRules returns whether each of the supplied desired composed resources
+// is ready according to the supplied rules. A desired composed resource that
+// hasn't been observed isn't ready.
+func readyByRules(rules []v1alpha1.ReadinessRule, observed, desired map[string]*fnv1.Resource) map[string]bool {
+	out := make(map[string]bool, len(desired))
+	for name := range desired {
+		ocd, ok := observed[name]
+		if !ok {
+			out[name] = false
+			continue
+		}
+
+		applicable := make([]v1alpha1.ReadinessRule, 0, len(rules))
+		for _, r := range rules {
+			if len(r.Resources) == 0 || slices.Contains(r.Resources, name) {
+				applicable = append(applicable, r)
+			}
+		}
+		if len(applicable) == 0 {
+			applicable = append(applicable, v1alpha1.ReadinessRule{})
+		}
+
+		p := fieldpath.Pave(ocd.GetResource().AsMap())
+		out[name] = true
+		for _, r := range applicable {
+			if !passes(p, r) {
+				out[name] = false
+				break
+			}
+		}
+	}
+	return out
+}
+
+// passes returns true if the supplied resource passes the supplied rule.
+func passes(p *fieldpath.Paved, r v1alpha1.ReadinessRule) bool {
+	if r.FieldPath != "" {
+		v, err := p.GetValue(r.FieldPath)
+		if err != nil || v == nil {
+			return false
+		}
+		if r.FieldValue != nil && fmt.Sprint(v) != *r.FieldValue {
+			return false
+		}
+		if r.ConditionType == "" {
+			return true
+		}
+	}
+
+	typ := r.ConditionType
+	if typ == "" {
+		typ = "Ready"
+	}
+	conditions := []struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}{}
+	if err := p.GetValueInto("status.conditions", &conditions); err != nil {
+		return false
+	}
+	for _, c := range conditions {
+		if c.Type == typ {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+// assessReadiness asks GPT to assess the readiness of the desired composed
+// resources, using their observed state.
+func (f *Function) assessReadiness(ctx context.Context, log logging.Logger, d pipelineDetails) (map[string]bool, []readinessCondition, error) {
+	xr, err := CompositeToYAML(d.req.GetObserved().GetComposite())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot convert observed XR to YAML")
+	}
+	cds, err := ComposedToYAML(d.req.GetObserved().GetResources())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot convert observed composed resources to YAML")
+	}
+	names := make([]string, 0, len(d.rsp.GetDesired().GetResources()))
+	for name := range d.rsp.GetDesired().GetResources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prompt := fmt.Sprintf("<composite>\n%s</composite>\n<desired>\n%s\n</desired>\n<observed>\n%s</observed>", xr, strings.Join(names, "\n"), cds)
+
+	// Assess readiness using our own system prompt, rather than the
+	// input's.
+	in := *d.in
+	in.SystemPrompt = readinessSystemPrompt
+	rd := d
+	rd.in = &in
+
+	// Only cache the assessment once we know we can parse it.
+	p := &pendingCache{}
+	pctx := withPendingCacheContext(ctx, p)
+
+	resp, err := f.invoke(pctx, log, rd, prompt, withResponseSchema(readinessSchema))
+	if structuredOutputRejected(err) {
+		log.Debug("Endpoint rejected structured output, asking for unstructured readiness assessment", "error", err)
+		resp, err = f.invoke(pctx, log, rd, prompt)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to run chain")
+	}
+
+	r := &readinessResponse{}
+	if err := json.Unmarshal([]byte(removeJSONMarkdown(resp)), r); err != nil {
+		return nil, nil, errors.Wrap(err, "did not receive a readiness assessment from GPT")
+	}
+	p.Accept()
+
+	ready := make(map[string]bool, len(r.Resources))
+	for _, i := range r.Resources {
+		ready[i.Name] = i.Ready
+	}
+	return ready, r.Conditions, nil
+}
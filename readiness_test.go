@@ -0,0 +1,212 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/utils/ptr"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+func TestReadyByRules(t *testing.T) {
+	ready := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"status": {
+			"atProvider": {"arn": "some-arn", "state": "Available"},
+			"conditions": [{"type": "Ready", "status": "True"}, {"type": "Synced", "status": "False"}]
+		}
+	}`)}
+	creating := &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"status": {
+			"atProvider": {"state": "Creating"},
+			"conditions": [{"type": "Ready", "status": "False"}]
+		}
+	}`)}
+	desired := map[string]*fnv1.Resource{"ready": {}, "creating": {}, "missing": {}}
+	observed := map[string]*fnv1.Resource{"ready": ready, "creating": creating}
+
+	cases := map[string]struct {
+		reason string
+		rules  []v1alpha1.ReadinessRule
+		want   map[string]bool
+	}{
+		"DefaultRule": {
+			reason: "Composed resources should be ready if their Ready condition is True.",
+			want:   map[string]bool{"ready": true, "creating": false, "missing": false},
+		},
+		"ConditionType": {
+			reason: "Composed resources should be ready if the supplied condition is True.",
+			rules:  []v1alpha1.ReadinessRule{{ConditionType: "Synced"}},
+			want:   map[string]bool{"ready": false, "creating": false, "missing": false},
+		},
+		"FieldPathSet": {
+			reason: "Composed resources should be ready if the supplied field is set.",
+			rules:  []v1alpha1.ReadinessRule{{FieldPath: "status.atProvider.state"}},
+			want:   map[string]bool{"ready": true, "creating": true, "missing": false},
+		},
+		"FieldValue": {
+			reason: "Composed resources should be ready if the supplied field has the supplied value.",
+			rules:  []v1alpha1.ReadinessRule{{FieldPath: "status.atProvider.state", FieldValue: ptr.To("Available")}},
+			want:   map[string]bool{"ready": true, "creating": false, "missing": false},
+		},
+		"ResourceSpecificRule": {
+			reason: "Rules should only apply to the composed resources they name. Others should use the default rule.",
+			rules:  []v1alpha1.ReadinessRule{{Resources: []string{"creating"}, FieldPath: "status.atProvider.state"}},
+			want:   map[string]bool{"ready": true, "creating": true, "missing": false},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := readyByRules(tc.rules, observed, desired)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nreadyByRules(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	type args struct {
+		ai agentInvoker
+		in *v1alpha1.Prompt
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *fnv1.RunFunctionResponse
+	}{
+		"Rules": {
+			reason: "Desired composed resources should be marked ready according to the rules, and the condition set.",
+			args: args{
+				in: &v1alpha1.Prompt{Readiness: &v1alpha1.Readiness{ConditionType: "ResourcesReady"}},
+			},
+			want: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+					"a": {Ready: fnv1.Ready_READY_TRUE},
+					"b": {Ready: fnv1.Ready_READY_FALSE},
+				}},
+				Conditions: []*fnv1.Condition{{
+					Type:    "ResourcesReady",
+					Status:  fnv1.Status_STATUS_CONDITION_FALSE,
+					Reason:  "ComposedResourcesNotReady",
+					Message: ptr.To("Composed resources are not ready: b"),
+					Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+				}},
+			},
+		},
+		"GPT": {
+			reason: "Desired composed resources should be marked ready according to GPT, and its conditions set.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return `{"resources":[{"name":"a","ready":false},{"name":"b","ready":true}],"conditions":[{"type":"DatabaseHealthy","status":"False","reason":"Creating","message":"The database is being created."},{"type":"Ready","status":"True","reason":"Available","message":""},{"type":"","status":"True","reason":"Available","message":""}]}`, nil
+					},
+				},
+				in: &v1alpha1.Prompt{Readiness: &v1alpha1.Readiness{Mode: v1alpha1.ReadinessModeGPT}},
+			},
+			want: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+					"a": {Ready: fnv1.Ready_READY_FALSE},
+					"b": {Ready: fnv1.Ready_READY_TRUE},
+				}},
+				Conditions: []*fnv1.Condition{{
+					Type:    "DatabaseHealthy",
+					Status:  fnv1.Status_STATUS_CONDITION_FALSE,
+					Reason:  "Creating",
+					Message: ptr.To("The database is being created."),
+					Target:  fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum(),
+				}},
+				Results: []*fnv1.Result{
+					{
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  `ignoring composite resource condition "Ready" generated by GPT: the condition type is reserved`,
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					},
+					{
+						Severity: fnv1.Severity_SEVERITY_WARNING,
+						Message:  "ignoring composite resource condition generated by GPT: the condition has no type",
+						Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+					},
+				},
+			},
+		},
+		"GPTCached": {
+			reason: "A readiness assessment served from the cache should be reported as a Normal result.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, system, _ string, opts ...invokeOption) (string, error) {
+						if system != readinessSystemPrompt {
+							return "", errors.New("readiness should be assessed using the readiness system prompt")
+						}
+						io := &invokeOptions{}
+						for _, o := range opts {
+							o(io)
+						}
+						io.onCacheHit()
+						return `{"resources":[{"name":"a","ready":true},{"name":"b","ready":true}],"conditions":[]}`, nil
+					},
+				},
+				in: &v1alpha1.Prompt{SystemPrompt: "I'm a system", Readiness: &v1alpha1.Readiness{Mode: v1alpha1.ReadinessModeGPT}},
+			},
+			want: &fnv1.RunFunctionResponse{
+				Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+					"a": {Ready: fnv1.Ready_READY_TRUE},
+					"b": {Ready: fnv1.Ready_READY_TRUE},
+				}},
+				Results: []*fnv1.Result{{
+					Severity: fnv1.Severity_SEVERITY_NORMAL,
+					Message:  "Using cached GPT response",
+					Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := pipelineDetails{
+				req: &fnv1.RunFunctionRequest{Observed: &fnv1.State{Resources: map[string]*fnv1.Resource{
+					"a": {Resource: resource.MustStructJSON(`{"status":{"conditions":[{"type":"Ready","status":"True"}]}}`)},
+				}}},
+				rsp: &fnv1.RunFunctionResponse{Desired: &fnv1.State{Resources: map[string]*fnv1.Resource{
+					"a": {},
+					"b": {},
+				}}},
+				in: tc.args.in,
+			}
+
+			f := &Function{log: logging.NewNopLogger(), ai: tc.args.ai}
+			f.readiness(context.Background(), f.log, d)
+
+			if diff := cmp.Diff(tc.want, d.rsp, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nreadiness(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// A responseError indicates that GPT's response couldn't be used. GPT may be
+// able to repair its response if the error is fed back to it.
+type responseError struct {
+	err error
+}
+
+func (e *responseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *responseError) Unwrap() error {
+	return e.err
+}
+
+// An attemptFn makes a single attempt at getting a usable response from GPT
+// using the supplied prompt. It returns GPT's raw response and any problems
+// with it that GPT may be able to repair. An error is returned if the attempt
+// couldn't be made at all.
+type attemptFn func(ctx context.Context, prompt string) (string, []string, error)
+
+// repair makes an attempt using the supplied prompt. If GPT's response has
+// problems, the prompt, the response and its problems are fed back to GPT up
+// to the number of repair attempts configured by the input. A Warning result
+// is returned for each attempt that has problems, and a Normal result if GPT
+// repairs its response. Only responses without problems are cached.
+func (f *Function) repair(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string, attempt attemptFn) error {
+	resp, problems, err := acceptedAttempt(ctx, prompt, attempt)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; len(problems) > 0 && i <= d.in.RepairAttempts; i++ {
+		response.Warning(d.rsp, errors.Errorf("GPT response has %d problems, asking it to repair them (attempt %d of %d): %s", len(problems), i, d.in.RepairAttempts, strings.Join(problems, "; ")))
+		log.Debug("Asking GPT to repair its response", "attempt", i, "problems", problems)
+
+		resp, problems, err = acceptedAttempt(ctx, repairPrompt(prompt, resp, problems), attempt)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			response.Normalf(d.rsp, "GPT repaired its response after %d attempts", i)
+		}
+	}
+
+	return nil
+}
+
+// acceptedAttempt makes the supplied attempt, caching GPT's response only if
+// it has no problems.
+func acceptedAttempt(ctx context.Context, prompt string, attempt attemptFn) (string, []string, error) {
+	p := &pendingCache{}
+	resp, problems, err := attempt(withPendingCacheContext(ctx, p), prompt)
+	if err == nil && len(problems) == 0 {
+		p.Accept()
+	}
+	return resp, problems, err
+}
+
+// repairPrompt asks GPT to correct a previous response that had the supplied
+// problems.
+func repairPrompt(prompt, previous string, problems []string) string {
+	b := &strings.Builder{}
+	b.WriteString(prompt)
+	b.WriteString("\n\nYou previously responded with:\n<previous>\n")
+	b.WriteString(previous)
+	b.WriteString("\n</previous>\nYour response had the following problems:\n<problems>\n")
+	for _, p := range problems {
+		b.WriteString("- ")
+		b.WriteString(p)
+		b.WriteString("\n")
+	}
+	b.WriteString("</problems>\nRespond again, correcting these problems. Follow the original instructions exactly.")
+	return b.String()
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+// requirementsFor returns selectors for the resources the input requires.
+func requirementsFor(req *fnv1.RunFunctionRequest, in *v1alpha1.Prompt) (map[string]*fnv1.ResourceSelector, error) {
+	out := make(map[string]*fnv1.ResourceSelector, len(in.RequiredResources))
+	for _, rr := range in.RequiredResources {
+		if rr.Name == "" {
+			return nil, errors.New("required resources must have a name")
+		}
+		if _, ok := out[rr.Name]; ok {
+			return nil, errors.Errorf("required resource %q is declared more than once", rr.Name)
+		}
+
+		sel := &fnv1.ResourceSelector{ApiVersion: rr.APIVersion, Kind: rr.Kind, Namespace: rr.Namespace}
+
+		set := 0
+		if rr.MatchName != nil {
+			set++
+			sel.Match = &fnv1.ResourceSelector_MatchName{MatchName: *rr.MatchName}
+		}
+		if rr.MatchNameFromCompositeFieldPath != nil {
+			set++
+			p := fieldpath.Pave(req.GetObserved().GetComposite().GetResource().AsMap())
+			name, err := p.GetString(*rr.MatchNameFromCompositeFieldPath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot get name of required resource %q from composite resource", rr.Name)
+			}
+			sel.Match = &fnv1.ResourceSelector_MatchName{MatchName: name}
+		}
+		if rr.MatchLabels != nil {
+			set++
+			sel.Match = &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{Labels: rr.MatchLabels}}
+		}
+		if set != 1 {
+			return nil, errors.Errorf("required resource %q must set exactly one of matchName, matchNameFromCompositeFieldPath, or matchLabels", rr.Name)
+		}
+
+		out[rr.Name] = sel
+	}
+
+	for _, s := range in.MCPServers {
+		if s.From == nil {
+			continue
+		}
+		apiVersion, kind := mcpServerSourceType(s.From)
+		out[mcpServerRequirement(s.Name)] = &fnv1.ResourceSelector{
+			ApiVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  s.From.Namespace,
+			Match:      &fnv1.ResourceSelector_MatchName{MatchName: s.From.Name},
+		}
+	}
+	return out, nil
+}
+
+// unsatisfied returns the sorted names of the supplied requirements Crossplane
+// hasn't yet supplied resources for. Crossplane supplies an entry for each
+// requirement it has processed, even if no resources matched.
+func unsatisfied(req *fnv1.RunFunctionRequest, rqs map[string]*fnv1.ResourceSelector) []string {
+	out := make([]string, 0)
+	for name := range rqs {
+		if _, ok := req.GetRequiredResources()[name]; ok {
+			continue
+		}
+		if _, ok := req.GetExtraResources()[name]; ok {
+			continue
+		}
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/utils/ptr"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+func TestRequirementsFor(t *testing.T) {
+	req := &fnv1.RunFunctionRequest{
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{"spec":{"providerConfigRef":{"name":"default"}}}`)},
+		},
+	}
+
+	type want struct {
+		rqs map[string]*fnv1.ResourceSelector
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		rrs    []v1alpha1.RequiredResource
+		mcp    []v1alpha1.MCPServer
+		want   want
+	}{
+		"NoRequirements": {
+			reason: "An input without required resources should have no requirements.",
+			want:   want{rqs: map[string]*fnv1.ResourceSelector{}},
+		},
+		"Selectors": {
+			reason: "Each required resource should be converted to a selector.",
+			rrs: []v1alpha1.RequiredResource{
+				{Name: "config", APIVersion: "aws.upbound.io/v1beta1", Kind: "ProviderConfig", MatchNameFromCompositeFieldPath: ptr.To("spec.providerConfigRef.name")},
+				{Name: "neighbours", APIVersion: "example.org/v1", Kind: "XApp", MatchLabels: map[string]string{"team": "a"}, Namespace: ptr.To("default")},
+			},
+			want: want{rqs: map[string]*fnv1.ResourceSelector{
+				"config": {
+					ApiVersion: "aws.upbound.io/v1beta1",
+					Kind:       "ProviderConfig",
+					Match:      &fnv1.ResourceSelector_MatchName{MatchName: "default"},
+				},
+				"neighbours": {
+					ApiVersion: "example.org/v1",
+					Kind:       "XApp",
+					Match:      &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{Labels: map[string]string{"team": "a"}}},
+					Namespace:  ptr.To("default"),
+				},
+			}},
+		},
+		"MCPServers": {
+			reason: "The resource each MCP server is configured from should be required, defaulting to a ConfigMap.",
+			mcp: []v1alpha1.MCPServer{
+				{Name: "Docs", From: &v1alpha1.MCPServerSource{Name: "docs-mcp", Namespace: ptr.To("crossplane-system")}},
+				{Name: "search", From: &v1alpha1.MCPServerSource{APIVersion: "mcp.example.org/v1", Kind: "MCPServer", Name: "search"}},
+				{Name: "inline", Transport: "sse", BaseURL: "http://inline"},
+			},
+			want: want{rqs: map[string]*fnv1.ResourceSelector{
+				"openai.fn.upbound.io/mcp-server-docs": {
+					ApiVersion: "v1",
+					Kind:       "ConfigMap",
+					Match:      &fnv1.ResourceSelector_MatchName{MatchName: "docs-mcp"},
+					Namespace:  ptr.To("crossplane-system"),
+				},
+				"openai.fn.upbound.io/mcp-server-search": {
+					ApiVersion: "mcp.example.org/v1",
+					Kind:       "MCPServer",
+					Match:      &fnv1.ResourceSelector_MatchName{MatchName: "search"},
+				},
+			}},
+		},
+		"MissingFieldPath": {
+			reason: "We should return an error if the composite resource doesn't have the name field.",
+			rrs: []v1alpha1.RequiredResource{
+				{Name: "config", APIVersion: "v1", Kind: "Secret", MatchNameFromCompositeFieldPath: ptr.To("spec.secretRef.name")},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+		"NoMatch": {
+			reason: "We should return an error if a required resource doesn't say how to match resources.",
+			rrs:    []v1alpha1.RequiredResource{{Name: "config", APIVersion: "v1", Kind: "Secret"}},
+			want:   want{err: cmpopts.AnyError},
+		},
+		"Duplicate": {
+			reason: "We should return an error if two required resources have the same name.",
+			rrs: []v1alpha1.RequiredResource{
+				{Name: "config", APIVersion: "v1", Kind: "Secret", MatchName: ptr.To("a")},
+				{Name: "config", APIVersion: "v1", Kind: "Secret", MatchName: ptr.To("b")},
+			},
+			want: want{err: cmpopts.AnyError},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rqs, err := requirementsFor(req, &v1alpha1.Prompt{RequiredResources: tc.rrs, MCPServers: tc.mcp})
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nrequirementsFor(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rqs, rqs, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nrequirementsFor(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	openaillm "github.com/tmc/langchaingo/llms/openai"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// composedSchema constrains a structured response to a list of named
+// composed resources. OpenAI requires the root of a schema to be an object,
+// and strict schemas can't describe free-form objects, so each resource is
+// returned as a JSON encoded manifest.
+var composedSchema = &llm.Schema{
+	Name:   "composed_resources",
+	Strict: true,
+	Schema: &openaillm.ResponseFormatJSONSchemaProperty{
+		Type:     "object",
+		Required: []string{"resources"},
+		Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+			"resources": composedResourcesProperty,
+		},
+	},
+}
+
+// composedCompositeSchema extends composedSchema with a section GPT uses to
+// write the composite resource's status and connection details. Strict
+// schemas require every property, so it's only used when the input allows GPT
+// to write the composite resource.
+var composedCompositeSchema = &llm.Schema{
+	Name:   "composed_resources",
+	Strict: true,
+	Schema: &openaillm.ResponseFormatJSONSchemaProperty{
+		Type:     "object",
+		Required: []string{"resources", "composite"},
+		Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+			"resources": composedResourcesProperty,
+			"composite": compositeProperty,
+		},
+	},
+}
+
+var composedResourcesProperty = &openaillm.ResponseFormatJSONSchemaProperty{
+	Type:        "array",
+	Description: "The desired composed resources.",
+	Items: &openaillm.ResponseFormatJSONSchemaProperty{
+		Type:     "object",
+		Required: []string{"name", "resource"},
+		Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+			"name": {
+				Type:        "string",
+				Description: "Uniquely identifies the resource. Use the upbound.io/name annotation of any existing composed resource you're updating.",
+			},
+			"resource": {
+				Type:        "string",
+				Description: "The resource's Kubernetes manifest, encoded as JSON.",
+			},
+		},
+	},
+}
+
+var compositeProperty = &openaillm.ResponseFormatJSONSchemaProperty{
+	Type:        "object",
+	Description: "The composite resource's desired status and connection details.",
+	Required:    []string{"status", "connectionDetails"},
+	Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+		"status": {
+			Type:        "string",
+			Description: "The composite resource's status, encoded as a JSON object. Empty if you don't want to write its status.",
+		},
+		"connectionDetails": {
+			Type:        "array",
+			Description: "The composite resource's connection details.",
+			Items: &openaillm.ResponseFormatJSONSchemaProperty{
+				Type:     "object",
+				Required: []string{"name", "value"},
+				Properties: map[string]*openaillm.ResponseFormatJSONSchemaProperty{
+					"name":  {Type: "string", Description: "The connection detail's key."},
+					"value": {Type: "string", Description: "The connection detail's value."},
+				},
+			},
+		},
+	},
+}
+
+// composedSchemaFor returns the schema that constrains a structured response,
+// depending on whether the input allows GPT to write the composite resource.
+func composedSchemaFor(c *v1alpha1.CompositeOutput) *llm.Schema {
+	if c == nil {
+		return composedSchema
+	}
+	return composedCompositeSchema
+}
+
+// composedResponse is a structured response constrained by composedSchema or
+// composedCompositeSchema.
+type composedResponse struct {
+	Resources []composedResponseItem `json:"resources"`
+	Composite *composedResponseXR    `json:"composite,omitempty"`
+}
+
+type composedResponseItem struct {
+	Name string `json:"name"`
+
+	// Resource should be a JSON encoded manifest, but we tolerate endpoints
+	// that return the manifest as an object.
+	Resource json.RawMessage `json:"resource"`
+}
+
+type composedResponseXR struct {
+	// Status should be a JSON encoded object, but we tolerate endpoints
+	// that return it as an object.
+	Status            json.RawMessage                  `json:"status,omitempty"`
+	ConnectionDetails []composedResponseConnectionItem `json:"connectionDetails,omitempty"`
+}
+
+type composedResponseConnectionItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ComposedFromJSON parses the supplied structured response as desired composed
+// resources. The resource names are taken from the name of each item. Any
+// composite resource status and connection details are returned as a resource
+// named composite.
+func ComposedFromJSON(s string) (map[string]*fnv1.Resource, error) {
+	r := &composedResponse{}
+	if err := json.Unmarshal([]byte(removeJSONMarkdown(s)), r); err != nil {
+		return nil, errors.Wrap(err, "cannot parse structured response")
+	}
+
+	out := make(map[string]*fnv1.Resource, len(r.Resources))
+	for _, i := range r.Resources {
+		if i.Name == "" {
+			return nil, errors.New("structured response contains a resource without a name")
+		}
+		if _, seen := out[i.Name]; seen {
+			return nil, errors.Errorf("resource name %q must be unique within the structured response", i.Name)
+		}
+
+		j := []byte(i.Resource)
+		var encoded string
+		if err := json.Unmarshal(j, &encoded); err == nil {
+			// Tolerate a YAML manifest too. YAML is a superset of JSON.
+			if j, err = yaml.YAMLToJSON([]byte(encoded)); err != nil {
+				return nil, errors.Wrapf(err, "cannot parse manifest of resource %q", i.Name)
+			}
+		}
+
+		st := &structpb.Struct{}
+		if err := protojson.Unmarshal(j, st); err != nil {
+			return nil, errors.Wrapf(err, "cannot parse manifest of resource %q", i.Name)
+		}
+		out[i.Name] = &fnv1.Resource{Resource: st}
+	}
+
+	xr, err := compositeFromJSON(r.Composite)
+	if err != nil {
+		return nil, err
+	}
+	if xr != nil {
+		if _, seen := out[compositeName]; seen {
+			return nil, errors.Errorf("resource name %q is reserved for the composite resource", compositeName)
+		}
+		out[compositeName] = xr
+	}
+
+	return out, nil
+}
+
+// compositeFromJSON converts the composite section of a structured response
+// to a resource. It returns nil if the section is empty.
+func compositeFromJSON(c *composedResponseXR) (*fnv1.Resource, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	xr := map[string]any{}
+
+	j := []byte(c.Status)
+	var encoded string
+	if err := json.Unmarshal(j, &encoded); err == nil {
+		j = []byte(encoded)
+	}
+	if len(j) > 0 {
+		status := map[string]any{}
+		if err := yaml.Unmarshal(j, &status); err != nil {
+			return nil, errors.Wrap(err, "cannot parse composite resource status")
+		}
+		if len(status) > 0 {
+			xr["status"] = status
+		}
+	}
+
+	if len(c.ConnectionDetails) > 0 {
+		cd := make(map[string]any, len(c.ConnectionDetails))
+		for _, i := range c.ConnectionDetails {
+			cd[i.Name] = i.Value
+		}
+		xr["connectionDetails"] = cd
+	}
+
+	if len(xr) == 0 {
+		return nil, nil
+	}
+	st, err := structpb.NewStruct(xr)
+	return &fnv1.Resource{Resource: st}, errors.Wrap(err, "cannot convert composite resource")
+}
+
+// removeJSONMarkdown strips any markdown code fence surrounding a JSON
+// response.
+func removeJSONMarkdown(in string) string {
+	wsRemoved := strings.TrimSpace(in)
+	jsonPrefix := strings.TrimPrefix(wsRemoved, "```json")
+	return strings.TrimSuffix(jsonPrefix, "```")
+}
+
+// structuredOutputRejected returns true if the supplied error indicates the
+// provider or endpoint doesn't support structured outputs. OpenAI compatible
+// endpoints that don't support them typically reject the request's
+// response_format with an HTTP 400 Bad Request.
+func structuredOutputRejected(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, llm.ErrStructuredOutputUnsupported) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, "status code: 400") {
+		return false
+	}
+	for _, s := range []string{"response_format", "json_schema"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	htmltemplate "html/template"
+	"reflect"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/tidwall/gjson"
+	"google.golang.org/protobuf/encoding/protojson"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+)
+
+// sprigFuncs are the Sprig template functions available to prompts. We don't
+// expose all of Sprig's functions. Notably functions that read the function's
+// environment, or are non-deterministic and would defeat caching, are omitted.
+var sprigFuncs = []string{
+	// Strings.
+	"upper", "lower", "title", "trim", "trimAll", "trimPrefix", "trimSuffix",
+	"replace", "contains", "hasPrefix", "hasSuffix", "repeat", "substr",
+	"trunc", "quote", "squote", "indent", "nindent", "splitList", "join",
+
+	// Defaults and flow control.
+	"default", "empty", "coalesce", "ternary", "fail",
+
+	// Encoding.
+	"toJson", "toPrettyJson", "fromJson", "b64enc", "b64dec",
+
+	// Lists and dictionaries.
+	"list", "first", "last", "has", "dict", "get", "hasKey", "keys", "pluck",
+}
+
+// promptFuncs returns the template functions available to prompts rendered
+// for the supplied pipeline.
+func promptFuncs(d pipelineDetails) texttemplate.FuncMap {
+	all := sprig.TxtFuncMap()
+	fns := make(texttemplate.FuncMap, len(sprigFuncs)+5)
+	for _, name := range sprigFuncs {
+		fns[name] = all[name]
+	}
+
+	fns["required"] = func(msg string, v any) (any, error) {
+		if isEmpty(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	}
+	fns["toYaml"] = func(v any) (string, error) {
+		y, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(y), "\n"), err
+	}
+	fns["fromYaml"] = func(s string) (any, error) {
+		var v any
+		err := yaml.Unmarshal([]byte(s), &v)
+		return v, err
+	}
+	fns["gjson"] = func(json, path string) any {
+		return gjson.Get(json, path).Value()
+	}
+	fns["composite"] = func(path string) (any, error) {
+		j, err := protojson.Marshal(d.req.GetObserved().GetComposite().GetResource())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot convert observed XR to JSON")
+		}
+		return gjson.GetBytes(j, path).Value(), nil
+	}
+
+	return fns
+}
+
+// isEmpty returns true if the supplied value is nil, empty, or its type's zero
+// value. It matches Sprig's definition of empty.
+func isEmpty(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() { //nolint:exhaustive // Other kinds are empty if zero.
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	default:
+		return rv.IsZero()
+	}
+}
+
+// renderPrompt renders the input's user prompt using the supplied variables.
+func renderPrompt(d pipelineDetails, vars any) (string, error) {
+	b := &strings.Builder{}
+
+	if d.in.TemplateEngine == v1alpha1.TemplateEngineHTML {
+		t, err := htmltemplate.New("prompt").Parse(d.in.UserPrompt)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot parse userPrompt")
+		}
+		err = t.Execute(b, vars)
+		return b.String(), errors.Wrap(err, "cannot build prompt from template")
+	}
+
+	t, err := texttemplate.New("prompt").Funcs(promptFuncs(d)).Parse(d.in.UserPrompt)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse userPrompt")
+	}
+	err = t.Execute(b, vars)
+	return b.String(), errors.Wrap(err, "cannot build prompt from template")
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/prompt"
+)
+
+func TestSprigFuncsExist(t *testing.T) {
+	all := sprig.TxtFuncMap()
+	for _, name := range sprigFuncs {
+		if _, ok := all[name]; !ok {
+			t.Errorf("Sprig has no template function %q", name)
+		}
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	req := &fnv1.RunFunctionRequest{
+		Observed: &fnv1.State{
+			Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{"spec":{"region":"us-east-1","sizes":["s","m"]}}`)},
+		},
+	}
+	vars := &Variables{
+		Composite:  "spec:\n  region: us-east-1\n",
+		Parameters: map[string]string{"team": "platform"},
+	}
+
+	type args struct {
+		engine v1alpha1.TemplateEngine
+		prompt string
+	}
+	type want struct {
+		prompt string
+		err    error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"NoEscaping": {
+			reason: "The text engine should not HTML escape the prompt.",
+			args:   args{prompt: `{{ .Parameters.team | quote }} <tag> & "quotes"`},
+			want:   want{prompt: `"platform" <tag> & "quotes"`},
+		},
+		"HTMLEscaping": {
+			reason: "The HTML engine should keep escaping variables, as it always has.",
+			args:   args{engine: v1alpha1.TemplateEngineHTML, prompt: `{{ .Composite }}`},
+			want:   want{prompt: "spec:\n  region: us-east-1\n"},
+		},
+		"HTMLNoFunctions": {
+			reason: "The HTML engine shouldn't have the function library.",
+			args:   args{engine: v1alpha1.TemplateEngineHTML, prompt: `{{ composite "spec.region" }}`},
+			want:   want{err: cmpopts.AnyError},
+		},
+		"Composite": {
+			reason: "The composite function should look up a field of the observed composite resource.",
+			args:   args{prompt: `{{ composite "spec.region" }} {{ composite "spec.sizes.#" }}`},
+			want:   want{prompt: "us-east-1 2"},
+		},
+		"FromYAMLToJSON": {
+			reason: "YAML variables should be convertible to JSON.",
+			args:   args{prompt: `{{ .Composite | fromYaml | toJson }}`},
+			want:   want{prompt: `{"spec":{"region":"us-east-1"}}`},
+		},
+		"ToYAMLIndent": {
+			reason: "Values should be convertible to indented YAML.",
+			args:   args{prompt: `spec:{{ dict "size" "large" | toYaml | nindent 2 }}`},
+			want:   want{prompt: "spec:\n  size: large"},
+		},
+		"GJSON": {
+			reason: "The gjson function should look up a field of a JSON string.",
+			args:   args{prompt: `{{ gjson (.Composite | fromYaml | toJson) "spec.region" | upper }}`},
+			want:   want{prompt: "US-EAST-1"},
+		},
+		"Default": {
+			reason: "Missing parameters should fall back to their default.",
+			args:   args{prompt: `{{ .Parameters.env | default "dev" }}`},
+			want:   want{prompt: "dev"},
+		},
+		"Required": {
+			reason: "Missing required parameters should return an error.",
+			args:   args{prompt: `{{ required "env is required" .Parameters.env }}`},
+			want:   want{err: cmpopts.AnyError},
+		},
+		"NoEnvironment": {
+			reason: "Functions that read the function's environment shouldn't be available.",
+			args:   args{prompt: `{{ env "OPENAI_API_KEY" }}`},
+			want:   want{err: cmpopts.AnyError},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := pipelineDetails{req: req, in: &v1alpha1.Prompt{UserPrompt: tc.args.prompt, TemplateEngine: tc.args.engine}}
+			got, err := renderPrompt(d, vars)
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nrenderPrompt(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.prompt, got); diff != "" {
+				t.Errorf("\n%s\nrenderPrompt(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplatesRequireInstructions(t *testing.T) {
+	for name, tmpl := range prompt.Builtin() {
+		t.Run(name, func(t *testing.T) {
+			d := pipelineDetails{req: &fnv1.RunFunctionRequest{}, in: &v1alpha1.Prompt{UserPrompt: tmpl.UserPrompt}}
+
+			// Templates are written for either the composition or the
+			// operation pipeline's variables, so use a map that has
+			// neither.
+			if _, err := renderPrompt(d, map[string]any{}); err == nil {
+				t.Errorf("renderPrompt(...): want error rendering template %q without the instructions parameter", name)
+			}
+
+			vars := map[string]any{"Parameters": map[string]string{"instructions": "some instructions"}}
+			if _, err := renderPrompt(d, vars); err != nil {
+				t.Errorf("renderPrompt(...): rendering template %q: %v", name, err)
+			}
+		})
+	}
+}
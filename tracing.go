@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// tracerName identifies the spans the function records.
+const tracerName = "github.com/upbound/function-openai"
+
+// Span attributes. The LLM attributes follow the OpenTelemetry semantic
+// conventions for generative AI.
+const (
+	attrTag           = attribute.Key("function.tag")
+	attrPipeline      = attribute.Key("function.pipeline")
+	attrCompositeKind = attribute.Key("function.composite.kind")
+	attrCompositeName = attribute.Key("function.composite.name")
+	attrResources     = attribute.Key("function.watched_resources")
+	attrBatchSize     = attribute.Key("function.batch_size")
+
+	attrProvider     = attribute.Key("gen_ai.system")
+	attrModel        = attribute.Key("gen_ai.request.model")
+	attrInputTokens  = attribute.Key("gen_ai.usage.input_tokens")
+	attrOutputTokens = attribute.Key("gen_ai.usage.output_tokens")
+	attrStep         = attribute.Key("gen_ai.agent.step")
+	attrSteps        = attribute.Key("gen_ai.agent.steps")
+	attrToolCalls    = attribute.Key("gen_ai.tool.calls")
+)
+
+// startSpan starts a span using the function's tracer. Spans aren't recorded
+// if the function has no tracer.
+func (f *Function) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) { //nolint:ireturn // Returning the interface is the point.
+	if f.tracer == nil {
+		return noop.NewTracerProvider().Tracer(tracerName).Start(ctx, name, opts...)
+	}
+	return f.tracer.Start(ctx, name, opts...)
+}
+
+// endSpan ends the supplied span, recording the supplied error if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// A tracedModel records a span for each call an agent makes to a model.
+type tracedModel struct {
+	llms.Model
+
+	tracer trace.Tracer
+	cfg    llm.Config
+
+	// steps taken, and tokens used, by the agent so far.
+	steps      int
+	prompt     int
+	completion int
+}
+
+// GenerateContent calls the wrapped model, recording a span with the model,
+// its token usage, and any tools it asks the agent to call.
+func (m *tracedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, opts ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.steps++
+	ctx, span := m.tracer.Start(ctx, "agent.step", trace.WithAttributes(
+		attrProvider.String(m.cfg.Provider),
+		attrModel.String(llm.ModelName(m.cfg)),
+		attrStep.Int(m.steps),
+	))
+	rsp, err := m.Model.GenerateContent(ctx, messages, opts...)
+	if err != nil {
+		endSpan(span, err)
+		return rsp, err
+	}
+
+	prompt, completion := llm.Usage(rsp)
+	m.prompt += prompt
+	m.completion += completion
+	span.SetAttributes(attrInputTokens.Int(prompt), attrOutputTokens.Int(completion))
+	if calls := toolCalls(rsp); len(calls) > 0 {
+		span.SetAttributes(attrToolCalls.StringSlice(calls))
+	}
+	span.End()
+	return rsp, nil
+}
+
+// attributes summarizing the agent's invocation of the model.
+func (m *tracedModel) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attrSteps.Int(m.steps),
+		attrInputTokens.Int(m.prompt),
+		attrOutputTokens.Int(m.completion),
+	}
+}
+
+// toolCalls returns the names of the tools the supplied response asks the
+// agent to call.
+func toolCalls(rsp *llms.ContentResponse) []string {
+	var names []string
+	for _, c := range rsp.Choices {
+		for _, tc := range c.ToolCalls {
+			if tc.FunctionCall != nil {
+				names = append(names, tc.FunctionCall.Name)
+			}
+		}
+		if c.FuncCall != nil && len(c.ToolCalls) == 0 {
+			names = append(names, c.FuncCall.Name)
+		}
+	}
+	return names
+}
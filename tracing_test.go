@@ -0,0 +1,217 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/function-openai/internal/llm"
+)
+
+// span is the part of a recorded span the tests compare.
+type span struct {
+	Name       string
+	Attributes map[string]string
+	Status     codes.Code
+}
+
+// recorder returns a tracer provider that records spans in memory, and a
+// function that returns the spans it has recorded, in the order they ended.
+func recorder() (*sdktrace.TracerProvider, func() []span) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	return tp, func() []span {
+		out := make([]span, 0)
+		for _, s := range exp.GetSpans() {
+			attrs := make(map[string]string, len(s.Attributes))
+			for _, a := range s.Attributes {
+				attrs[string(a.Key)] = a.Value.Emit()
+			}
+			out = append(out, span{Name: s.Name, Attributes: attrs, Status: s.Status.Code})
+		}
+		return out
+	}
+}
+
+func TestRunFunctionSpans(t *testing.T) {
+	type args struct {
+		ai agentInvoker
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []span
+	}{
+		"Composed": {
+			reason: "The function's run and its composition pipeline should be traced.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return "---\napiVersion: example.org/v1\nkind: Bucket\nmetadata:\n  annotations:\n    upbound.io/name: bucket\n", nil
+					},
+				},
+			},
+			want: []span{
+				{
+					Name:       "compositionPipeline",
+					Attributes: map[string]string{"function.composite.kind": "XR", "function.composite.name": "cool-xr"},
+				},
+				{
+					Name:       "RunFunction",
+					Attributes: map[string]string{"function.tag": "hello", "function.pipeline": "composition"},
+				},
+			},
+		},
+		"InvokeError": {
+			reason: "Spans should record that the function failed.",
+			args: args{
+				ai: &mockAgentInvoker{
+					InvokeFn: func(_ context.Context, _ llm.Config, _, _ string, _ ...invokeOption) (string, error) {
+						return "", errors.New("boom")
+					},
+				},
+			},
+			want: []span{
+				{
+					Name:       "compositionPipeline",
+					Attributes: map[string]string{"function.composite.kind": "XR", "function.composite.name": "cool-xr"},
+					Status:     codes.Error,
+				},
+				{
+					Name:       "RunFunction",
+					Attributes: map[string]string{"function.tag": "hello", "function.pipeline": "composition"},
+					Status:     codes.Error,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tp, spans := recorder()
+			f := &Function{log: logging.NewNopLogger(), ai: tc.args.ai, tracer: tp.Tracer(tracerName)}
+
+			_, _ = f.RunFunction(t.Context(), &fnv1.RunFunctionRequest{
+				Meta:        &fnv1.RequestMeta{Tag: "hello"},
+				Input:       resource.MustStructJSON(`{"apiVersion":"openai.fn.upbound.io/v1alpha1","kind":"Prompt","userPrompt":"compose"}`),
+				Credentials: mockCredentials(),
+				Observed: &fnv1.State{Composite: &fnv1.Resource{
+					Resource: resource.MustStructJSON(`{"apiVersion":"example.org/v1","kind":"XR","metadata":{"name":"cool-xr"}}`),
+				}},
+				Desired: &fnv1.State{},
+			})
+
+			if diff := cmp.Diff(tc.want, spans()); diff != "" {
+				t.Errorf("%s\nRunFunction(...): -want spans, +got spans:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// stepModel is a stand-in llms.Model that responds with the supplied
+// response, or error.
+type stepModel struct {
+	llms.Model
+	rsp *llms.ContentResponse
+	err error
+}
+
+func (m *stepModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	return m.rsp, m.err
+}
+
+func TestTracedModel(t *testing.T) {
+	type args struct {
+		rsp *llms.ContentResponse
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []span
+	}{
+		"ToolCalls": {
+			reason: "A step should record the model, its token usage and the tools it asks the agent to call.",
+			args: args{
+				rsp: &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+					GenerationInfo: map[string]any{"PromptTokens": 100, "CompletionTokens": 20},
+					ToolCalls: []llms.ToolCall{
+						{FunctionCall: &llms.FunctionCall{Name: "get-bucket"}},
+						{FunctionCall: &llms.FunctionCall{Name: "list-buckets"}},
+					},
+				}}},
+			},
+			want: []span{{
+				Name: "agent.step",
+				Attributes: map[string]string{
+					"gen_ai.system":              "openai",
+					"gen_ai.request.model":       "gpt-4o",
+					"gen_ai.agent.step":          "1",
+					"gen_ai.usage.input_tokens":  "100",
+					"gen_ai.usage.output_tokens": "20",
+					"gen_ai.tool.calls":          `["get-bucket","list-buckets"]`,
+				},
+			}},
+		},
+		"Error": {
+			reason: "A failed step should be recorded as an error.",
+			args: args{
+				err: errors.New("boom"),
+			},
+			want: []span{{
+				Name: "agent.step",
+				Attributes: map[string]string{
+					"gen_ai.system":        "openai",
+					"gen_ai.request.model": "gpt-4o",
+					"gen_ai.agent.step":    "1",
+				},
+				Status: codes.Error,
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tp, spans := recorder()
+			m := &tracedModel{
+				Model:  &stepModel{rsp: tc.args.rsp, err: tc.args.err},
+				tracer: tp.Tracer(tracerName),
+				cfg:    llm.Config{Provider: llm.OpenAI, Model: "gpt-4o"},
+			}
+
+			_, _ = m.GenerateContent(t.Context(), nil)
+
+			if diff := cmp.Diff(tc.want, spans()); diff != "" {
+				t.Errorf("%s\nGenerateContent(...): -want spans, +got spans:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
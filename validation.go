@@ -0,0 +1,134 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/function-openai/input/v1alpha1"
+	"github.com/upbound/function-openai/internal/validate"
+)
+
+// validatorFrom returns a validator that knows about the core Kubernetes types
+// and any CRDs supplied as required or extra resources.
+func validatorFrom(req *fnv1.RunFunctionRequest) (*validate.Validator, error) {
+	v := validate.NewValidator()
+
+	for _, obj := range suppliedResources(req) {
+		if !validate.IsCRD(obj) {
+			continue
+		}
+		if err := v.AddCRD(obj); err != nil {
+			return nil, errors.Wrap(err, "cannot load schema from CRD")
+		}
+	}
+
+	return v, nil
+}
+
+// validateComposed validates the supplied composed resources, returning the
+// validation errors of each invalid resource.
+func validateComposed(v *validate.Validator, cds map[string]*fnv1.Resource, requireSchema bool) map[string]field.ErrorList {
+	invalid := map[string]field.ErrorList{}
+	for name, cd := range cds {
+		if name == compositeName {
+			continue
+		}
+		errs, known := v.Validate(cd.GetResource().AsMap())
+		if !known && requireSchema {
+			errs = field.ErrorList{field.InternalError(nil, errors.New("no schema is known for this resource's apiVersion and kind"))}
+		}
+		if len(errs) > 0 {
+			invalid[name] = errs
+		}
+	}
+	return invalid
+}
+
+// composeValid composes resources, validating them if the input asks for it.
+// Responses that can't be parsed or that contain invalid resources are fed
+// back to GPT to repair, up to the configured number of attempts. A Warning
+// result is returned for each resource that remains invalid, and an error if
+// the validation policy is Fatal.
+func (f *Function) composeValid(ctx context.Context, log logging.Logger, d pipelineDetails, prompt string) (map[string]*fnv1.Resource, error) {
+	var v *validate.Validator
+	if d.in.Validation != nil {
+		var err error
+		if v, err = validatorFrom(d.req); err != nil {
+			return nil, err
+		}
+	}
+
+	var dcds map[string]*fnv1.Resource
+	var invalid map[string]field.ErrorList
+	var perr error
+	attempt := func(ctx context.Context, prompt string) (string, []string, error) {
+		resp, out, err := f.compose(ctx, log, d, prompt)
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			f.metrics.ParseFailure(metricsLabels(d))
+			perr = err
+			return resp, []string{err.Error()}, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		dcds, perr = out, nil
+		if v == nil {
+			return resp, nil, nil
+		}
+		invalid = validateComposed(v, dcds, d.in.Validation.RequireSchema)
+		return resp, invalidMessages(invalid), nil
+	}
+
+	if err := f.repair(ctx, log, d, prompt, attempt); err != nil {
+		return nil, err
+	}
+	if perr != nil {
+		return nil, perr
+	}
+	if len(invalid) == 0 {
+		return dcds, nil
+	}
+
+	for _, msg := range invalidMessages(invalid) {
+		response.Warning(d.rsp, errors.New(msg))
+	}
+	if d.in.Validation.Policy == v1alpha1.ValidationPolicyWarn {
+		return dcds, nil
+	}
+	return nil, errors.Errorf("GPT generated %d invalid composed resources", len(invalid))
+}
+
+// invalidMessages returns a sorted message describing each invalid resource.
+func invalidMessages(invalid map[string]field.ErrorList) []string {
+	out := make([]string, 0, len(invalid))
+	for name, errs := range invalid {
+		out = append(out, fmt.Sprintf("composed resource %q is invalid: %s", name, errs.ToAggregate()))
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// contextKeyEnvironment is the pipeline context key function-environment-configs
+// and Crossplane write the merged EnvironmentConfigs to.
+const contextKeyEnvironment = "apiextensions.crossplane.io/environment"
+
+// PipelineVariables are available to prompts in both composition and
+// operation pipelines.
+type PipelineVariables struct {
+	// Context of the pipeline, as a YAML manifest. Contains anything
+	// previous functions in the pipeline wrote to the context.
+	Context string `json:"context"`
+
+	// Environment of the pipeline, as a YAML manifest. Contains the merged
+	// EnvironmentConfigs previous functions wrote to the context.
+	Environment string `json:"environment"`
+
+	// RequiredResources supplied to the function, as streams of YAML
+	// manifests keyed by the name of the requirement that selected them.
+	// Includes resources supplied as extra resources.
+	RequiredResources map[string]string `json:"requiredResources"`
+}
+
+// pipelineVariables returns the variables shared by the composition and
+// operation pipelines.
+func pipelineVariables(req *fnv1.RunFunctionRequest) (PipelineVariables, error) {
+	v := PipelineVariables{RequiredResources: map[string]string{}}
+
+	if fctx := req.GetContext(); len(fctx.GetFields()) > 0 {
+		y, err := structToYAML(fctx)
+		if err != nil {
+			return PipelineVariables{}, errors.Wrap(err, "cannot convert pipeline context to YAML")
+		}
+		v.Context = y
+	}
+
+	if env := req.GetContext().GetFields()[contextKeyEnvironment].GetStructValue(); env != nil {
+		y, err := structToYAML(env)
+		if err != nil {
+			return PipelineVariables{}, errors.Wrap(err, "cannot convert environment to YAML")
+		}
+		v.Environment = y
+	}
+
+	// Extra resources are the deprecated name for required resources, so
+	// required resources win if both use the same name.
+	for _, rrs := range []map[string]*fnv1.Resources{req.GetExtraResources(), req.GetRequiredResources()} {
+		for name, rs := range rrs {
+			y, err := resourcesToYAML(rs.GetItems())
+			if err != nil {
+				return PipelineVariables{}, errors.Wrapf(err, "cannot convert required resources %q to YAML", name)
+			}
+			v.RequiredResources[name] = y
+		}
+	}
+
+	return v, nil
+}
+
+// connectionDetailNames returns the sorted names of the supplied composite
+// resource's connection details. Only names are exposed to prompts, never the
+// secret values.
+func connectionDetailNames(xr *fnv1.Resource) []string {
+	names := make([]string, 0, len(xr.GetConnectionDetails()))
+	for name := range xr.GetConnectionDetails() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourcesToYAML returns the supplied resources as a YAML stream.
+func resourcesToYAML(rs []*fnv1.Resource) (string, error) {
+	out := &strings.Builder{}
+	for _, r := range rs {
+		y, err := structToYAML(r.GetResource())
+		if err != nil {
+			return "", err
+		}
+		out.WriteString("---\n")
+		out.WriteString(y)
+	}
+	return out.String(), nil
+}
+
+func structToYAML(s *structpb.Struct) (string, error) {
+	j, err := protojson.Marshal(s)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot convert to JSON")
+	}
+	y, err := yaml.JSONToYAML(j)
+	return string(y), errors.Wrap(err, "cannot convert to YAML")
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The Upbound Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestPipelineVariables(t *testing.T) {
+	type want struct {
+		v   PipelineVariables
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *fnv1.RunFunctionRequest
+		want   want
+	}{
+		"Empty": {
+			reason: "A request without context or required resources should produce empty variables.",
+			req:    &fnv1.RunFunctionRequest{},
+			want:   want{v: PipelineVariables{RequiredResources: map[string]string{}}},
+		},
+		"ContextAndEnvironment": {
+			reason: "The pipeline context and environment should be rendered as YAML.",
+			req: &fnv1.RunFunctionRequest{
+				Context: resource.MustStructJSON(`{"apiextensions.crossplane.io/environment":{"region":"us-east-1"},"example.org/key":"value"}`),
+			},
+			want: want{v: PipelineVariables{
+				Context:           "apiextensions.crossplane.io/environment:\n  region: us-east-1\nexample.org/key: value\n",
+				Environment:       "region: us-east-1\n",
+				RequiredResources: map[string]string{},
+			}},
+		},
+		"RequiredResources": {
+			reason: "Required and extra resources should be rendered as YAML streams, with required resources taking precedence.",
+			req: &fnv1.RunFunctionRequest{
+				ExtraResources: map[string]*fnv1.Resources{
+					"configs": {Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{"kind":"Old"}`)}}},
+					"vpcs":    {Items: []*fnv1.Resource{{Resource: resource.MustStructJSON(`{"kind":"VPC"}`)}}},
+				},
+				RequiredResources: map[string]*fnv1.Resources{
+					"configs": {Items: []*fnv1.Resource{
+						{Resource: resource.MustStructJSON(`{"kind":"ConfigMap","metadata":{"name":"a"}}`)},
+						{Resource: resource.MustStructJSON(`{"kind":"ConfigMap","metadata":{"name":"b"}}`)},
+					}},
+				},
+			},
+			want: want{v: PipelineVariables{
+				RequiredResources: map[string]string{
+					"configs": "---\nkind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n",
+					"vpcs":    "---\nkind: VPC\n",
+				},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v, err := pipelineVariables(tc.req)
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\npipelineVariables(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.v, v); diff != "" {
+				t.Errorf("\n%s\npipelineVariables(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestConnectionDetailNames(t *testing.T) {
+	xr := &fnv1.Resource{ConnectionDetails: map[string][]byte{"password": []byte("secret"), "endpoint": []byte("db")}}
+	want := []string{"endpoint", "password"}
+	if diff := cmp.Diff(want, connectionDetailNames(xr)); diff != "" {
+		t.Errorf("connectionDetailNames(...): -want, +got:\n%s", diff)
+	}
+}